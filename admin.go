@@ -0,0 +1,306 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Organisation ...
+type Organisation struct {
+	ID           string      `json:"id,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	UUID         string      `json:"uuid,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	Type         string      `json:"type,omitempty"`
+	Nationality  string      `json:"nationality,omitempty"`
+	Sector       string      `json:"sector,omitempty"`
+	Contacts     string      `json:"contacts,omitempty"`
+	CreatedBy    string      `json:"created_by,omitempty"`
+	DateCreated  string      `json:"date_created,omitempty"`
+	DateModified string      `json:"date_modified,omitempty"`
+	Local        bool        `json:"local,omitempty"`
+	UserCount    json.Number `json:"user_count,omitempty"`
+}
+
+// User is an account on the server
+type User struct {
+	ID            string `json:"id,omitempty"`
+	Email         string `json:"email,omitempty"`
+	OrgID         string `json:"org_id,omitempty"`
+	RoleID        string `json:"role_id,omitempty"`
+	Password      string `json:"password,omitempty"`
+	AuthKey       string `json:"authkey,omitempty"`
+	GPGKey        string `json:"gpgkey,omitempty"`
+	NidsSID       string `json:"nids_sid,omitempty"`
+	Autoalert     bool   `json:"autoalert,omitempty"`
+	Contactalert  bool   `json:"contactalert,omitempty"`
+	Disabled      bool   `json:"disabled,omitempty"`
+	ChangePw      bool   `json:"change_pw,omitempty"`
+	TermsAccepted bool   `json:"termsaccepted,omitempty"`
+	CurrentLogin  string `json:"current_login,omitempty"`
+	LastLogin     string `json:"last_login,omitempty"`
+	DateCreated   string `json:"date_created,omitempty"`
+	DateModified  string `json:"date_modified,omitempty"`
+
+	// Filled when reading users, ignored by the server otherwise
+	Role         *Role         `json:"-"`
+	Organisation *Organisation `json:"-"`
+}
+
+// Role defines the permissions of the users having it
+type Role struct {
+	ID                    string `json:"id,omitempty"`
+	Name                  string `json:"name,omitempty"`
+	Permission            string `json:"permission,omitempty"`
+	DefaultRole           bool   `json:"default_role,omitempty"`
+	RestrictedToSiteAdmin bool   `json:"restricted_to_site_admin,omitempty"`
+	EnforceRateLimit      bool   `json:"enforce_rate_limit,omitempty"`
+	RateLimitCount        string `json:"rate_limit_count,omitempty"`
+	MemoryLimit           string `json:"memory_limit,omitempty"`
+	MaxExecutionTime      string `json:"max_execution_time,omitempty"`
+
+	PermAdd                  bool `json:"perm_add,omitempty"`
+	PermModify               bool `json:"perm_modify,omitempty"`
+	PermModifyOrg            bool `json:"perm_modify_org,omitempty"`
+	PermPublish              bool `json:"perm_publish,omitempty"`
+	PermDelegate             bool `json:"perm_delegate,omitempty"`
+	PermSync                 bool `json:"perm_sync,omitempty"`
+	PermAdmin                bool `json:"perm_admin,omitempty"`
+	PermAudit                bool `json:"perm_audit,omitempty"`
+	PermAuth                 bool `json:"perm_auth,omitempty"`
+	PermSiteAdmin            bool `json:"perm_site_admin,omitempty"`
+	PermRegexpAccess         bool `json:"perm_regexp_access,omitempty"`
+	PermTagger               bool `json:"perm_tagger,omitempty"`
+	PermTemplate             bool `json:"perm_template,omitempty"`
+	PermSharingGroup         bool `json:"perm_sharing_group,omitempty"`
+	PermTagEditor            bool `json:"perm_tag_editor,omitempty"`
+	PermSighting             bool `json:"perm_sighting,omitempty"`
+	PermObjectTemplate       bool `json:"perm_object_template,omitempty"`
+	PermPublishZMQ           bool `json:"perm_publish_zmq,omitempty"`
+	PermPublishKafka         bool `json:"perm_publish_kafka,omitempty"`
+	PermDecaying             bool `json:"perm_decaying,omitempty"`
+	PermGalaxyEditor         bool `json:"perm_galaxy_editor,omitempty"`
+	PermWarninglist          bool `json:"perm_warninglist,omitempty"`
+	PermViewFeedCorrelations bool `json:"perm_view_feed_correlations,omitempty"`
+	PermAnalystData          bool `json:"perm_analyst_data,omitempty"`
+}
+
+// Permissions returns the names of the permissions granted by the role,
+// such as "perm_add" or "perm_site_admin", sorted
+func (role *Role) Permissions() []string {
+	buf, _ := json.Marshal(role)
+
+	var fields map[string]interface{}
+	json.Unmarshal(buf, &fields)
+
+	var perms []string
+	for name, v := range fields {
+		if granted, ok := v.(bool); ok && granted && strings.HasPrefix(name, "perm_") {
+			perms = append(perms, name)
+		}
+	}
+	sort.Strings(perms)
+
+	return perms
+}
+
+type organisationWrapper struct {
+	Organisation Organisation `json:"Organisation"`
+}
+
+type userWrapper struct {
+	User         User          `json:"User"`
+	Role         *Role         `json:"Role,omitempty"`
+	Organisation *Organisation `json:"Organisation,omitempty"`
+}
+
+func (w *userWrapper) user() *User {
+	u := w.User
+	u.Role = w.Role
+	u.Organisation = w.Organisation
+	return &u
+}
+
+type roleWrapper struct {
+	Role Role `json:"Role"`
+}
+
+// ListOrganisations returns the organisations. scope is "local", "external"
+// or "all".
+func (client *Client) ListOrganisations(scope string) ([]Organisation, error) {
+	var resp []organisationWrapper
+	if err := client.call("GET", fmt.Sprintf("/organisations/index/scope:%s", scope), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	orgs := make([]Organisation, len(resp))
+	for i, o := range resp {
+		orgs[i] = o.Organisation
+	}
+
+	return orgs, nil
+}
+
+// GetOrganisation returns the organisation with the given ID or UUID
+func (client *Client) GetOrganisation(orgID string) (*Organisation, error) {
+	return client.organisationCall("GET", fmt.Sprintf("/organisations/view/%s", orgID), nil)
+}
+
+// AddOrganisation creates an organisation, site admin only
+func (client *Client) AddOrganisation(org *Organisation) (*Organisation, error) {
+	return client.organisationCall("POST", "/admin/organisations/add", org)
+}
+
+// EditOrganisation updates the organisation identified by org.ID
+func (client *Client) EditOrganisation(org *Organisation) (*Organisation, error) {
+	return client.organisationCall("POST", fmt.Sprintf("/admin/organisations/edit/%s", org.ID), org)
+}
+
+func (client *Client) organisationCall(method, path string, req interface{}) (*Organisation, error) {
+	var resp organisationWrapper
+	if err := client.call(method, path, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Organisation, nil
+}
+
+// DeleteOrganisation deletes an organisation, it must not have any user
+func (client *Client) DeleteOrganisation(orgID string) error {
+	return client.postAction(fmt.Sprintf("/admin/organisations/delete/%s", orgID), nil)
+}
+
+// MergeOrganisation moves the users, events... of the organisation orgID to
+// the local organisation targetID and deletes orgID. The endpoint is the
+// one of the merge form, which answers with a redirection to the target
+// organisation: any other answer, such as the form again, is an error.
+func (client *Client) MergeOrganisation(orgID, targetID string) error {
+	req := map[string]interface{}{
+		"Organisation": map[string]string{
+			"targetType": "0",
+			"orgsLocal":  targetID,
+		},
+	}
+
+	return client.postAction(fmt.Sprintf("/admin/organisations/merge/%s", orgID), req)
+}
+
+// ListUsers returns all the users, with their role and organisation
+func (client *Client) ListUsers() ([]User, error) {
+	var resp []userWrapper
+	if err := client.call("GET", "/admin/users/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	users := make([]User, len(resp))
+	for i := range resp {
+		users[i] = *resp[i].user()
+	}
+
+	return users, nil
+}
+
+// ListOrgUsers returns the users of an organisation
+func (client *Client) ListOrgUsers(orgID string) ([]User, error) {
+	all, err := client.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	for _, u := range all {
+		if u.OrgID == orgID {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+// GetUser returns the user with the given ID
+func (client *Client) GetUser(userID string) (*User, error) {
+	return client.userCall("GET", fmt.Sprintf("/admin/users/view/%s", userID), nil)
+}
+
+// AddUser creates a user
+func (client *Client) AddUser(user *User) (*User, error) {
+	return client.userCall("POST", "/admin/users/add", user)
+}
+
+// EditUser updates the user identified by user.ID
+func (client *Client) EditUser(user *User) (*User, error) {
+	return client.userCall("POST", fmt.Sprintf("/admin/users/edit/%s", user.ID), user)
+}
+
+// DisableUser prevents a user from logging in and using the API
+func (client *Client) DisableUser(userID string) error {
+	return client.setUserDisabled(userID, true)
+}
+
+// EnableUser enables back a disabled user
+func (client *Client) EnableUser(userID string) error {
+	return client.setUserDisabled(userID, false)
+}
+
+func (client *Client) setUserDisabled(userID string, disabled bool) error {
+	// User.Disabled is omitted when false, build the request by hand
+	req := map[string]interface{}{"disabled": disabled}
+	return client.postAction(fmt.Sprintf("/admin/users/edit/%s", userID), req)
+}
+
+// DeleteUser deletes a user
+func (client *Client) DeleteUser(userID string) error {
+	return client.postAction(fmt.Sprintf("/admin/users/delete/%s", userID), nil)
+}
+
+func (client *Client) userCall(method, path string, req interface{}) (*User, error) {
+	var resp userWrapper
+	if err := client.call(method, path, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.user(), nil
+}
+
+// ResetAuthKey generates a new API key for the user and returns it
+func (client *Client) ResetAuthKey(userID string) (string, error) {
+	var resp actionResponse
+	if err := client.call("POST", fmt.Sprintf("/users/resetauthkey/%s", userID), nil, &resp); err != nil {
+		return "", err
+	}
+
+	const prefix = "Authkey updated: "
+	msg := resp.message()
+	if !strings.HasPrefix(msg, prefix) {
+		return "", fmt.Errorf("MISP returned an unexpected answer: %s", msg)
+	}
+
+	return strings.TrimPrefix(msg, prefix), nil
+}
+
+// ListRoles returns the roles defined on the server
+func (client *Client) ListRoles() ([]Role, error) {
+	var resp []roleWrapper
+	if err := client.call("GET", "/roles/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	roles := make([]Role, len(resp))
+	for i, r := range resp {
+		roles[i] = r.Role
+	}
+
+	return roles, nil
+}
+
+// GetRole returns the role with the given ID
+func (client *Client) GetRole(roleID string) (*Role, error) {
+	var resp roleWrapper
+	if err := client.call("GET", fmt.Sprintf("/roles/view/%s", roleID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Role, nil
+}
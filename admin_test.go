@@ -0,0 +1,183 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAddOrganisation(t *testing.T) {
+	setup()
+
+	org := &Organisation{Name: "ACME CERT", Nationality: "France", Sector: "Aerospace", Local: true}
+
+	mux.HandleFunc("/admin/organisations/add",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got Organisation
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Organisation request: %s", err)
+			}
+			if got != *org {
+				t.Errorf("AddOrganisation sent %+v, want %+v", got, *org)
+			}
+
+			fmt.Fprint(w, `{"Organisation":{"id":"7","name":"ACME CERT","uuid":"5f0c9a7e-0000-4c8e-8f0d-2c4d0a3ac101","nationality":"France","sector":"Aerospace","local":true,"created_by":"1","date_created":"2020-07-13 10:00:00"}}`)
+		})
+
+	newOrg, err := client.AddOrganisation(org)
+	if err != nil {
+		t.Fatalf("AddOrganisation returned an error: %s", err)
+	}
+
+	if newOrg.ID != "7" || newOrg.UUID == "" {
+		t.Errorf("AddOrganisation returned %+v", newOrg)
+	}
+}
+
+func TestListOrgUsers(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/admin/users/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[
+				{"User":{"id":"1","email":"admin@admin.test","org_id":"1","role_id":"1"},"Role":{"id":"1","name":"admin","perm_site_admin":true},"Organisation":{"id":"1","name":"ORGNAME"}},
+				{"User":{"id":"4","email":"analyst@acme.com","org_id":"7","role_id":"3","disabled":false},"Role":{"id":"3","name":"User","perm_add":true},"Organisation":{"id":"7","name":"ACME CERT"}}
+			]`)
+		})
+
+	users, err := client.ListOrgUsers("7")
+	if err != nil {
+		t.Fatalf("ListOrgUsers returned an error: %s", err)
+	}
+
+	if len(users) != 1 || users[0].Email != "analyst@acme.com" || users[0].Role.Name != "User" || users[0].Organisation.Name != "ACME CERT" {
+		t.Errorf("ListOrgUsers returned %+v", users)
+	}
+}
+
+func TestDisableUser(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/admin/users/edit/4",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json User request: %s", err)
+			}
+			if got["disabled"] != true {
+				t.Errorf("DisableUser sent %+v", got)
+			}
+
+			fmt.Fprint(w, `{"User":{"id":"4","disabled":true}}`)
+		})
+
+	if err := client.DisableUser("4"); err != nil {
+		t.Errorf("DisableUser returned an error: %s", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/admin/users/delete/4",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Could not delete the user.","message":"Could not delete the user.","url":"\/admin\/users\/delete\/4","errors":"Could not delete the user."}`)
+		})
+
+	mux.HandleFunc("/admin/users/delete/5",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `<!DOCTYPE html><html><body>Login</body></html>`)
+		})
+
+	if err := client.DeleteUser("4"); err == nil {
+		t.Errorf("DeleteUser did not return the error of the server")
+	}
+	if err := client.DeleteUser("5"); err == nil {
+		t.Errorf("DeleteUser accepted an HTML page")
+	}
+}
+
+func TestMergeOrganisation(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/admin/organisations/merge/3",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json merge request: %s", err)
+			}
+			if got["Organisation"]["orgsLocal"] != "7" {
+				t.Errorf("MergeOrganisation sent %+v", got)
+			}
+
+			http.Redirect(w, r, "/organisations/view/7", http.StatusFound)
+		})
+
+	mux.HandleFunc("/organisations/view/7",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"Organisation":{"id":"7","name":"ACME"}}`)
+		})
+
+	mux.HandleFunc("/admin/organisations/merge/4",
+		func(w http.ResponseWriter, r *http.Request) {
+			// The form again
+			fmt.Fprint(w, `<!DOCTYPE html><html><body><form></form></body></html>`)
+		})
+
+	if err := client.MergeOrganisation("3", "7"); err != nil {
+		t.Errorf("MergeOrganisation returned an error: %s", err)
+	}
+	if err := client.MergeOrganisation("4", "7"); err == nil {
+		t.Errorf("MergeOrganisation accepted the merge form")
+	}
+}
+
+func TestResetAuthKey(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/users/resetauthkey/4",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":"Authkey updated: Xe0dmJiVUdMlHkVxVWAY9ThJkHWV0z6WYIQ4bDKm","name":"Authkey updated: Xe0dmJiVUdMlHkVxVWAY9ThJkHWV0z6WYIQ4bDKm","message":"Authkey updated: Xe0dmJiVUdMlHkVxVWAY9ThJkHWV0z6WYIQ4bDKm","url":"\/users\/resetauthkey\/4","id":"4"}`)
+		})
+
+	key, err := client.ResetAuthKey("4")
+	if err != nil {
+		t.Fatalf("ResetAuthKey returned an error: %s", err)
+	}
+
+	if key != "Xe0dmJiVUdMlHkVxVWAY9ThJkHWV0z6WYIQ4bDKm" {
+		t.Errorf("ResetAuthKey returned %q", key)
+	}
+}
+
+func TestGetRole(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/roles/view/3",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"Role":{"id":"3","name":"User","permission":"3","perm_add":true,"perm_modify":true,"perm_publish":false,"perm_tagger":true,"perm_sighting":true,"perm_site_admin":false}}`)
+		})
+
+	role, err := client.GetRole("3")
+	if err != nil {
+		t.Fatalf("GetRole returned an error: %s", err)
+	}
+
+	want := []string{"perm_add", "perm_modify", "perm_sighting", "perm_tagger"}
+	if got := role.Permissions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Permissions returned %v, want %v", got, want)
+	}
+}
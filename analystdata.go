@@ -0,0 +1,310 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Types of analyst data, introduced in MISP 2.5
+const (
+	AnalystDataNote         = "Note"
+	AnalystDataOpinion      = "Opinion"
+	AnalystDataRelationship = "Relationship"
+)
+
+// AnalystDataBase holds the fields shared by notes, opinions and
+// relationships. ObjectUUID and ObjectType identify the element (event,
+// attribute, object, other analyst data...) the data is attached to.
+type AnalystDataBase struct {
+	ID             string       `json:"id,omitempty"`
+	UUID           string       `json:"uuid,omitempty"`
+	ObjectUUID     string       `json:"object_uuid,omitempty"`
+	ObjectType     string       `json:"object_type,omitempty"`
+	Authors        string       `json:"authors,omitempty"`
+	OrgUUID        string       `json:"org_uuid,omitempty"`
+	OrgcUUID       string       `json:"orgc_uuid,omitempty"`
+	Created        string       `json:"created,omitempty"`
+	Modified       string       `json:"modified,omitempty"`
+	Distribution   Distribution `json:"distribution,omitempty"`
+	SharingGroupID string       `json:"sharing_group_id,omitempty"`
+	Locked         bool         `json:"locked,omitempty"`
+}
+
+// Note is a free text comment of an analyst
+type Note struct {
+	AnalystDataBase
+	Note     string `json:"note,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// Opinion is the confidence of an analyst in an element, from 0 to 100
+type Opinion struct {
+	AnalystDataBase
+	Opinion json.Number `json:"opinion,omitempty"`
+	Comment string      `json:"comment,omitempty"`
+}
+
+// Relationship links an element to another one
+type Relationship struct {
+	AnalystDataBase
+	RelatedObjectUUID string `json:"related_object_uuid,omitempty"`
+	RelatedObjectType string `json:"related_object_type,omitempty"`
+	RelationshipType  string `json:"relationship_type,omitempty"`
+}
+
+// AnalystData groups the analyst data attached to an element
+type AnalystData struct {
+	Notes         []Note
+	Opinions      []Opinion
+	Relationships []Relationship
+}
+
+// AverageOpinion returns the mean of the opinions, ok is false when there
+// is no valid opinion
+func (d *AnalystData) AverageOpinion() (avg float64, ok bool) {
+	var sum float64
+	n := 0
+	for _, o := range d.Opinions {
+		v, err := o.Opinion.Float64()
+		if err != nil {
+			continue
+		}
+		sum += v
+		n++
+	}
+
+	if n == 0 {
+		return 0, false
+	}
+
+	return sum / float64(n), true
+}
+
+// AddNote attaches a note to the element objectUUID of type objectType
+// (Event, Attribute, Object...)
+func (client *Client) AddNote(objectType, objectUUID string, note *Note) (*Note, error) {
+	var resp Note
+	if err := client.addAnalystData(AnalystDataNote, objectType, objectUUID, note, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// AddOpinion attaches an opinion to the element objectUUID of type objectType
+func (client *Client) AddOpinion(objectType, objectUUID string, opinion *Opinion) (*Opinion, error) {
+	var resp Opinion
+	if err := client.addAnalystData(AnalystDataOpinion, objectType, objectUUID, opinion, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// AddRelationship attaches a relationship to the element objectUUID of type
+// objectType
+func (client *Client) AddRelationship(objectType, objectUUID string, rel *Relationship) (*Relationship, error) {
+	var resp Relationship
+	if err := client.addAnalystData(AnalystDataRelationship, objectType, objectUUID, rel, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// EditNote updates the note identified by note.ID
+func (client *Client) EditNote(note *Note) (*Note, error) {
+	var resp Note
+	if err := client.analystDataCall("POST", "edit", AnalystDataNote, note.ID, note, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// EditOpinion updates the opinion identified by opinion.ID
+func (client *Client) EditOpinion(opinion *Opinion) (*Opinion, error) {
+	var resp Opinion
+	if err := client.analystDataCall("POST", "edit", AnalystDataOpinion, opinion.ID, opinion, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// EditRelationship updates the relationship identified by rel.ID
+func (client *Client) EditRelationship(rel *Relationship) (*Relationship, error) {
+	var resp Relationship
+	if err := client.analystDataCall("POST", "edit", AnalystDataRelationship, rel.ID, rel, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetNote returns the note with the given ID or UUID
+func (client *Client) GetNote(id string) (*Note, error) {
+	var resp Note
+	if err := client.analystDataCall("GET", "view", AnalystDataNote, id, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetOpinion returns the opinion with the given ID or UUID
+func (client *Client) GetOpinion(id string) (*Opinion, error) {
+	var resp Opinion
+	if err := client.analystDataCall("GET", "view", AnalystDataOpinion, id, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetRelationship returns the relationship with the given ID or UUID
+func (client *Client) GetRelationship(id string) (*Relationship, error) {
+	var resp Relationship
+	if err := client.analystDataCall("GET", "view", AnalystDataRelationship, id, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// DeleteAnalystData deletes a note, opinion or relationship
+func (client *Client) DeleteAnalystData(dataType, id string) error {
+	return client.postAction(fmt.Sprintf("/analystData/delete/%s/%s", dataType, id), nil)
+}
+
+// ListNotes returns all the notes visible by the user
+func (client *Client) ListNotes() ([]Note, error) {
+	return client.listNotes(nil)
+}
+
+// ListOpinions returns all the opinions visible by the user
+func (client *Client) ListOpinions() ([]Opinion, error) {
+	return client.listOpinions(nil)
+}
+
+// ListRelationships returns all the relationships visible by the user
+func (client *Client) ListRelationships() ([]Relationship, error) {
+	return client.listRelationships(nil)
+}
+
+// GetAnalystData returns the notes, opinions and relationships attached to
+// the element with the given UUID
+func (client *Client) GetAnalystData(objectUUID string) (*AnalystData, error) {
+	filter := url.Values{"object_uuid": {objectUUID}}
+
+	var err error
+	data := &AnalystData{}
+	if data.Notes, err = client.listNotes(filter); err != nil {
+		return nil, err
+	}
+	if data.Opinions, err = client.listOpinions(filter); err != nil {
+		return nil, err
+	}
+	if data.Relationships, err = client.listRelationships(filter); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetEventAnalystData returns the analyst data attached to an event
+func (client *Client) GetEventAnalystData(eventUUID string) (*AnalystData, error) {
+	return client.GetAnalystData(eventUUID)
+}
+
+// GetAttributeAnalystData returns the analyst data attached to an attribute
+func (client *Client) GetAttributeAnalystData(attr *Attribute) (*AnalystData, error) {
+	return client.GetAnalystData(attr.UUID)
+}
+
+func (client *Client) addAnalystData(dataType, objectType, objectUUID string, req, out interface{}) error {
+	path := fmt.Sprintf("/analystData/add/%s/%s/%s", dataType, objectUUID, objectType)
+	return client.analystDataPath("POST", path, dataType, req, out)
+}
+
+func (client *Client) analystDataCall(method, action, dataType, id string, req, out interface{}) error {
+	path := fmt.Sprintf("/analystData/%s/%s/%s", action, dataType, id)
+	return client.analystDataPath(method, path, dataType, req, out)
+}
+
+// analystDataPath sends the request and unwraps the answer, which is
+// wrapped in an object named after the data type
+func (client *Client) analystDataPath(method, path, dataType string, req, out interface{}) error {
+	var resp map[string]json.RawMessage
+	if err := client.call(method, path, req, &resp); err != nil {
+		return err
+	}
+
+	raw, ok := resp[dataType]
+	if !ok {
+		return fmt.Errorf("Inner structure has unknown format")
+	}
+
+	return json.Unmarshal(raw, out)
+}
+
+func (client *Client) listAnalystData(dataType string, filter url.Values, fn func(json.RawMessage) error) error {
+	path := fmt.Sprintf("/analystData/index/%s", dataType)
+	if len(filter) > 0 {
+		path += "?" + filter.Encode()
+	}
+
+	var resp []map[string]json.RawMessage
+	if err := client.call("GET", path, nil, &resp); err != nil {
+		return err
+	}
+
+	for _, wrapper := range resp {
+		raw, ok := wrapper[dataType]
+		if !ok {
+			return fmt.Errorf("Inner structure has unknown format")
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client *Client) listNotes(filter url.Values) ([]Note, error) {
+	var notes []Note
+	err := client.listAnalystData(AnalystDataNote, filter, func(raw json.RawMessage) error {
+		var n Note
+		err := json.Unmarshal(raw, &n)
+		notes = append(notes, n)
+		return err
+	})
+
+	return notes, err
+}
+
+func (client *Client) listOpinions(filter url.Values) ([]Opinion, error) {
+	var opinions []Opinion
+	err := client.listAnalystData(AnalystDataOpinion, filter, func(raw json.RawMessage) error {
+		var o Opinion
+		err := json.Unmarshal(raw, &o)
+		opinions = append(opinions, o)
+		return err
+	})
+
+	return opinions, err
+}
+
+func (client *Client) listRelationships(filter url.Values) ([]Relationship, error) {
+	var rels []Relationship
+	err := client.listAnalystData(AnalystDataRelationship, filter, func(raw json.RawMessage) error {
+		var r Relationship
+		err := json.Unmarshal(raw, &r)
+		rels = append(rels, r)
+		return err
+	})
+
+	return rels, err
+}
@@ -0,0 +1,98 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAddOpinion(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/analystData/add/Opinion/5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101/Attribute",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got Opinion
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Opinion request: %s", err)
+			}
+			if got.Opinion != "80" || got.Comment != "Seen in our sandbox" {
+				t.Errorf("AddOpinion sent %+v", got)
+			}
+
+			fmt.Fprint(w, `{"Opinion":{"id":"5","uuid":"6601a1b2-0000-4c8e-8f0d-2c4d0a3ac101","object_uuid":"5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101","object_type":"Attribute","authors":"analyst@acme.com","opinion":80,"comment":"Seen in our sandbox","distribution":"1","locked":false}}`)
+		})
+
+	opinion, err := client.AddOpinion("Attribute", "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101", &Opinion{Opinion: "80", Comment: "Seen in our sandbox"})
+	if err != nil {
+		t.Fatalf("AddOpinion returned an error: %s", err)
+	}
+
+	if opinion.ID != "5" || opinion.ObjectType != "Attribute" || opinion.Opinion != "80" {
+		t.Errorf("AddOpinion returned %+v", opinion)
+	}
+}
+
+func TestGetAttributeAnalystData(t *testing.T) {
+	setup()
+
+	attr := &Attribute{UUID: "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101"}
+
+	handler := func(dataType, body string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			if got := r.URL.Query().Get("object_uuid"); got != attr.UUID {
+				t.Errorf("%s index filtered on object_uuid=%q, want %q", dataType, got, attr.UUID)
+			}
+			fmt.Fprint(w, body)
+		}
+	}
+
+	mux.HandleFunc("/analystData/index/Note", handler("Note", `[{"Note":{"id":"1","object_uuid":"5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101","object_type":"Attribute","note":"C2 of the Foobar campaign","language":"en"}}]`))
+	mux.HandleFunc("/analystData/index/Opinion", handler("Opinion", `[{"Opinion":{"id":"5","opinion":"80"}},{"Opinion":{"id":"6","opinion":40}}]`))
+	mux.HandleFunc("/analystData/index/Relationship", handler("Relationship", `[]`))
+
+	data, err := client.GetAttributeAnalystData(attr)
+	if err != nil {
+		t.Fatalf("GetAttributeAnalystData returned an error: %s", err)
+	}
+
+	if len(data.Notes) != 1 || data.Notes[0].Note != "C2 of the Foobar campaign" || len(data.Relationships) != 0 {
+		t.Errorf("GetAttributeAnalystData returned %+v", data)
+	}
+
+	if avg, ok := data.AverageOpinion(); !ok || avg != 60 {
+		t.Errorf("AverageOpinion returned %v, %v, want 60", avg, ok)
+	}
+
+	// The query string must not leak into the base URL of the client
+	if client.BaseURL.RawQuery != "" {
+		t.Errorf("BaseURL was modified: %s", client.BaseURL)
+	}
+}
+
+func TestDeleteAnalystData(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/analystData/delete/Note/5",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":true,"name":"Note deleted.","message":"Note deleted.","url":"\/analystData\/delete\/Note\/5"}`)
+		})
+
+	mux.HandleFunc("/analystData/delete/Note/6",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Could not delete Note.","message":"Could not delete Note.","url":"\/analystData\/delete\/Note\/6","errors":"Could not delete Note."}`)
+		})
+
+	if err := client.DeleteAnalystData("Note", "5"); err != nil {
+		t.Errorf("DeleteAnalystData returned an error: %s", err)
+	}
+
+	if err := client.DeleteAnalystData("Note", "6"); err == nil {
+		t.Errorf("DeleteAnalystData did not return an error")
+	}
+}
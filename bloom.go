@@ -0,0 +1,283 @@
+package misp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// Constants of the fingerprints of the values, as in the DCSO tool
+const (
+	bloomModulus    uint64 = 18446744073709551557
+	bloomMultiplier uint64 = 18446744073709550147
+)
+
+// bloomHeaderSize is the size of the version, n, p, k, m and N at the
+// start of a filter
+const bloomHeaderSize = 6 * 8
+
+// bloomVersion is the only version of the format, in the low byte of the
+// first header value
+const bloomVersion = 1
+
+// BloomFilter is a bloom filter of attribute values, to share the
+// indicators of a MISP server without their values: partners can check
+// whether they know a value, with a rate of false positives.
+//
+// The binary format, the sizing and the hashing of the values are those of
+// the DCSO bloom filters (github.com/DCSO/bloom) exported by MISP: filters
+// written by the DCSO tool can be read and checked, and the other way
+// round.
+type BloomFilter struct {
+	n uint64  // capacity
+	p float64 // false positive rate at capacity
+	k uint64  // number of hash functions
+	m uint64  // number of bits
+	N uint64  // number of values added
+
+	v []uint64
+
+	// Data is free form data kept at the end of the filter, such as the
+	// description of its content
+	Data []byte
+}
+
+// NewBloomFilter returns an empty filter sized for n values with a false
+// positive rate of p
+func NewBloomFilter(n uint64, p float64) (*BloomFilter, error) {
+	if n == 0 {
+		return nil, fmt.Errorf("bloom filter capacity must be positive")
+	}
+	if p <= 0 || p >= 1 {
+		return nil, fmt.Errorf("bloom filter false positive rate %g is not in ]0, 1[", p)
+	}
+
+	// Same expression as the DCSO tool, which rounds towards zero
+	bits := math.Abs(math.Ceil(float64(n) * math.Log(p) / math.Pow(math.Log(2), 2)))
+
+	return &BloomFilter{
+		n: n,
+		p: p,
+		k: uint64(math.Ceil(math.Log(2) * bits / float64(n))),
+		m: uint64(bits),
+		v: make([]uint64, bloomWords(uint64(bits))),
+	}, nil
+}
+
+// bloomWords returns the number of 64 bits words holding m bits
+func bloomWords(m uint64) uint64 {
+	return (m + 63) / 64
+}
+
+// fingerprint returns the indexes of the bits of value
+func (f *BloomFilter) fingerprint(value []byte, indexes []uint64) {
+	h := fnv.New64()
+	h.Write(value)
+
+	// The products are allowed to overflow
+	hn := h.Sum64() % bloomModulus
+	for i := range indexes {
+		hn = (hn * bloomMultiplier) % bloomModulus
+		indexes[i] = hn % f.m
+	}
+}
+
+// Add adds value to the filter. Like the DCSO tool, the count of values
+// is only increased when one of the bits of value was not set.
+func (f *BloomFilter) Add(value []byte) {
+	indexes := make([]uint64, f.k)
+	f.fingerprint(value, indexes)
+
+	added := false
+	for _, i := range indexes {
+		bit := uint64(1) << (i % 64)
+		if f.v[i/64]&bit == 0 {
+			added = true
+		}
+		f.v[i/64] |= bit
+	}
+	if added {
+		f.N++
+	}
+}
+
+// AddString is a shortcut to Add for a string
+func (f *BloomFilter) AddString(value string) {
+	f.Add([]byte(value))
+}
+
+// Check reports whether value may have been added to the filter. False
+// positives are possible, false negatives are not.
+func (f *BloomFilter) Check(value []byte) bool {
+	indexes := make([]uint64, f.k)
+	f.fingerprint(value, indexes)
+	for _, i := range indexes {
+		if f.v[i/64]&(1<<(i%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckString is a shortcut to Check for a string
+func (f *BloomFilter) CheckString(value string) bool {
+	return f.Check([]byte(value))
+}
+
+// Len returns the number of distinct values added to the filter, an
+// estimate as values whose bits were all set are not counted
+func (f *BloomFilter) Len() uint64 {
+	return f.N
+}
+
+// Capacity returns the number of values the filter was sized for
+func (f *BloomFilter) Capacity() uint64 {
+	return f.n
+}
+
+// FalsePositiveRate returns the rate the filter was sized for. It is
+// exceeded once more values than its capacity are added.
+func (f *BloomFilter) FalsePositiveRate() float64 {
+	return f.p
+}
+
+// AddAttributes adds the values of attrs, and each part of the composite
+// values (such as "filename|md5"), the deleted attributes being skipped
+func (f *BloomFilter) AddAttributes(attrs []Attribute) {
+	for _, attr := range attrs {
+		if attr.Deleted {
+			continue
+		}
+
+		f.AddString(attr.Value)
+		if strings.Contains(attr.Type, "|") {
+			for _, part := range strings.Split(attr.Value, "|") {
+				if part != "" && part != attr.Value {
+					f.AddString(part)
+				}
+			}
+		}
+	}
+}
+
+// WriteTo writes the filter in the DCSO format: the version, n, p, k, m and
+// N as little endian 64 bits values, the bits as 64 bits words, and Data
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	buf := make([]byte, 8)
+	header := []uint64{bloomVersion, f.n, math.Float64bits(f.p), f.k, f.m, f.N}
+	for _, x := range header {
+		binary.LittleEndian.PutUint64(buf, x)
+		bw.Write(buf)
+	}
+	for _, x := range f.v {
+		binary.LittleEndian.PutUint64(buf, x)
+		bw.Write(buf)
+	}
+	bw.Write(f.Data)
+
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
+
+// ReadBloomFilter reads a filter written by WriteTo, or by the DCSO tool
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, bloomHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("Could not read bloom filter header: %s", err)
+	}
+
+	if version := binary.LittleEndian.Uint64(header[0:]) & 0xff; version != bloomVersion {
+		return nil, fmt.Errorf("Unsupported bloom filter version %d", version)
+	}
+
+	f := &BloomFilter{
+		n: binary.LittleEndian.Uint64(header[8:]),
+		p: math.Float64frombits(binary.LittleEndian.Uint64(header[16:])),
+		k: binary.LittleEndian.Uint64(header[24:]),
+		m: binary.LittleEndian.Uint64(header[32:]),
+		N: binary.LittleEndian.Uint64(header[40:]),
+	}
+
+	if f.p <= 0 || f.p >= 1 || f.k == 0 || f.k > 1024 || f.m == 0 {
+		return nil, fmt.Errorf("Invalid bloom filter header: n=%d p=%g k=%d m=%d", f.n, f.p, f.k, f.m)
+	}
+
+	// The words are read as they come, the header being untrusted
+	br := bufio.NewReader(r)
+	buf := make([]byte, 8)
+	words := bloomWords(f.m)
+	f.v = make([]uint64, 0, minUint64(words, 1<<16))
+	for i := uint64(0); i < words; i++ {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("Could not read bloom filter: %s", err)
+		}
+		f.v = append(f.v, binary.LittleEndian.Uint64(buf))
+	}
+
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read bloom filter data: %s", err)
+	}
+	if len(data) > 0 {
+		f.Data = data
+	}
+
+	return f, nil
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// BuildBloomFilter returns a filter of the values of the attributes
+// matching q, with a false positive rate of p
+func (client *Client) BuildBloomFilter(q *AttributeQuery, p float64) (*BloomFilter, error) {
+	attrs, err := client.SearchAttribute(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// Room for the parts of the composite values
+	n := uint64(0)
+	for _, attr := range attrs {
+		n += uint64(strings.Count(attr.Type, "|")) + 1
+	}
+	if n == 0 {
+		n = 1
+	}
+
+	f, err := NewBloomFilter(n, p)
+	if err != nil {
+		return nil, err
+	}
+	f.AddAttributes(attrs)
+
+	return f, nil
+}
@@ -0,0 +1,188 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	f, err := NewBloomFilter(10000, 0.001)
+	if err != nil {
+		t.Fatalf("NewBloomFilter returned an error: %s", err)
+	}
+	if f.m != 143775 || f.k != 10 {
+		t.Errorf("NewBloomFilter sized the filter with m=%d k=%d", f.m, f.k)
+	}
+
+	for i := 0; i < 10000; i++ {
+		f.AddString(fmt.Sprintf("198.51.%d.%d", i/256, i%256))
+	}
+	// Values whose bits were all set already are not counted
+	if f.Len() < 9990 || f.Len() > 10000 {
+		t.Errorf("Len returned %d", f.Len())
+	}
+
+	for i := 0; i < 10000; i++ {
+		if !f.CheckString(fmt.Sprintf("198.51.%d.%d", i/256, i%256)) {
+			t.Fatalf("Check returned false for an added value")
+		}
+	}
+
+	positives := 0
+	for i := 0; i < 100000; i++ {
+		if f.CheckString(fmt.Sprintf("unknown-%d.example", i)) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / 100000; rate > 0.002 {
+		t.Errorf("False positive rate is %g", rate)
+	}
+
+	for _, test := range []struct {
+		n uint64
+		p float64
+	}{{0, 0.01}, {10, 0}, {10, 1}} {
+		if _, err := NewBloomFilter(test.n, test.p); err == nil {
+			t.Errorf("NewBloomFilter accepted n=%d p=%g", test.n, test.p)
+		}
+	}
+}
+
+func TestBloomFilterWriteRead(t *testing.T) {
+	f, _ := NewBloomFilter(100, 0.01)
+	f.AddString("foo.example")
+	f.AddString("d41d8cd98f00b204e9800998ecf8427e")
+	f.Data = []byte("MISP indicators")
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo returned an error: %s", err)
+	}
+	if n != int64(buf.Len()) || buf.Len() != 48+8*int(bloomWords(f.m))+len(f.Data) {
+		t.Errorf("WriteTo wrote %d bytes, returned %d", buf.Len(), n)
+	}
+
+	// Header in the DCSO layout
+	b := buf.Bytes()
+	if binary.LittleEndian.Uint64(b[0:]) != 1 || binary.LittleEndian.Uint64(b[8:]) != 100 || math.Float64frombits(binary.LittleEndian.Uint64(b[16:])) != 0.01 ||
+		binary.LittleEndian.Uint64(b[24:]) != f.k || binary.LittleEndian.Uint64(b[32:]) != f.m || binary.LittleEndian.Uint64(b[40:]) != 2 {
+		t.Errorf("WriteTo wrote the header %x", b[:48])
+	}
+
+	// Count of the bytes written before an error
+	lw := &limitedWriter{limit: 100}
+	if n, err := f.WriteTo(lw); err == nil || n != 100 {
+		t.Errorf("WriteTo to a failing writer returned %d, %v", n, err)
+	}
+
+	g, err := ReadBloomFilter(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadBloomFilter returned an error: %s", err)
+	}
+	if g.Capacity() != 100 || g.FalsePositiveRate() != 0.01 || g.Len() != 2 || string(g.Data) != "MISP indicators" {
+		t.Errorf("ReadBloomFilter returned %+v", g)
+	}
+	if !g.CheckString("foo.example") || !g.CheckString("d41d8cd98f00b204e9800998ecf8427e") || g.CheckString("bar.example") {
+		t.Errorf("Read filter does not match the written one")
+	}
+
+	for _, invalid := range [][]byte{b[:20], b[:100], make([]byte, 48)} {
+		if _, err := ReadBloomFilter(bytes.NewReader(invalid)); err == nil {
+			t.Errorf("ReadBloomFilter accepted %x", invalid)
+		}
+	}
+}
+
+func TestReadBloomFilterDCSO(t *testing.T) {
+	// testdata/test.bloom of github.com/DCSO/bloom v0.2.4 (BSD licensed),
+	// the filter of foo, bar and baz
+	golden, err := ioutil.ReadFile("testdata/dcso.bloom")
+	if err != nil {
+		t.Fatalf("Could not read golden filter: %s", err)
+	}
+
+	f, err := ReadBloomFilter(bytes.NewReader(golden))
+	if err != nil {
+		t.Fatalf("ReadBloomFilter returned an error: %s", err)
+	}
+	if f.Capacity() != 1000 || f.FalsePositiveRate() != 1e-6 || f.k != 20 || f.m != 28755 || f.Len() != 3 {
+		t.Errorf("ReadBloomFilter returned n=%d p=%g k=%d m=%d N=%d", f.n, f.p, f.k, f.m, f.N)
+	}
+	for _, value := range []string{"foo", "bar", "baz"} {
+		if !f.CheckString(value) {
+			t.Errorf("Filter does not contain %s", value)
+		}
+	}
+	for _, value := range []string{"", "12345"} {
+		if f.CheckString(value) {
+			t.Errorf("Filter contains %q", value)
+		}
+	}
+
+	// The same values give the same filter
+	g, _ := NewBloomFilter(1000, 1e-6)
+	for _, value := range []string{"foo", "bar", "baz"} {
+		g.AddString(value)
+	}
+	var buf bytes.Buffer
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo returned an error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Errorf("WriteTo differs from the DCSO tool")
+	}
+}
+
+func TestBuildBloomFilter(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	mux.HandleFunc("/attributes/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"response": {"Attribute": [
+				{"id": "1", "type": "domain", "value": "foo.example"},
+				{"id": "2", "type": "filename|md5", "value": "evil.exe|d41d8cd98f00b204e9800998ecf8427e"},
+				{"id": "3", "type": "ip-dst", "value": "198.51.100.7", "deleted": true}
+			]}}`)
+		})
+
+	f, err := client.BuildBloomFilter(&AttributeQuery{Tags: "tlp:green"}, 0.0001)
+	if err != nil {
+		t.Fatalf("BuildBloomFilter returned an error: %s", err)
+	}
+	if f.Capacity() != 4 || f.Len() != 4 {
+		t.Errorf("BuildBloomFilter returned a filter of %d values for %d", f.Len(), f.Capacity())
+	}
+	for _, value := range []string{"foo.example", "evil.exe|d41d8cd98f00b204e9800998ecf8427e", "evil.exe", "d41d8cd98f00b204e9800998ecf8427e"} {
+		if !f.CheckString(value) {
+			t.Errorf("Filter does not contain %s", value)
+		}
+	}
+	if f.CheckString("198.51.100.7") {
+		t.Errorf("Filter contains a deleted attribute")
+	}
+}
+
+// limitedWriter fails once limit bytes are written
+type limitedWriter struct {
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, io.ErrShortWrite
+	}
+	w.limit -= len(p)
+
+	return len(p), nil
+}
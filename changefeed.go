@@ -0,0 +1,403 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// DefaultChangeFeedInterval is the delay between two polls of ChangeFeed
+const DefaultChangeFeedInterval = time.Minute
+
+// DefaultChangeFeedPageSize is the number of results asked per search
+const DefaultChangeFeedPageSize = 1000
+
+// ChangeKind is the kind of a change followed by ChangeFeed
+type ChangeKind string
+
+// Kinds of changes
+const (
+	ChangeCreated ChangeKind = "created"
+	ChangeUpdated ChangeKind = "updated"
+	ChangeDeleted ChangeKind = "deleted"
+
+	// ChangeRemoved is sent for the events no longer returned by a
+	// filtered EventQuery: they were deleted, or no longer match it
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// Change is a change of an event or of an attribute. For events, only the
+// metadata is set: the changes of their attributes are sent separately.
+// Deleted and removed events only have their UUID.
+type Change struct {
+	Kind      ChangeKind
+	Event     *Event
+	Attribute *Attribute
+
+	// Timestamp of the element, 0 for deleted events
+	Timestamp int64
+}
+
+// ChangeCursor is the state of a ChangeFeed: the highest timestamps seen,
+// and the elements already known with their timestamp, to tell creations
+// from updates and skip the elements seen by the previous poll.
+//
+// The known elements are never forgotten but on deletion: the cursor, and
+// the file it is saved to, grow with every attribute followed. Compact
+// bounds them, at the cost of some changes.
+type ChangeCursor struct {
+	EventTimestamp     int64            `json:"event_timestamp"`
+	AttributeTimestamp int64            `json:"attribute_timestamp"`
+	Events             map[string]int64 `json:"events"`
+	Attributes         map[string]int64 `json:"attributes"`
+}
+
+// NewChangeCursor returns an empty cursor, following the changes since
+// the given time (the zero time for all of them)
+func NewChangeCursor(since time.Time) *ChangeCursor {
+	c := &ChangeCursor{
+		Events:     make(map[string]int64),
+		Attributes: make(map[string]int64),
+	}
+	if !since.IsZero() {
+		c.EventTimestamp = since.Unix()
+		c.AttributeTimestamp = since.Unix()
+	}
+
+	return c
+}
+
+// LoadChangeCursor reads a cursor saved by Save
+func LoadChangeCursor(path string) (*ChangeCursor, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewChangeCursor(time.Time{})
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("Could not decode cursor %s: %s", path, err)
+	}
+	if c.Events == nil {
+		c.Events = make(map[string]int64)
+	}
+	if c.Attributes == nil {
+		c.Attributes = make(map[string]int64)
+	}
+
+	return c, nil
+}
+
+// Compact forgets the events and attributes last changed before the given
+// time, those at the highest timestamps seen being kept to skip them at
+// the next poll. The later updates of the forgotten elements are reported
+// as creations, and the deletions of the attributes are not reported.
+func (c *ChangeCursor) Compact(before time.Time) {
+	limit := before.Unix()
+
+	for uuid, ts := range c.Events {
+		if ts < limit && ts < c.EventTimestamp {
+			delete(c.Events, uuid)
+		}
+	}
+	for uuid, ts := range c.Attributes {
+		if ts < limit && ts < c.AttributeTimestamp {
+			delete(c.Attributes, uuid)
+		}
+	}
+}
+
+// Save writes the cursor to path, replacing the previous file atomically
+func (c *ChangeCursor) Save(path string) error {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, buf)
+}
+
+// ChangeFeed follows the changes of a MISP server by polling restSearch
+// with the highest timestamp seen, for installs without ZeroMQ.
+//
+// Soft deleted attributes are reported as deleted. Events do not leave
+// such traces: their deletions are only found by listing all the events,
+// when CheckDeletedEvents is set, and are never reported otherwise. With
+// a filtered EventQuery, a missing event cannot be told from one which no
+// longer matches it, and is reported as removed rather than deleted.
+//
+// Only the deletions of the attributes seen by the feed are reported:
+// those created before the time the cursor started from are unknown to
+// it, and their deletions are skipped. Attributes which no longer match
+// AttributeQuery are not reported at all.
+//
+// The cursor is saved after each poll, once its changes are delivered: a
+// feed resumed from the file does not miss nor repeat changes, except
+// those of a poll interrupted by a crash, which are sent again.
+type ChangeFeed struct {
+	Client *Client
+
+	// Cursor is the current state, a new cursor following all the changes
+	// when nil and CursorFile does not exist yet
+	Cursor *ChangeCursor
+
+	// CursorFile is where the cursor is loaded from and saved to, when set
+	CursorFile string
+
+	// Interval between polls, DefaultChangeFeedInterval when zero
+	Interval time.Duration
+
+	// PageSize of the searches, DefaultChangeFeedPageSize when zero
+	PageSize int
+
+	// CheckDeletedEvents lists the events at each poll to find the deleted
+	// ones
+	CheckDeletedEvents bool
+
+	// EventQuery and AttributeQuery restrict the followed elements, their
+	// Timestamp, Deleted and pagination fields being set by the feed
+	EventQuery     EventQuery
+	AttributeQuery AttributeQuery
+}
+
+// Run polls the server until ctx is done, sending the changes on ch. It
+// returns ctx.Err(), or the first error of a poll.
+func (f *ChangeFeed) Run(ctx context.Context, ch chan<- Change) error {
+	interval := f.Interval
+	if interval == 0 {
+		interval = DefaultChangeFeedInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Poll(ctx, ch); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *ChangeFeed) load() error {
+	if f.Cursor != nil {
+		return nil
+	}
+
+	if f.CursorFile != "" {
+		c, err := LoadChangeCursor(f.CursorFile)
+		if err == nil {
+			f.Cursor = c
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	f.Cursor = NewChangeCursor(time.Time{})
+	return nil
+}
+
+func (f *ChangeFeed) pageSize() int {
+	if f.PageSize == 0 {
+		return DefaultChangeFeedPageSize
+	}
+
+	return f.PageSize
+}
+
+// Poll sends the changes since the previous poll on ch, and saves the
+// cursor
+func (f *ChangeFeed) Poll(ctx context.Context, ch chan<- Change) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	send := func(c Change) error {
+		select {
+		case ch <- c:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := f.pollEvents(ctx, send); err != nil {
+		return err
+	}
+	if err := f.pollAttributes(ctx, send); err != nil {
+		return err
+	}
+	if f.CheckDeletedEvents {
+		if err := f.pollDeletedEvents(ctx, send); err != nil {
+			return err
+		}
+	}
+
+	if f.CursorFile != "" {
+		return f.Cursor.Save(f.CursorFile)
+	}
+
+	return nil
+}
+
+func numberToInt64(n json.Number) int64 {
+	i, _ := strconv.ParseInt(string(n), 10, 64)
+	return i
+}
+
+func (f *ChangeFeed) searchEvents(ctx context.Context, q EventQuery, fn func(*Event) error) error {
+	q.MetaData = "1"
+	q.Limit = f.pageSize()
+
+	for q.Page = 1; ; q.Page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		events, err := f.Client.SearchEvent(&q)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			if err := fn(&events[i]); err != nil {
+				return err
+			}
+		}
+		if len(events) < q.Limit {
+			return nil
+		}
+	}
+}
+
+func (f *ChangeFeed) pollEvents(ctx context.Context, send func(Change) error) error {
+	c := f.Cursor
+
+	q := f.EventQuery
+	q.Timestamp = strconv.FormatInt(c.EventTimestamp, 10)
+
+	// The search is inclusive: the events of the previous poll with the
+	// highest timestamp are returned again, and skipped
+	return f.searchEvents(ctx, q, func(event *Event) error {
+		ts := numberToInt64(event.Timestamp)
+		known, ok := c.Events[event.UUID]
+		if ok && known >= ts {
+			return nil
+		}
+
+		kind := ChangeCreated
+		if ok {
+			kind = ChangeUpdated
+		}
+		if err := send(Change{Kind: kind, Event: event, Timestamp: ts}); err != nil {
+			return err
+		}
+
+		// The cursor only moves past delivered changes
+		c.Events[event.UUID] = ts
+		if ts > c.EventTimestamp {
+			c.EventTimestamp = ts
+		}
+		return nil
+	})
+}
+
+func (f *ChangeFeed) pollAttributes(ctx context.Context, send func(Change) error) error {
+	c := f.Cursor
+
+	q := f.AttributeQuery
+	q.Timestamp = strconv.FormatInt(c.AttributeTimestamp, 10)
+	q.Deleted = []int{0, 1}
+	q.Limit = f.pageSize()
+
+	for q.Page = 1; ; q.Page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		attrs, err := f.Client.SearchAttribute(&q)
+		if err != nil {
+			return err
+		}
+
+		for i := range attrs {
+			attr := &attrs[i]
+			ts := numberToInt64(json.Number(attr.Timestamp))
+			known, ok := c.Attributes[attr.UUID]
+
+			var kind ChangeKind
+			switch {
+			case attr.Deleted && !ok:
+				// Never seen, or deletion already sent
+				continue
+			case attr.Deleted:
+				kind = ChangeDeleted
+			case ok && known >= ts:
+				continue
+			case ok:
+				kind = ChangeUpdated
+			default:
+				kind = ChangeCreated
+			}
+
+			if err := send(Change{Kind: kind, Attribute: attr, Timestamp: ts}); err != nil {
+				return err
+			}
+
+			if kind == ChangeDeleted {
+				delete(c.Attributes, attr.UUID)
+			} else {
+				c.Attributes[attr.UUID] = ts
+			}
+			if ts > c.AttributeTimestamp {
+				c.AttributeTimestamp = ts
+			}
+		}
+
+		if len(attrs) < q.Limit {
+			return nil
+		}
+	}
+}
+
+func (f *ChangeFeed) pollDeletedEvents(ctx context.Context, send func(Change) error) error {
+	c := f.Cursor
+
+	present := make(map[string]bool)
+	err := f.searchEvents(ctx, f.EventQuery, func(event *Event) error {
+		present[event.UUID] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Without filter, a missing event can only have been deleted
+	kind := ChangeRemoved
+	if reflect.DeepEqual(f.EventQuery, EventQuery{}) {
+		kind = ChangeDeleted
+	}
+
+	for uuid := range c.Events {
+		if present[uuid] {
+			continue
+		}
+		if err := send(Change{Kind: kind, Event: &Event{UUID: uuid}}); err != nil {
+			return err
+		}
+		delete(c.Events, uuid)
+	}
+
+	return nil
+}
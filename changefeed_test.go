@@ -0,0 +1,284 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// changeFeedTestServer serves restSearch from its events and attributes,
+// honouring the timestamp, deleted and pagination fields
+type changeFeedTestServer struct {
+	events     []Event
+	attributes []Attribute
+	queries    []map[string]interface{}
+}
+
+func (s *changeFeedTestServer) query(r *http.Request) map[string]interface{} {
+	var req struct {
+		Request map[string]interface{} `json:"request"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	s.queries = append(s.queries, req.Request)
+
+	return req.Request
+}
+
+func (s *changeFeedTestServer) page(q map[string]interface{}, n int) (int, int) {
+	limit, _ := q["limit"].(float64)
+	page, _ := q["page"].(float64)
+	if limit == 0 || page == 0 {
+		return 0, n
+	}
+
+	start := int((page - 1) * limit)
+	end := start + int(limit)
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+func (s *changeFeedTestServer) after(q map[string]interface{}, ts json.Number) bool {
+	since, _ := strconv.ParseInt(fmt.Sprint(q["timestamp"]), 10, 64)
+	return q["timestamp"] == nil || numberToInt64(ts) >= since
+}
+
+func (s *changeFeedTestServer) register(t *testing.T) {
+	mux.HandleFunc("/events/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			q := s.query(r)
+
+			if q["metadata"] != "1" {
+				t.Errorf("Event search without metadata: %v", q)
+			}
+
+			var found []eventWrapper
+			for _, event := range s.events {
+				if s.after(q, event.Timestamp) {
+					found = append(found, eventWrapper{Event: event})
+				}
+			}
+			start, end := s.page(q, len(found))
+			json.NewEncoder(w).Encode(map[string]interface{}{"response": found[start:end]})
+		})
+
+	mux.HandleFunc("/attributes/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			q := s.query(r)
+
+			if fmt.Sprint(q["deleted"]) != "[0 1]" {
+				t.Errorf("Attribute search without deleted attributes: %v", q)
+			}
+
+			var found []Attribute
+			for _, attr := range s.attributes {
+				if s.after(q, json.Number(attr.Timestamp)) {
+					found = append(found, attr)
+				}
+			}
+			start, end := s.page(q, len(found))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"response": map[string]interface{}{"Attribute": found[start:end]},
+			})
+		})
+}
+
+func pollChanges(t *testing.T, f *ChangeFeed) []string {
+	ch := make(chan Change, 100)
+	if err := f.Poll(context.Background(), ch); err != nil {
+		t.Fatalf("Poll returned an error: %s", err)
+	}
+	close(ch)
+
+	var changes []string
+	for c := range ch {
+		switch {
+		case c.Event != nil:
+			changes = append(changes, fmt.Sprintf("%s event %s", c.Kind, c.Event.UUID))
+		case c.Attribute != nil:
+			changes = append(changes, fmt.Sprintf("%s attribute %s", c.Kind, c.Attribute.UUID))
+		}
+	}
+
+	return changes
+}
+
+func TestChangeFeed(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	s := &changeFeedTestServer{
+		events: []Event{
+			{UUID: "e1", Info: "Foo", Timestamp: "100"},
+			{UUID: "e2", Info: "Bar", Timestamp: "200"},
+		},
+		attributes: []Attribute{
+			{UUID: "a1", Type: "domain", Value: "foo.example", Timestamp: "100"},
+			{UUID: "a2", Type: "ip-dst", Value: "198.51.100.7", Timestamp: "150"},
+			{UUID: "a3", Type: "url", Value: "http://bar.example/", Timestamp: "200"},
+			{UUID: "a4", Type: "domain", Value: "gone.example", Timestamp: "200", Deleted: true},
+		},
+	}
+	s.register(t)
+
+	cursorFile := filepath.Join(t.TempDir(), "cursor.json")
+	f := &ChangeFeed{Client: client, CursorFile: cursorFile, PageSize: 2}
+
+	got := pollChanges(t, f)
+	want := []string{
+		"created event e1", "created event e2",
+		"created attribute a1", "created attribute a2", "created attribute a3",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("First poll sent %v, want %v", got, want)
+	}
+
+	// Both pages of attributes are asked, from the start
+	last := s.queries[len(s.queries)-1]
+	if last["page"] != float64(3) || last["timestamp"] != "0" {
+		t.Errorf("Last search is %v", last)
+	}
+
+	// Nothing changed: the elements at the cursor timestamp are skipped
+	if got := pollChanges(t, f); len(got) != 0 {
+		t.Errorf("Second poll sent %v", got)
+	}
+	if last := s.queries[len(s.queries)-1]; last["timestamp"] != "200" {
+		t.Errorf("Search after the first poll is %v", last)
+	}
+
+	s.events[0].Timestamp = "300"
+	s.events = append(s.events, Event{UUID: "e3", Timestamp: "300"})
+	s.attributes[2].Timestamp = "300"
+	s.attributes[2].Deleted = true
+	s.attributes[1].Timestamp = "300"
+	s.attributes[1].Comment = "updated"
+
+	// A feed resumed from the saved cursor only sends the new changes
+	f = &ChangeFeed{Client: client, CursorFile: cursorFile}
+	got = pollChanges(t, f)
+	want = []string{
+		"updated event e1", "created event e3",
+		"updated attribute a2", "deleted attribute a3",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Resumed poll sent %v, want %v", got, want)
+	}
+
+	c, err := LoadChangeCursor(cursorFile)
+	if err != nil {
+		t.Fatalf("LoadChangeCursor returned an error: %s", err)
+	}
+	if c.EventTimestamp != 300 || c.AttributeTimestamp != 300 || len(c.Events) != 3 || len(c.Attributes) != 2 {
+		t.Errorf("Saved cursor is %+v", c)
+	}
+}
+
+func TestChangeFeedDeletedEvents(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	s := &changeFeedTestServer{
+		events: []Event{
+			{UUID: "e1", Timestamp: "100"},
+			{UUID: "e2", Timestamp: "200"},
+		},
+	}
+	s.register(t)
+
+	cursor := NewChangeCursor(time.Unix(150, 0))
+	cursor.Events["e1"] = 100
+	f := &ChangeFeed{Client: client, Cursor: cursor, CheckDeletedEvents: true}
+
+	if got := pollChanges(t, f); strings.Join(got, ", ") != "created event e2" {
+		t.Errorf("First poll sent %v", got)
+	}
+
+	s.events = s.events[1:]
+	if got := pollChanges(t, f); strings.Join(got, ", ") != "deleted event e1" {
+		t.Errorf("Poll after the deletion sent %v", got)
+	}
+	if _, ok := cursor.Events["e1"]; ok {
+		t.Errorf("Deleted event is still in the cursor")
+	}
+}
+
+func TestChangeFeedRemovedEvents(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	s := &changeFeedTestServer{
+		events: []Event{
+			{UUID: "e1", Timestamp: "100"},
+			{UUID: "e2", Timestamp: "200"},
+		},
+	}
+	s.register(t)
+
+	f := &ChangeFeed{Client: client, CheckDeletedEvents: true, EventQuery: EventQuery{Tags: "tlp:white"}}
+	if got := pollChanges(t, f); strings.Join(got, ", ") != "created event e1, created event e2" {
+		t.Errorf("First poll sent %v", got)
+	}
+
+	// Deleted or untagged, the filtered search cannot tell
+	s.events = s.events[1:]
+	if got := pollChanges(t, f); strings.Join(got, ", ") != "removed event e1" {
+		t.Errorf("Poll after the removal sent %v", got)
+	}
+	if _, ok := f.Cursor.Events["e1"]; ok {
+		t.Errorf("Removed event is still in the cursor")
+	}
+}
+
+func TestChangeFeedCanceled(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	s := &changeFeedTestServer{events: []Event{{UUID: "e1", Timestamp: "100"}}}
+	s.register(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Undelivered changes do not move the cursor
+	f := &ChangeFeed{Client: client}
+	if err := f.Run(ctx, make(chan Change)); err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	if len(f.Cursor.Events) != 0 || f.Cursor.EventTimestamp != 0 {
+		t.Errorf("Cursor moved to %+v", f.Cursor)
+	}
+}
+
+func TestChangeCursorCompact(t *testing.T) {
+	c := NewChangeCursor(time.Time{})
+	c.EventTimestamp, c.AttributeTimestamp = 300, 200
+	c.Events = map[string]int64{"e1": 100, "e2": 300}
+	c.Attributes = map[string]int64{"a1": 100, "a2": 150, "a3": 200}
+
+	c.Compact(time.Unix(1000, 0))
+	if len(c.Events) != 1 || c.Events["e2"] != 300 {
+		t.Errorf("Compact kept the events %v", c.Events)
+	}
+	if len(c.Attributes) != 1 || c.Attributes["a3"] != 200 {
+		t.Errorf("Compact kept the attributes %v", c.Attributes)
+	}
+
+	c.Attributes["a4"] = 120
+	c.Compact(time.Unix(110, 0))
+	if _, ok := c.Attributes["a4"]; !ok {
+		t.Errorf("Compact dropped an attribute changed after the limit")
+	}
+}
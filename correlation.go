@@ -0,0 +1,365 @@
+package misp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RelatedEvent is an event sharing at least one value with another event
+type RelatedEvent struct {
+	Event Event `json:"Event"`
+}
+
+// RelatedAttribute is an attribute of another event with the same value
+type RelatedAttribute struct {
+	ID       string `json:"id,omitempty"`
+	EventID  string `json:"event_id,omitempty"`
+	ObjectID string `json:"object_id,omitempty"`
+	OrgID    string `json:"org_id,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Info     string `json:"info,omitempty"` // info of the event
+}
+
+// GetEvent returns an event with its attributes, objects and correlations
+func (client *Client) GetEvent(eventID string) (*Event, error) {
+	var resp eventWrapper
+	if err := client.call("GET", fmt.Sprintf("/events/view/%s", eventID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Event, nil
+}
+
+// GetEventCorrelations returns the events correlating with an event. Only
+// their metadata is filled.
+func (client *Client) GetEventCorrelations(eventID string) ([]Event, error) {
+	event, err := client.GetEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, len(event.RelatedEvent))
+	for i := range event.RelatedEvent {
+		events[i] = event.RelatedEvent[i].Event
+	}
+
+	return events, nil
+}
+
+// GetAttributeCorrelations returns the attributes of other events having the
+// same value as the attribute with the given UUID
+func (client *Client) GetAttributeCorrelations(attributeUUID string) ([]RelatedAttribute, error) {
+	attrs, err := client.SearchAttribute(&AttributeQuery{UUID: attributeUUID, IncludeCorrelations: "1"})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("attribute %s not found", attributeUUID)
+	}
+
+	return attrs[0].RelatedAttribute, nil
+}
+
+// CorrelationExclusion is a value never correlated by the server
+type CorrelationExclusion struct {
+	ID       string `json:"id,omitempty"`
+	Value    string `json:"value,omitempty"`
+	FromJSON bool   `json:"from_json,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type correlationExclusionWrapper struct {
+	CorrelationExclusion CorrelationExclusion `json:"CorrelationExclusion"`
+}
+
+// ListCorrelationExclusions returns the values excluded from correlation
+func (client *Client) ListCorrelationExclusions() ([]CorrelationExclusion, error) {
+	var resp []correlationExclusionWrapper
+	if err := client.call("GET", "/correlation_exclusions/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]CorrelationExclusion, len(resp))
+	for i := range resp {
+		exclusions[i] = resp[i].CorrelationExclusion
+	}
+
+	return exclusions, nil
+}
+
+// AddCorrelationExclusion excludes a value from correlation
+func (client *Client) AddCorrelationExclusion(value, comment string) (*CorrelationExclusion, error) {
+	req := &CorrelationExclusion{Value: value, Comment: comment}
+
+	var resp correlationExclusionWrapper
+	if err := client.call("POST", "/correlation_exclusions/add", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.CorrelationExclusion, nil
+}
+
+// DeleteCorrelationExclusion removes a value from the exclusion list
+func (client *Client) DeleteCorrelationExclusion(exclusionID string) error {
+	return client.postAction(fmt.Sprintf("/correlation_exclusions/delete/%s", exclusionID), nil)
+}
+
+// Kinds of nodes of a CorrelationGraph
+const (
+	GraphNodeEvent = "event"
+	GraphNodeValue = "value"
+)
+
+// GraphNode is an event or a value of a CorrelationGraph
+type GraphNode struct {
+	// ID is "event:<event id>" or "value:<value>"
+	ID   string
+	Kind string
+
+	// Depth is the number of correlation hops from the seed
+	Depth int
+
+	// Metadata of event nodes, without attributes and objects. Events at
+	// the edge of the graph are not fetched, only their ID and info are set.
+	Event *Event
+
+	// Value of value nodes
+	Value string
+}
+
+// GraphEdge links an event to a value found in its attributes
+type GraphEdge struct {
+	From string // event node
+	To   string // value node
+
+	AttributeID string
+	Type        string
+}
+
+// CorrelationGraph is a bipartite graph of events and the values they
+// share
+type CorrelationGraph struct {
+	Nodes map[string]*GraphNode
+	Edges []GraphEdge
+
+	edges map[[2]string]bool
+}
+
+func newCorrelationGraph() *CorrelationGraph {
+	return &CorrelationGraph{
+		Nodes: make(map[string]*GraphNode),
+		edges: make(map[[2]string]bool),
+	}
+}
+
+func eventNodeID(eventID string) string {
+	return GraphNodeEvent + ":" + eventID
+}
+
+func valueNodeID(value string) string {
+	return GraphNodeValue + ":" + value
+}
+
+// node returns the node with the given ID, added at depth if missing
+func (g *CorrelationGraph) node(id, kind string, depth int) *GraphNode {
+	n, ok := g.Nodes[id]
+	if !ok {
+		n = &GraphNode{ID: id, Kind: kind, Depth: depth}
+		g.Nodes[id] = n
+	} else if depth < n.Depth {
+		n.Depth = depth
+	}
+
+	return n
+}
+
+func (g *CorrelationGraph) addEdge(from, to, attributeID, attrType string) {
+	key := [2]string{from, to}
+	if g.edges[key] {
+		return
+	}
+
+	g.edges[key] = true
+	g.Edges = append(g.Edges, GraphEdge{From: from, To: to, AttributeID: attributeID, Type: attrType})
+}
+
+// Neighbours returns the IDs of the nodes linked to a node, sorted
+func (g *CorrelationGraph) Neighbours(nodeID string) []string {
+	var ids []string
+	for _, e := range g.Edges {
+		switch nodeID {
+		case e.From:
+			ids = append(ids, e.To)
+		case e.To:
+			ids = append(ids, e.From)
+		}
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// RelatedEvents returns the IDs of the event nodes sharing a value with an
+// event node, sorted
+func (g *CorrelationGraph) RelatedEvents(nodeID string) []string {
+	seen := map[string]bool{nodeID: true}
+
+	var ids []string
+	for _, value := range g.Neighbours(nodeID) {
+		for _, id := range g.Neighbours(value) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// Events returns the event nodes ordered by depth then ID
+func (g *CorrelationGraph) Events() []*GraphNode {
+	var nodes []*GraphNode
+	for _, n := range g.Nodes {
+		if n.Kind == GraphNodeEvent {
+			nodes = append(nodes, n)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes
+}
+
+// GraphBuilder expands a CorrelationGraph from a seed event or value by
+// following the correlations of the server
+type GraphBuilder struct {
+	Client *Client
+
+	// Hops is the maximum number of correlations followed from the seed
+	Hops int
+
+	// MaxEvents stops the expansion once that many events were fetched, no
+	// limit when zero
+	MaxEvents int
+}
+
+type graphVisit struct {
+	eventID string
+	depth   int
+}
+
+// FromEvent builds the graph of the events correlating with an event
+func (b *GraphBuilder) FromEvent(eventID string) (*CorrelationGraph, error) {
+	g := newCorrelationGraph()
+	g.node(eventNodeID(eventID), GraphNodeEvent, 0)
+
+	return g, b.expand(g, []graphVisit{{eventID, 0}})
+}
+
+// FromValue builds the graph of the events having an attribute with the
+// given value, and of the events correlating with them
+func (b *GraphBuilder) FromValue(value string) (*CorrelationGraph, error) {
+	attrs, err := b.Client.SearchAttribute(&AttributeQuery{Value: value})
+	if err != nil {
+		return nil, err
+	}
+
+	g := newCorrelationGraph()
+	to := g.node(valueNodeID(value), GraphNodeValue, 0)
+	to.Value = value
+
+	var queue []graphVisit
+	for _, attr := range attrs {
+		from := eventNodeID(attr.EventID)
+		if _, ok := g.Nodes[from]; !ok && b.Hops > 1 {
+			queue = append(queue, graphVisit{attr.EventID, 1})
+		}
+		g.node(from, GraphNodeEvent, 1).Event = &Event{ID: attr.EventID}
+		g.addEdge(from, to.ID, attr.ID, attr.Type)
+	}
+
+	return g, b.expand(g, queue)
+}
+
+// expand fetches the queued events breadth first and adds their
+// correlations to the graph
+func (b *GraphBuilder) expand(g *CorrelationGraph, queue []graphVisit) error {
+	fetched := 0
+	visited := make(map[string]bool)
+
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+
+		if visited[v.eventID] || (b.MaxEvents > 0 && fetched >= b.MaxEvents) {
+			continue
+		}
+		visited[v.eventID] = true
+
+		event, err := b.Client.GetEvent(v.eventID)
+		if err != nil {
+			return err
+		}
+		fetched++
+
+		from := eventNodeID(v.eventID)
+		g.node(from, GraphNodeEvent, v.depth).Event = eventMetadata(event)
+		if v.depth >= b.Hops {
+			continue
+		}
+
+		var attrs []*Attribute
+		for i := range event.Attribute {
+			attrs = append(attrs, &event.Attribute[i])
+		}
+		for i := range event.Object {
+			for j := range event.Object[i].Attribute {
+				attrs = append(attrs, &event.Object[i].Attribute[j])
+			}
+		}
+
+		for _, attr := range attrs {
+			if len(attr.RelatedAttribute) == 0 {
+				continue
+			}
+
+			to := g.node(valueNodeID(attr.Value), GraphNodeValue, v.depth)
+			to.Value = attr.Value
+			g.addEdge(from, to.ID, attr.ID, attr.Type)
+
+			for _, rel := range attr.RelatedAttribute {
+				relID := eventNodeID(rel.EventID)
+				n := g.node(relID, GraphNodeEvent, v.depth+1)
+				if n.Event == nil {
+					n.Event = &Event{ID: rel.EventID, Info: rel.Info}
+				}
+				g.addEdge(relID, to.ID, rel.ID, rel.Type)
+
+				if v.depth+1 < b.Hops && !visited[rel.EventID] {
+					queue = append(queue, graphVisit{rel.EventID, v.depth + 1})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// eventMetadata returns a copy of event without its content
+func eventMetadata(event *Event) *Event {
+	e := *event
+	e.Attribute = nil
+	e.Object = nil
+	e.RelatedEvent = nil
+
+	return &e
+}
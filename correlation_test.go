@@ -0,0 +1,197 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Events 1 and 2 share foobar.com, events 2 and 3 share 198.51.100.7
+var testCorrelatedEvents = map[string]string{
+	"1": `{"Event":{"id":"1","info":"Foobar campaign","RelatedEvent":[{"Event":{"id":"2","info":"Foobar infrastructure","uuid":"5e1f4f1a-0002-4a1e-9fba-5b2a0a3ac101"}}],
+		"Attribute":[{"id":"10","type":"domain","value":"foobar.com","RelatedAttribute":[{"id":"20","event_id":"2","org_id":"1","value":"foobar.com","info":"Foobar infrastructure"}]},{"id":"11","type":"md5","value":"68b329da9893e34099c7d8ad5cb9c940"}]}}`,
+	"2": `{"Event":{"id":"2","info":"Foobar infrastructure",
+		"Attribute":[{"id":"20","type":"domain","value":"foobar.com","RelatedAttribute":[{"id":"10","event_id":"1","value":"foobar.com","info":"Foobar campaign"}]}],
+		"Object":[{"name":"domain-ip","Attribute":[{"id":"21","type":"ip-dst","value":"198.51.100.7","RelatedAttribute":[{"id":"30","event_id":"3","value":"198.51.100.7","info":"Scanning"}]}]}]}}`,
+	"3": `{"Event":{"id":"3","info":"Scanning",
+		"Attribute":[{"id":"30","type":"ip-src","value":"198.51.100.7","RelatedAttribute":[{"id":"21","event_id":"2","value":"198.51.100.7","info":"Foobar infrastructure"}]}]}}`,
+}
+
+func handleCorrelatedEvents(t *testing.T, fetched map[string]int) {
+	for id, body := range testCorrelatedEvents {
+		id, body := id, body
+		mux.HandleFunc("/events/view/"+id,
+			func(w http.ResponseWriter, r *http.Request) {
+				testMethod(t, r, "GET")
+				fetched[id]++
+				fmt.Fprint(w, body)
+			})
+	}
+}
+
+func TestGetEventCorrelations(t *testing.T) {
+	setup()
+	handleCorrelatedEvents(t, make(map[string]int))
+
+	events, err := client.GetEventCorrelations("1")
+	if err != nil {
+		t.Fatalf("GetEventCorrelations returned an error: %s", err)
+	}
+
+	if len(events) != 1 || events[0].ID != "2" || events[0].Info != "Foobar infrastructure" {
+		t.Errorf("GetEventCorrelations returned %+v", events)
+	}
+}
+
+func TestGetAttributeCorrelations(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req struct {
+				Request AttributeQuery `json:"request"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Cannot decode json AttributeQuery request: %s", err)
+			}
+			if req.Request.IncludeCorrelations != "1" || req.Request.UUID != "5e1f4f1b-0010-4a1e-9fba-5b2a0a3ac101" {
+				t.Errorf("Unexpected search request: %+v", req.Request)
+			}
+
+			fmt.Fprint(w, `{"response":{"Attribute":[{"id":"10","event_id":"1","type":"domain","value":"foobar.com","RelatedAttribute":[{"id":"20","event_id":"2","value":"foobar.com"}]}]}}`)
+		})
+
+	related, err := client.GetAttributeCorrelations("5e1f4f1b-0010-4a1e-9fba-5b2a0a3ac101")
+	if err != nil {
+		t.Fatalf("GetAttributeCorrelations returned an error: %s", err)
+	}
+
+	if len(related) != 1 || related[0].EventID != "2" {
+		t.Errorf("GetAttributeCorrelations returned %+v", related)
+	}
+}
+
+func TestCorrelationExclusions(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/correlation_exclusions/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[{"CorrelationExclusion":{"id":"1","value":"8.8.8.8","from_json":false,"comment":"Google DNS"}}]`)
+		})
+	mux.HandleFunc("/correlation_exclusions/add",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got CorrelationExclusion
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json CorrelationExclusion request: %s", err)
+			}
+			if got.Value != "1.1.1.1" {
+				t.Errorf("Unexpected exclusion request: %+v", got)
+			}
+
+			fmt.Fprint(w, `{"CorrelationExclusion":{"id":"2","value":"1.1.1.1","comment":"Cloudflare DNS"}}`)
+		})
+	mux.HandleFunc("/correlation_exclusions/delete/2",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":true,"name":"Correlation exclusion deleted.","message":"Correlation exclusion deleted.","url":"\/correlation_exclusions\/delete\/2"}`)
+		})
+
+	exclusions, err := client.ListCorrelationExclusions()
+	if err != nil {
+		t.Fatalf("ListCorrelationExclusions returned an error: %s", err)
+	}
+	if len(exclusions) != 1 || exclusions[0].Value != "8.8.8.8" {
+		t.Errorf("ListCorrelationExclusions returned %+v", exclusions)
+	}
+
+	exclusion, err := client.AddCorrelationExclusion("1.1.1.1", "Cloudflare DNS")
+	if err != nil {
+		t.Fatalf("AddCorrelationExclusion returned an error: %s", err)
+	}
+	if exclusion.ID != "2" {
+		t.Errorf("AddCorrelationExclusion returned %+v", exclusion)
+	}
+
+	if err := client.DeleteCorrelationExclusion("2"); err != nil {
+		t.Errorf("DeleteCorrelationExclusion returned an error: %s", err)
+	}
+}
+
+func TestGraphBuilder_FromEvent(t *testing.T) {
+	setup()
+
+	fetched := make(map[string]int)
+	handleCorrelatedEvents(t, fetched)
+
+	b := &GraphBuilder{Client: client, Hops: 1}
+	g, err := b.FromEvent("1")
+	if err != nil {
+		t.Fatalf("FromEvent returned an error: %s", err)
+	}
+
+	if !reflect.DeepEqual(fetched, map[string]int{"1": 1}) {
+		t.Errorf("FromEvent fetched %v", fetched)
+	}
+	if got := g.RelatedEvents("event:1"); !reflect.DeepEqual(got, []string{"event:2"}) {
+		t.Errorf("RelatedEvents returned %v", got)
+	}
+	if n := g.Nodes["event:2"]; n.Depth != 1 || n.Event.Info != "Foobar infrastructure" {
+		t.Errorf("Edge node is %+v", n)
+	}
+	if _, ok := g.Nodes["value:68b329da9893e34099c7d8ad5cb9c940"]; ok {
+		t.Errorf("Uncorrelated value was added to the graph")
+	}
+
+	b.Hops = 2
+	if g, err = b.FromEvent("1"); err != nil {
+		t.Fatalf("FromEvent returned an error: %s", err)
+	}
+
+	var events []string
+	for _, n := range g.Events() {
+		events = append(events, fmt.Sprintf("%s@%d", n.ID, n.Depth))
+	}
+	if !reflect.DeepEqual(events, []string{"event:1@0", "event:2@1", "event:3@2"}) {
+		t.Errorf("Events returned %v", events)
+	}
+	if got := g.Neighbours("value:198.51.100.7"); !reflect.DeepEqual(got, []string{"event:2", "event:3"}) {
+		t.Errorf("Neighbours returned %v", got)
+	}
+	if len(g.Edges) != 4 {
+		t.Errorf("Graph has %d edges, want 4: %+v", len(g.Edges), g.Edges)
+	}
+}
+
+func TestGraphBuilder_FromValue(t *testing.T) {
+	setup()
+
+	fetched := make(map[string]int)
+	handleCorrelatedEvents(t, fetched)
+	mux.HandleFunc("/attributes/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"response":{"Attribute":[{"id":"21","event_id":"2","type":"ip-dst","value":"198.51.100.7"},{"id":"30","event_id":"3","type":"ip-src","value":"198.51.100.7"}]}}`)
+		})
+
+	b := &GraphBuilder{Client: client, Hops: 2, MaxEvents: 10}
+	g, err := b.FromValue("198.51.100.7")
+	if err != nil {
+		t.Fatalf("FromValue returned an error: %s", err)
+	}
+
+	if !reflect.DeepEqual(fetched, map[string]int{"2": 1, "3": 1}) {
+		t.Errorf("FromValue fetched %v", fetched)
+	}
+	if n := g.Nodes["event:1"]; n == nil || n.Depth != 2 {
+		t.Errorf("Correlated event node is %+v", n)
+	}
+	if got := g.RelatedEvents("event:2"); !reflect.DeepEqual(got, []string{"event:1", "event:3"}) {
+		t.Errorf("RelatedEvents returned %v", got)
+	}
+}
@@ -0,0 +1,336 @@
+package misp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CSVColumn is an attribute field stored in a CSV column
+type CSVColumn string
+
+// Columns of the CSV codec. CSVIgnore skips a column on import and writes
+// an empty one on export.
+const (
+	CSVIgnore    CSVColumn = ""
+	CSVValue     CSVColumn = "value"
+	CSVType      CSVColumn = "type"
+	CSVCategory  CSVColumn = "category"
+	CSVToIDS     CSVColumn = "to_ids"
+	CSVComment   CSVColumn = "comment"
+	CSVTags      CSVColumn = "tags"
+	CSVFirstSeen CSVColumn = "first_seen"
+)
+
+// DefaultCSVColumns is the column layout used when none is configured
+var DefaultCSVColumns = []CSVColumn{CSVValue, CSVType, CSVCategory, CSVToIDS, CSVComment, CSVTags, CSVFirstSeen}
+
+// csvHeaderNames maps the names found in headers, in lower case, to the
+// columns. The names used by the CSV export of MISP are included.
+var csvHeaderNames = map[string]CSVColumn{
+	"value":         CSVValue,
+	"type":          CSVType,
+	"category":      CSVCategory,
+	"to_ids":        CSVToIDS,
+	"to ids":        CSVToIDS,
+	"ids":           CSVToIDS,
+	"comment":       CSVComment,
+	"tags":          CSVTags,
+	"tag":           CSVTags,
+	"attribute_tag": CSVTags,
+	"first_seen":    CSVFirstSeen,
+	"first seen":    CSVFirstSeen,
+}
+
+// CSVCodec reads and writes attributes as CSV
+type CSVCodec struct {
+	// Columns of the file, DefaultCSVColumns when empty. On import, a
+	// header naming the value column replaces it.
+	Columns []CSVColumn
+
+	// Field delimiter, ',' when zero
+	Comma rune
+
+	// Separator of the tags of a cell, ',' when empty
+	TagSeparator string
+
+	// Header is written by Encode when set
+	Header bool
+
+	// Values used on import when the file has no such column, or when the
+	// cell is empty
+	DefaultType     string
+	DefaultCategory string
+	DefaultToIDS    bool
+}
+
+// CSVRowError is the reason why a row could not be imported
+type CSVRowError struct {
+	// Number of the record in the file, starting at 1 with the header
+	Row int
+	Err error
+}
+
+func (e *CSVRowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+}
+
+func (c *CSVCodec) columns() []CSVColumn {
+	if len(c.Columns) == 0 {
+		return DefaultCSVColumns
+	}
+
+	return c.Columns
+}
+
+func (c *CSVCodec) tagSeparator() string {
+	if c.TagSeparator == "" {
+		return ","
+	}
+
+	return c.TagSeparator
+}
+
+// parseCSVHeader returns the columns named by record when it is a header,
+// that is when it names the value column
+func parseCSVHeader(record []string) ([]CSVColumn, bool) {
+	columns := make([]CSVColumn, len(record))
+	found := false
+
+	for i, name := range record {
+		columns[i] = csvHeaderNames[strings.ToLower(strings.TrimSpace(name))]
+		if columns[i] == CSVValue {
+			found = true
+		}
+	}
+
+	return columns, found
+}
+
+// Decode reads attributes ready to be added with AddAttributes. Rows which
+// cannot be converted are skipped and reported in the returned row errors;
+// the error is only set when the file cannot be read.
+func (c *CSVCodec) Decode(r io.Reader) ([]Attribute, []*CSVRowError, error) {
+	reader := csv.NewReader(r)
+	if c.Comma != 0 {
+		reader.Comma = c.Comma
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var attrs []Attribute
+	var rowErrors []*CSVRowError
+
+	columns := c.columns()
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The reader goes on with the next record after a parse error
+			if _, ok := err.(*csv.ParseError); ok {
+				rowErrors = append(rowErrors, &CSVRowError{Row: row, Err: err})
+				continue
+			}
+			return attrs, rowErrors, err
+		}
+
+		if row == 1 {
+			if header, ok := parseCSVHeader(record); ok {
+				columns = header
+				continue
+			}
+		}
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		attr, err := c.decodeRecord(columns, record)
+		if err != nil {
+			rowErrors = append(rowErrors, &CSVRowError{Row: row, Err: err})
+			continue
+		}
+		attrs = append(attrs, *attr)
+	}
+
+	return attrs, rowErrors, nil
+}
+
+func (c *CSVCodec) decodeRecord(columns []CSVColumn, record []string) (*Attribute, error) {
+	if len(record) > len(columns) {
+		return nil, fmt.Errorf("%d fields, expected at most %d", len(record), len(columns))
+	}
+
+	attr := &Attribute{
+		Type:     c.DefaultType,
+		Category: c.DefaultCategory,
+		ToIDS:    c.DefaultToIDS,
+	}
+
+	for i, cell := range record {
+		cell = strings.TrimSpace(cell)
+		if cell == "" {
+			continue
+		}
+
+		switch columns[i] {
+		case CSVValue:
+			attr.Value = cell
+		case CSVType:
+			attr.Type = cell
+		case CSVCategory:
+			attr.Category = cell
+		case CSVToIDS:
+			toIDS, err := parseCSVBool(cell)
+			if err != nil {
+				return nil, err
+			}
+			attr.ToIDS = toIDS
+		case CSVComment:
+			attr.Comment = cell
+		case CSVTags:
+			for _, name := range strings.Split(cell, c.tagSeparator()) {
+				if name = strings.TrimSpace(name); name != "" {
+					attr.Tag = append(attr.Tag, Tag{Name: name})
+				}
+			}
+		case CSVFirstSeen:
+			firstSeen, err := parseCSVTime(cell)
+			if err != nil {
+				return nil, err
+			}
+			attr.FirstSeen = firstSeen
+		}
+	}
+
+	if attr.Value == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	if attr.Type == "" {
+		return nil, fmt.Errorf("missing type for %q", attr.Value)
+	}
+
+	return attr, nil
+}
+
+func parseCSVBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "y":
+		return true, nil
+	case "0", "false", "no", "n":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid to_ids %q", s)
+}
+
+// parseCSVTime accepts RFC 3339 timestamps, with or without time zone, and
+// dates
+func parseCSVTime(s string) (string, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339Nano), nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid first_seen %q", s)
+}
+
+// Encode writes attributes with the columns of the codec
+func (c *CSVCodec) Encode(w io.Writer, attrs []Attribute) error {
+	writer := csv.NewWriter(w)
+	if c.Comma != 0 {
+		writer.Comma = c.Comma
+	}
+
+	columns := c.columns()
+	if c.Header {
+		header := make([]string, len(columns))
+		for i, col := range columns {
+			header[i] = string(col)
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, len(columns))
+	for _, attr := range attrs {
+		for i, col := range columns {
+			record[i] = c.encodeField(col, &attr)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (c *CSVCodec) encodeField(col CSVColumn, attr *Attribute) string {
+	switch col {
+	case CSVValue:
+		return attr.Value
+	case CSVType:
+		return attr.Type
+	case CSVCategory:
+		return attr.Category
+	case CSVToIDS:
+		if attr.ToIDS {
+			return "1"
+		}
+		return "0"
+	case CSVComment:
+		return attr.Comment
+	case CSVTags:
+		names := make([]string, len(attr.Tag))
+		for i, tag := range attr.Tag {
+			names[i] = tag.Name
+		}
+		return strings.Join(names, c.tagSeparator())
+	case CSVFirstSeen:
+		return attr.FirstSeen
+	}
+
+	return ""
+}
+
+// ExportAttributesCSV writes the attributes matching the query with the
+// columns of codec. It returns the number of attributes written.
+func (client *Client) ExportAttributesCSV(q *AttributeQuery, codec *CSVCodec, w io.Writer) (int, error) {
+	attrs, err := client.SearchAttribute(q)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(attrs), codec.Encode(w, attrs)
+}
+
+// AddAttributes adds several attributes to an event in one request
+func (client *Client) AddAttributes(eventID string, attrs []Attribute) ([]Attribute, error) {
+	for _, attr := range attrs {
+		if err := checkDistribution(attr.Distribution, attr.SharingGroupID, true); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp struct {
+		Attribute []Attribute     `json:"Attribute"`
+		Errors    json.RawMessage `json:"errors"`
+	}
+	if err := client.call("POST", fmt.Sprintf("/attributes/add/%s", eventID), attrs, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Errors) > 0 && string(resp.Errors) != "null" && string(resp.Errors) != "[]" {
+		return resp.Attribute, fmt.Errorf("MISP returned an error: %s", resp.Errors)
+	}
+
+	return resp.Attribute, nil
+}
@@ -0,0 +1,134 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVCodecDecode(t *testing.T) {
+	input := "Value;Type;IDS;Tags;First seen;Notes\n" +
+		"foobar.com;domain;yes;tlp:green,osint;2020-01-15;ignored\n" +
+		"198.51.100.7;;0;;;\n" +
+		"\n" +
+		"evil.example;hostname;maybe;;;\n" +
+		"x;md5;1;;yesterday;\n" +
+		"a;b;1;;;;;\n"
+
+	codec := &CSVCodec{Comma: ';', DefaultType: "ip-dst", DefaultCategory: "Network activity"}
+	attrs, rowErrors, err := codec.Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode returned an error: %s", err)
+	}
+
+	want := []Attribute{
+		{Value: "foobar.com", Type: "domain", Category: "Network activity", ToIDS: true, Tag: []Tag{{Name: "tlp:green"}, {Name: "osint"}}, FirstSeen: "2020-01-15T00:00:00Z"},
+		{Value: "198.51.100.7", Type: "ip-dst", Category: "Network activity"},
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("Decode returned %+v, want %+v", attrs, want)
+	}
+
+	var rows []int
+	for _, e := range rowErrors {
+		rows = append(rows, e.Row)
+	}
+	if !reflect.DeepEqual(rows, []int{4, 5, 6}) {
+		t.Errorf("Decode reported errors %v", rowErrors)
+	}
+	if !strings.Contains(rowErrors[0].Error(), `invalid to_ids "maybe"`) {
+		t.Errorf("Row error is %s", rowErrors[0])
+	}
+}
+
+func TestCSVCodecWithoutHeader(t *testing.T) {
+	codec := &CSVCodec{Columns: []CSVColumn{CSVType, CSVValue, CSVIgnore}}
+	attrs, rowErrors, err := codec.Decode(strings.NewReader("sha256,e3b0c442,foo\nurl,\"http://a/b,c\"\nmd5,\"broken\n"))
+	if err != nil {
+		t.Fatalf("Decode returned an error: %s", err)
+	}
+	if len(attrs) != 2 || attrs[0].Type != "sha256" || attrs[1].Value != "http://a/b,c" {
+		t.Errorf("Decode returned %+v", attrs)
+	}
+	if len(rowErrors) != 1 || rowErrors[0].Row != 3 {
+		t.Errorf("Decode reported errors %v", rowErrors)
+	}
+}
+
+func TestCSVCodecRoundTrip(t *testing.T) {
+	attrs := []Attribute{
+		{Value: "foobar.com", Type: "domain", Category: "Network activity", ToIDS: true, Comment: "C2, \"main\"", Tag: []Tag{{Name: "tlp:amber"}}, FirstSeen: "2020-01-15T10:00:00Z"},
+		{Value: "68b329da9893e34099c7d8ad5cb9c940", Type: "md5", Category: "Payload delivery"},
+	}
+
+	codec := &CSVCodec{Header: true, TagSeparator: "|", DefaultToIDS: true}
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, attrs); err != nil {
+		t.Fatalf("Encode returned an error: %s", err)
+	}
+	if !strings.HasPrefix(buf.String(), "value,type,category,to_ids,comment,tags,first_seen\n") {
+		t.Errorf("Encode wrote %q", buf.String())
+	}
+
+	decoded, rowErrors, err := codec.Decode(&buf)
+	if err != nil || len(rowErrors) > 0 {
+		t.Fatalf("Decode returned %v %v", err, rowErrors)
+	}
+	if !reflect.DeepEqual(decoded, attrs) {
+		t.Errorf("Decode returned %+v, want %+v", decoded, attrs)
+	}
+}
+
+func TestExportAttributesCSV(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"response": {"Attribute": [{"id": "1", "type": "domain", "category": "Network activity", "value": "foobar.com", "to_ids": true, "Tag": [{"name": "tlp:green"}]}]}}`)
+		})
+
+	codec := &CSVCodec{Columns: []CSVColumn{CSVValue, CSVTags}}
+	var buf bytes.Buffer
+	n, err := client.ExportAttributesCSV(&AttributeQuery{Type: "domain"}, codec, &buf)
+	if err != nil {
+		t.Fatalf("ExportAttributesCSV returned an error: %s", err)
+	}
+	if n != 1 || buf.String() != "foobar.com,tlp:green\n" {
+		t.Errorf("ExportAttributesCSV wrote %d attributes: %q", n, buf.String())
+	}
+}
+
+func TestAddAttributes(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/add/12",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req []Attribute
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Cannot decode json attributes: %s", err)
+			}
+			if len(req) != 2 || req[1].Value != "198.51.100.7" {
+				t.Errorf("Unexpected attributes: %+v", req)
+			}
+
+			fmt.Fprint(w, `{"Attribute": [{"id": "101", "event_id": "12", "type": "domain", "value": "foobar.com"}, {"id": "102", "event_id": "12", "type": "ip-dst", "value": "198.51.100.7"}]}`)
+		})
+
+	attrs, err := client.AddAttributes("12", []Attribute{
+		{Type: "domain", Value: "foobar.com"},
+		{Type: "ip-dst", Value: "198.51.100.7"},
+	})
+	if err != nil {
+		t.Fatalf("AddAttributes returned an error: %s", err)
+	}
+	if len(attrs) != 2 || attrs[1].ID != "102" {
+		t.Errorf("AddAttributes returned %+v", attrs)
+	}
+}
@@ -0,0 +1,213 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Distribution defines who can see an event, object or attribute. The
+// server encodes it either as a string or as an integer, both are accepted
+// when decoding. An empty Distribution means unset.
+type Distribution string
+
+// Distribution levels
+const (
+	DistributionYourOrgOnly          Distribution = "0"
+	DistributionThisCommunityOnly    Distribution = "1"
+	DistributionConnectedCommunities Distribution = "2"
+	DistributionAllCommunities       Distribution = "3"
+	DistributionSharingGroup         Distribution = "4"
+	DistributionInherit              Distribution = "5"
+)
+
+var distributionNames = map[Distribution]string{
+	DistributionYourOrgOnly:          "Your organisation only",
+	DistributionThisCommunityOnly:    "This community only",
+	DistributionConnectedCommunities: "Connected communities",
+	DistributionAllCommunities:       "All communities",
+	DistributionSharingGroup:         "Sharing group",
+	DistributionInherit:              "Inherit event",
+}
+
+// String returns the name of the distribution level as displayed by MISP
+func (d Distribution) String() string {
+	if name, ok := distributionNames[d]; ok {
+		return name
+	}
+
+	return string(d)
+}
+
+// Valid tells if d is a known distribution level
+func (d Distribution) Valid() bool {
+	_, ok := distributionNames[d]
+	return ok
+}
+
+// UnmarshalJSON accepts both strings and integers
+func (d *Distribution) UnmarshalJSON(data []byte) error {
+	s, err := unmarshalEnum(data)
+	*d = Distribution(s)
+	return err
+}
+
+// ThreatLevel is the threat level of an event
+type ThreatLevel string
+
+// Threat levels
+const (
+	ThreatLevelHigh      ThreatLevel = "1"
+	ThreatLevelMedium    ThreatLevel = "2"
+	ThreatLevelLow       ThreatLevel = "3"
+	ThreatLevelUndefined ThreatLevel = "4"
+)
+
+var threatLevelNames = map[ThreatLevel]string{
+	ThreatLevelHigh:      "High",
+	ThreatLevelMedium:    "Medium",
+	ThreatLevelLow:       "Low",
+	ThreatLevelUndefined: "Undefined",
+}
+
+// String returns the name of the threat level
+func (t ThreatLevel) String() string {
+	if name, ok := threatLevelNames[t]; ok {
+		return name
+	}
+
+	return string(t)
+}
+
+// Valid tells if t is a known threat level
+func (t ThreatLevel) Valid() bool {
+	_, ok := threatLevelNames[t]
+	return ok
+}
+
+// UnmarshalJSON accepts both strings and integers
+func (t *ThreatLevel) UnmarshalJSON(data []byte) error {
+	s, err := unmarshalEnum(data)
+	*t = ThreatLevel(s)
+	return err
+}
+
+// Analysis is the state of the analysis of an event
+type Analysis string
+
+// Analysis states
+const (
+	AnalysisInitial   Analysis = "0"
+	AnalysisOngoing   Analysis = "1"
+	AnalysisCompleted Analysis = "2"
+)
+
+var analysisNames = map[Analysis]string{
+	AnalysisInitial:   "Initial",
+	AnalysisOngoing:   "Ongoing",
+	AnalysisCompleted: "Completed",
+}
+
+// String returns the name of the analysis state
+func (a Analysis) String() string {
+	if name, ok := analysisNames[a]; ok {
+		return name
+	}
+
+	return string(a)
+}
+
+// Valid tells if a is a known analysis state
+func (a Analysis) Valid() bool {
+	_, ok := analysisNames[a]
+	return ok
+}
+
+// UnmarshalJSON accepts both strings and integers
+func (a *Analysis) UnmarshalJSON(data []byte) error {
+	s, err := unmarshalEnum(data)
+	*a = Analysis(s)
+	return err
+}
+
+// SightingType is the kind of a sighting
+type SightingType string
+
+// Sighting types
+const (
+	SightingTypeSighting      SightingType = "0"
+	SightingTypeFalsePositive SightingType = "1"
+	SightingTypeExpiration    SightingType = "2"
+)
+
+var sightingTypeNames = map[SightingType]string{
+	SightingTypeSighting:      "Sighting",
+	SightingTypeFalsePositive: "False positive",
+	SightingTypeExpiration:    "Expiration",
+}
+
+// String returns the name of the sighting type
+func (s SightingType) String() string {
+	if name, ok := sightingTypeNames[s]; ok {
+		return name
+	}
+
+	return string(s)
+}
+
+// Valid tells if s is a known sighting type
+func (s SightingType) Valid() bool {
+	_, ok := sightingTypeNames[s]
+	return ok
+}
+
+// UnmarshalJSON accepts both strings and integers
+func (s *SightingType) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalEnum(data)
+	*s = SightingType(v)
+	return err
+}
+
+// unmarshalEnum decodes a JSON string or integer, null being decoded as an
+// empty string
+func unmarshalEnum(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.Equal(data, []byte("null")) {
+		return "", nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		err := json.Unmarshal(data, &s)
+		return s, err
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return "", err
+	}
+	if _, err := n.Int64(); err != nil {
+		return "", fmt.Errorf("invalid enum value %s", data)
+	}
+
+	return n.String(), nil
+}
+
+// checkDistribution validates the distribution d of an element which can
+// inherit the distribution of its event when allowInherit is set.
+// sharingGroupID is required by the sharing group distribution.
+func checkDistribution(d Distribution, sharingGroupID string, allowInherit bool) error {
+	switch {
+	case d == "":
+		return nil
+	case !d.Valid():
+		return fmt.Errorf("invalid distribution %q", string(d))
+	case d == DistributionInherit && !allowInherit:
+		return fmt.Errorf("distribution %q is not allowed here", d)
+	case d == DistributionSharingGroup && (sharingGroupID == "" || sharingGroupID == "0"):
+		return fmt.Errorf("distribution %q requires a sharing group", d)
+	}
+
+	return nil
+}
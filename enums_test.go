@@ -0,0 +1,99 @@
+package misp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEnumsUnmarshalJSON(t *testing.T) {
+	var event Event
+	err := json.Unmarshal([]byte(`{"distribution":1,"threat_level_id":"2","analysis":0,"Attribute":[{"distribution":"5"},{"distribution":null}]}`), &event)
+	if err != nil {
+		t.Fatalf("Unmarshal returned an error: %s", err)
+	}
+
+	if event.Distribution != DistributionThisCommunityOnly {
+		t.Errorf("Distribution is %q, want %q", string(event.Distribution), string(DistributionThisCommunityOnly))
+	}
+	if event.ThreatLevelID != ThreatLevelMedium {
+		t.Errorf("ThreatLevelID is %q, want %q", string(event.ThreatLevelID), string(ThreatLevelMedium))
+	}
+	if event.Analysis != AnalysisInitial {
+		t.Errorf("Analysis is %q, want %q", string(event.Analysis), string(AnalysisInitial))
+	}
+	if event.Attribute[0].Distribution != DistributionInherit || event.Attribute[1].Distribution != "" {
+		t.Errorf("Attribute distributions are %q and %q", string(event.Attribute[0].Distribution), string(event.Attribute[1].Distribution))
+	}
+
+	var s Sighting
+	if err := json.Unmarshal([]byte(`{"type":1}`), &s); err != nil || s.Type != SightingTypeFalsePositive {
+		t.Errorf("Unmarshal of a sighting returned %+v, %v", s, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"distribution":1.5}`), &event); err == nil {
+		t.Errorf("Unmarshal of a float distribution did not return an error")
+	}
+
+	buf, _ := json.Marshal(Attribute{Distribution: DistributionYourOrgOnly})
+	if string(buf) != `{"distribution":"0"}` {
+		t.Errorf("Marshal returned %s", buf)
+	}
+}
+
+func TestEnumsString(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{DistributionYourOrgOnly.String(), "Your organisation only"},
+		{DistributionInherit.String(), "Inherit event"},
+		{Distribution("42").String(), "42"},
+		{ThreatLevelUndefined.String(), "Undefined"},
+		{AnalysisCompleted.String(), "Completed"},
+		{SightingTypeExpiration.String(), "Expiration"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("String() returned %q, want %q", test.got, test.want)
+		}
+	}
+
+	if Distribution("6").Valid() || !DistributionSharingGroup.Valid() || ThreatLevel("0").Valid() || Analysis("3").Valid() {
+		t.Errorf("Valid() accepted an unknown value or rejected a known one")
+	}
+}
+
+func TestDistributionValidation(t *testing.T) {
+	setup()
+
+	// The server is never reached, no handler is needed
+	_, err := client.UploadSample(&SampleUpload{Distribution: DistributionInherit, Info: "new event"})
+	if err == nil {
+		t.Errorf("UploadSample accepted to inherit the distribution of a new event")
+	}
+
+	_, err = client.AddEvent(&Event{Info: "new event", Distribution: DistributionInherit})
+	if err == nil {
+		t.Errorf("AddEvent accepted to inherit the distribution of a new event")
+	}
+
+	_, err = client.AddFeed(&Feed{Name: "new feed", Distribution: DistributionInherit})
+	if err == nil {
+		t.Errorf("AddFeed accepted to inherit a distribution")
+	}
+
+	_, err = client.EditEventReport(&EventReport{ID: "1", Distribution: "7"})
+	if err == nil {
+		t.Errorf("EditEventReport accepted an invalid distribution")
+	}
+
+	_, err = client.AddAttribute("1234", Attribute{Value: "foobar.com", Type: "domain", Distribution: DistributionSharingGroup})
+	if err == nil {
+		t.Errorf("AddAttribute accepted a sharing group distribution without sharing group")
+	}
+
+	_, err = client.AddAttribute("1234", Attribute{Value: "foobar.com", Type: "domain", Distribution: "7"})
+	if err == nil {
+		t.Errorf("AddAttribute accepted an invalid distribution")
+	}
+}
@@ -0,0 +1,217 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event is a MISP event with its attributes and objects
+type Event struct {
+	ID               string        `json:"id,omitempty"`
+	OrgID            string        `json:"org_id,omitempty"`
+	OrgcID           string        `json:"orgc_id,omitempty"`
+	UUID             string        `json:"uuid,omitempty"`
+	Info             string        `json:"info,omitempty"`
+	Date             string        `json:"date,omitempty"`
+	ThreatLevelID    ThreatLevel   `json:"threat_level_id,omitempty"`
+	Analysis         Analysis      `json:"analysis,omitempty"`
+	Distribution     Distribution  `json:"distribution,omitempty"`
+	SharingGroupID   string        `json:"sharing_group_id,omitempty"`
+	Published        bool          `json:"published,omitempty"`
+	Timestamp        json.Number   `json:"timestamp,omitempty"`
+	PublishTimestamp json.Number   `json:"publish_timestamp,omitempty"`
+	AttributeCount   json.Number   `json:"attribute_count,omitempty"`
+	ExtendsUUID      string        `json:"extends_uuid,omitempty"`
+	Org              *Organisation `json:"Org,omitempty"`
+	Orgc             *Organisation `json:"Orgc,omitempty"`
+	Tag              []Tag         `json:"Tag,omitempty"`
+	Attribute        []Attribute   `json:"Attribute,omitempty"`
+	Object           []Object      `json:"Object,omitempty"`
+	Galaxy           []Galaxy      `json:"Galaxy,omitempty"`
+
+	// Events sharing at least one value with this event, filled by GetEvent
+	RelatedEvent []RelatedEvent `json:"RelatedEvent,omitempty"`
+}
+
+// Object is a MISP object, a group of attributes built from a template
+type Object struct {
+	ID              string            `json:"id,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	MetaCategory    string            `json:"meta-category,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	TemplateUUID    string            `json:"template_uuid,omitempty"`
+	TemplateVersion string            `json:"template_version,omitempty"`
+	EventID         string            `json:"event_id,omitempty"`
+	UUID            string            `json:"uuid,omitempty"`
+	Timestamp       json.Number       `json:"timestamp,omitempty"`
+	Distribution    Distribution      `json:"distribution,omitempty"`
+	SharingGroupID  string            `json:"sharing_group_id,omitempty"`
+	Comment         string            `json:"comment,omitempty"`
+	Deleted         bool              `json:"deleted,omitempty"`
+	FirstSeen       string            `json:"first_seen,omitempty"`
+	LastSeen        string            `json:"last_seen,omitempty"`
+	Attribute       []Attribute       `json:"Attribute,omitempty"`
+	ObjectReference []ObjectReference `json:"ObjectReference,omitempty"`
+}
+
+// ObjectReference links an object to another object or attribute
+type ObjectReference struct {
+	ID               string      `json:"id,omitempty"`
+	UUID             string      `json:"uuid,omitempty"`
+	Timestamp        json.Number `json:"timestamp,omitempty"`
+	ObjectID         string      `json:"object_id,omitempty"`
+	ObjectUUID       string      `json:"object_uuid,omitempty"`
+	ReferencedID     string      `json:"referenced_id,omitempty"`
+	ReferencedUUID   string      `json:"referenced_uuid,omitempty"`
+	RelationshipType string      `json:"relationship_type,omitempty"`
+	Comment          string      `json:"comment,omitempty"`
+	Deleted          bool        `json:"deleted,omitempty"`
+}
+
+// Tag ...
+type Tag struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Colour     string `json:"colour,omitempty"`
+	Exportable bool   `json:"exportable,omitempty"`
+}
+
+// Galaxy is a set of clusters (threat actors, malware, techniques...) of the
+// same kind, attached to events and attributes through tags
+type Galaxy struct {
+	ID            string          `json:"id,omitempty"`
+	UUID          string          `json:"uuid,omitempty"`
+	Name          string          `json:"name,omitempty"`
+	Type          string          `json:"type,omitempty"`
+	Description   string          `json:"description,omitempty"`
+	Namespace     string          `json:"namespace,omitempty"`
+	GalaxyCluster []GalaxyCluster `json:"GalaxyCluster,omitempty"`
+}
+
+// GalaxyCluster is an element of a galaxy, such as a given threat actor
+type GalaxyCluster struct {
+	ID          string   `json:"id,omitempty"`
+	UUID        string   `json:"uuid,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Value       string   `json:"value,omitempty"`
+	TagName     string   `json:"tag_name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+
+	// Meta holds the free-form metadata of the cluster (synonyms,
+	// external_id, refs...), values are mostly lists of strings
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// MetaStrings returns the metadata of the cluster with the given key
+func (c *GalaxyCluster) MetaStrings(key string) []string {
+	switch v := c.Meta[key].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		var out []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	return nil
+}
+
+type eventWrapper struct {
+	Event Event `json:"Event"`
+}
+
+// EventQuery holds the parameters of an event search
+type EventQuery struct {
+	// Search for the given value in the attributes' value field.
+	Value string `json:"value,omitempty"`
+
+	// The attribute type, any valid MISP attribute type is accepted.
+	Type string `json:"type,omitempty"`
+
+	// The attribute category, any valid MISP attribute category is accepted.
+	Category string `json:"category,omitempty"`
+
+	// Search by the creator organisation by supplying the organisation idenfitier.
+	Org string `json:"org,omitempty"`
+
+	// Tags to include, prepend a '!' to exclude a tag, see AttributeQuery.
+	Tags string `json:"tags,omitempty"`
+
+	// Events with the date set after (or before) the one specified
+	// (format: 2015-02-15).
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Events published within the last x amount of time, where x can be
+	// defined in days, hours, minutes (for example 5d or 12h or 30m).
+	Last string `json:"last,omitempty"`
+
+	// Events modified after the given unix timestamp, or within the last x
+	// amount of time (same format as Last).
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// The events that should be included / excluded from the search
+	EventID string `json:"eventid,omitempty"`
+
+	// The event's UUID must match the value(s) passed.
+	UUID string `json:"uuid,omitempty"`
+
+	// Only fetch the published ("1") or unpublished ("0") events
+	Published string `json:"published,omitempty"`
+
+	// Only fetch the event metadata (event data, tags, relations) and skip the attributes
+	MetaData string `json:"metadata,omitempty"`
+
+	// Pagination of the results
+	Limit int `json:"limit,omitempty"`
+	Page  int `json:"page,omitempty"`
+
+	// Output format, only used by ExportEvents. SearchEvent always asks for
+	// JSON.
+	ReturnFormat ReturnFormat `json:"returnFormat,omitempty"`
+}
+
+// SearchEvent returns the events matching the query
+func (client *Client) SearchEvent(q *EventQuery) ([]Event, error) {
+	req := *q
+	req.ReturnFormat = "" // the path asks for JSON
+
+	var outer searchOuterResponse
+	if err := client.call("POST", "/events/restSearch/json/", Request{Request: &req}, &outer); err != nil {
+		return nil, err
+	}
+
+	var wrappers []eventWrapper
+	if err := json.Unmarshal(outer.Response, &wrappers); err != nil {
+		return nil, fmt.Errorf("Inner structure has unknown format")
+	}
+
+	events := make([]Event, len(wrappers))
+	for i, w := range wrappers {
+		events[i] = w.Event
+	}
+
+	return events, nil
+}
+
+// AddEvent creates an event with its attributes and objects
+func (client *Client) AddEvent(event *Event) (*Event, error) {
+	if err := checkDistribution(event.Distribution, event.SharingGroupID, false); err != nil {
+		return nil, err
+	}
+
+	var resp eventWrapper
+	if err := client.call("POST", "/events/add", eventWrapper{Event: *event}, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Event, nil
+}
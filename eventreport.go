@@ -0,0 +1,182 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// EventReport is a narrative write-up attached to an event, in Markdown
+type EventReport struct {
+	ID             string       `json:"id,omitempty"`
+	UUID           string       `json:"uuid,omitempty"`
+	EventID        string       `json:"event_id,omitempty"`
+	Name           string       `json:"name,omitempty"`
+	Content        string       `json:"content,omitempty"`
+	Distribution   Distribution `json:"distribution,omitempty"`
+	SharingGroupID string       `json:"sharing_group_id,omitempty"`
+	Timestamp      json.Number  `json:"timestamp,omitempty"`
+	Deleted        bool         `json:"deleted,omitempty"`
+}
+
+type eventReportWrapper struct {
+	EventReport EventReport `json:"EventReport"`
+}
+
+// AddEventReport attaches a new report to an event. Reports can inherit
+// the distribution of their event.
+func (client *Client) AddEventReport(eventID string, report *EventReport) (*EventReport, error) {
+	if err := checkDistribution(report.Distribution, report.SharingGroupID, true); err != nil {
+		return nil, err
+	}
+
+	return client.eventReportCall("POST", fmt.Sprintf("/eventReports/add/%s", eventID), report)
+}
+
+// EditEventReport updates the report identified by report.ID
+func (client *Client) EditEventReport(report *EventReport) (*EventReport, error) {
+	if err := checkDistribution(report.Distribution, report.SharingGroupID, true); err != nil {
+		return nil, err
+	}
+
+	return client.eventReportCall("POST", fmt.Sprintf("/eventReports/edit/%s", report.ID), report)
+}
+
+// GetEventReport returns the report with the given ID
+func (client *Client) GetEventReport(reportID string) (*EventReport, error) {
+	return client.eventReportCall("GET", fmt.Sprintf("/eventReports/view/%s", reportID), nil)
+}
+
+func (client *Client) eventReportCall(method, path string, req interface{}) (*EventReport, error) {
+	var resp eventReportWrapper
+	if err := client.call(method, path, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.EventReport, nil
+}
+
+// DeleteEventReport deletes a report. Unless hard is set, the report is only
+// flagged as deleted.
+func (client *Client) DeleteEventReport(reportID string, hard bool) error {
+	path := fmt.Sprintf("/eventReports/delete/%s", reportID)
+	if hard {
+		path += "/1"
+	}
+
+	return client.postAction(path, nil)
+}
+
+// ListEventReports returns the reports of an event
+func (client *Client) ListEventReports(eventID string) ([]EventReport, error) {
+	var resp []eventReportWrapper
+	if err := client.call("GET", fmt.Sprintf("/eventReports/index/event_id:%s", eventID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	reports := make([]EventReport, len(resp))
+	for i, r := range resp {
+		reports[i] = r.EventReport
+	}
+
+	return reports, nil
+}
+
+// Scopes of the elements referenced in the Markdown of event reports
+const (
+	ReportScopeAttribute     = "attribute"
+	ReportScopeObject        = "object"
+	ReportScopeTag           = "tag"
+	ReportScopeGalaxyMatrix  = "galaxymatrix"
+	ReportScopeEventGraph    = "eventgraph"
+	ReportScopeAttackMatrix  = "attackmatrix"
+	ReportScopeGalaxyCluster = "galaxycluster"
+)
+
+// ReportReference is a link to an element of the event embedded in the
+// Markdown of a report, such as @[attribute](uuid)
+type ReportReference struct {
+	Scope string
+
+	// UUID of the element, or name for tags
+	ID string
+
+	// Picture is set for the @![attribute](uuid) syntax which displays an
+	// attachment
+	Picture bool
+}
+
+// String returns the Markdown syntax of the reference
+func (ref ReportReference) String() string {
+	bang := ""
+	if ref.Picture {
+		bang = "!"
+	}
+
+	return fmt.Sprintf("@%s[%s](%s)", bang, ref.Scope, ref.ID)
+}
+
+var reportReferenceRegexp = regexp.MustCompile(`@(!?)\[([a-z]+)\]\(([^)\s]+)\)`)
+
+// ExtractReportReferences returns the references found in a Markdown text,
+// in order of appearance
+func ExtractReportReferences(content string) []ReportReference {
+	var refs []ReportReference
+
+	for _, m := range reportReferenceRegexp.FindAllStringSubmatch(content, -1) {
+		refs = append(refs, ReportReference{
+			Scope:   m[2],
+			ID:      m[3],
+			Picture: m[1] == "!",
+		})
+	}
+
+	return refs
+}
+
+// References returns the references found in the content of the report
+func (report *EventReport) References() []ReportReference {
+	return ExtractReportReferences(report.Content)
+}
+
+// MarkdownAttributeReference returns the Markdown reference to an attribute
+func MarkdownAttributeReference(attr *Attribute) string {
+	return ReportReference{Scope: ReportScopeAttribute, ID: attr.UUID}.String()
+}
+
+// MarkdownObjectReference returns the Markdown reference to an object
+func MarkdownObjectReference(obj *Object) string {
+	return ReportReference{Scope: ReportScopeObject, ID: obj.UUID}.String()
+}
+
+// MissingReferences returns the attribute, object and tag references of the
+// report which do not exist in the event
+func (report *EventReport) MissingReferences(event *Event) []ReportReference {
+	known := make(map[string]bool)
+	key := func(scope, id string) string { return scope + "/" + id }
+
+	for _, attr := range event.Attribute {
+		known[key(ReportScopeAttribute, attr.UUID)] = true
+	}
+	for _, obj := range event.Object {
+		known[key(ReportScopeObject, obj.UUID)] = true
+		for _, attr := range obj.Attribute {
+			known[key(ReportScopeAttribute, attr.UUID)] = true
+		}
+	}
+	for _, tag := range event.Tag {
+		known[key(ReportScopeTag, tag.Name)] = true
+	}
+
+	var missing []ReportReference
+	for _, ref := range report.References() {
+		switch ref.Scope {
+		case ReportScopeAttribute, ReportScopeObject, ReportScopeTag:
+			if !known[key(ref.Scope, ref.ID)] {
+				missing = append(missing, ref)
+			}
+		}
+	}
+
+	return missing
+}
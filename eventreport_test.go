@@ -0,0 +1,129 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAddEventReport(t *testing.T) {
+	setup()
+
+	attr := Attribute{UUID: "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101", Type: "domain", Value: "foobar.com"}
+	report := &EventReport{
+		Name:         "Foobar campaign",
+		Content:      "The actor registered " + MarkdownAttributeReference(&attr) + ".",
+		Distribution: "5",
+	}
+
+	mux.HandleFunc("/eventReports/add/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got EventReport
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json EventReport request: %s", err)
+			}
+			if got != *report {
+				t.Errorf("AddEventReport sent %+v, want %+v", got, *report)
+			}
+
+			fmt.Fprint(w, `{"EventReport":{"id":"3","uuid":"5e5f6a7b-0000-4c8e-8f0d-2c4d0a3ac101","event_id":"42","name":"Foobar campaign","content":"The actor registered @[attribute](5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101).","distribution":"5","sharing_group_id":"0","timestamp":"1583250000","deleted":false}}`)
+		})
+
+	newReport, err := client.AddEventReport("42", report)
+	if err != nil {
+		t.Fatalf("AddEventReport returned an error: %s", err)
+	}
+
+	if newReport.ID != "3" || newReport.EventID != "42" || newReport.Content != report.Content {
+		t.Errorf("AddEventReport returned %+v", newReport)
+	}
+}
+
+func TestListEventReports(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/eventReports/index/event_id:42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[{"EventReport":{"id":"3","event_id":"42","name":"Foobar campaign"}},{"EventReport":{"id":"4","event_id":"42","name":"Timeline"}}]`)
+		})
+
+	reports, err := client.ListEventReports("42")
+	if err != nil {
+		t.Fatalf("ListEventReports returned an error: %s", err)
+	}
+
+	if len(reports) != 2 || reports[1].Name != "Timeline" {
+		t.Errorf("ListEventReports returned %+v", reports)
+	}
+}
+
+func TestReportReferences(t *testing.T) {
+	report := &EventReport{
+		Content: "# Summary\n" +
+			"The dropper @[object](5e1f4f1c-2222-4a1e-9fba-5b2a0a3ac101) contacts @[attribute](5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101)\n" +
+			"and @[attribute](5e000000-dead-4a1e-9fba-5b2a0a3ac101), see @![attribute](5e1f4f1b-3333-4a1e-9fba-5b2a0a3ac101).\n" +
+			"Tagged @[tag](tlp:white) and @[tag](tlp:red).",
+	}
+
+	want := []ReportReference{
+		{Scope: ReportScopeObject, ID: "5e1f4f1c-2222-4a1e-9fba-5b2a0a3ac101"},
+		{Scope: ReportScopeAttribute, ID: "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101"},
+		{Scope: ReportScopeAttribute, ID: "5e000000-dead-4a1e-9fba-5b2a0a3ac101"},
+		{Scope: ReportScopeAttribute, ID: "5e1f4f1b-3333-4a1e-9fba-5b2a0a3ac101", Picture: true},
+		{Scope: ReportScopeTag, ID: "tlp:white"},
+		{Scope: ReportScopeTag, ID: "tlp:red"},
+	}
+
+	if got := report.References(); !reflect.DeepEqual(got, want) {
+		t.Errorf("References returned %+v, want %+v", got, want)
+	}
+
+	if want[3].String() != "@![attribute](5e1f4f1b-3333-4a1e-9fba-5b2a0a3ac101)" {
+		t.Errorf("String returned %q", want[3].String())
+	}
+
+	event := &Event{
+		Tag:       []Tag{{Name: "tlp:white"}},
+		Attribute: []Attribute{{UUID: "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101"}},
+		Object: []Object{
+			{
+				UUID:      "5e1f4f1c-2222-4a1e-9fba-5b2a0a3ac101",
+				Attribute: []Attribute{{UUID: "5e1f4f1b-3333-4a1e-9fba-5b2a0a3ac101"}},
+			},
+		},
+	}
+
+	missing := report.MissingReferences(event)
+	if !reflect.DeepEqual(missing, []ReportReference{want[2], want[5]}) {
+		t.Errorf("MissingReferences returned %+v", missing)
+	}
+}
+
+func TestDeleteEventReport(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/eventReports/delete/3/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":true,"name":"Event Report 3 hard deleted","message":"Event Report 3 hard deleted","url":"\/eventReports\/delete\/3"}`)
+		})
+
+	mux.HandleFunc("/eventReports/delete/4",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Event Report 4 could not be deleted","message":"Event Report 4 could not be deleted","url":"\/eventReports\/delete\/4","errors":"Event Report 4 could not be deleted"}`)
+		})
+
+	if err := client.DeleteEventReport("3", true); err != nil {
+		t.Errorf("DeleteEventReport returned an error: %s", err)
+	}
+
+	if err := client.DeleteEventReport("4", false); err == nil {
+		t.Errorf("DeleteEventReport did not return an error")
+	}
+}
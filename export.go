@@ -0,0 +1,74 @@
+package misp
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReturnFormat is the output format of a restSearch query
+type ReturnFormat string
+
+// Formats supported by restSearch
+const (
+	ReturnFormatJSON            ReturnFormat = "json"
+	ReturnFormatXML             ReturnFormat = "xml"
+	ReturnFormatCSV             ReturnFormat = "csv"
+	ReturnFormatText            ReturnFormat = "text"
+	ReturnFormatSTIX            ReturnFormat = "stix"
+	ReturnFormatSTIXJSON        ReturnFormat = "stix-json"
+	ReturnFormatSTIX2           ReturnFormat = "stix2"
+	ReturnFormatSuricata        ReturnFormat = "suricata"
+	ReturnFormatSnort           ReturnFormat = "snort"
+	ReturnFormatZeek            ReturnFormat = "zeek"
+	ReturnFormatBro             ReturnFormat = "bro" // former name of zeek
+	ReturnFormatRPZ             ReturnFormat = "rpz"
+	ReturnFormatHashes          ReturnFormat = "hashes"
+	ReturnFormatOpenIOC         ReturnFormat = "openioc"
+	ReturnFormatYara            ReturnFormat = "yara"
+	ReturnFormatYaraJSON        ReturnFormat = "yara-json"
+	ReturnFormatCache           ReturnFormat = "cache"
+	ReturnFormatAttack          ReturnFormat = "attack"
+	ReturnFormatAttackSightings ReturnFormat = "attack-sightings"
+)
+
+// String returns the name of the format as expected by the server
+func (f ReturnFormat) String() string {
+	return string(f)
+}
+
+// ExportAttributes runs an attribute search and writes the raw answer of
+// the server in the given format to w. The answer is streamed, it is never
+// held in memory. It returns the number of bytes written.
+func (client *Client) ExportAttributes(q *AttributeQuery, format ReturnFormat, w io.Writer) (int64, error) {
+	req := *q
+	req.ReturnFormat = format
+
+	return client.export("/attributes/restSearch", &req, w)
+}
+
+// ExportEvents runs an event search and writes the raw answer of the server
+// in the given format to w, see ExportAttributes
+func (client *Client) ExportEvents(q *EventQuery, format ReturnFormat, w io.Writer) (int64, error) {
+	req := *q
+	req.ReturnFormat = format
+
+	return client.export("/events/restSearch", &req, w)
+}
+
+func (client *Client) export(path string, q interface{}, w io.Writer) (int64, error) {
+	resp, err := client.Do("POST", path, Request{Request: q})
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("Could not read export: %s", err)
+	}
+
+	return n, nil
+}
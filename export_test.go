@@ -0,0 +1,88 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportAttributes(t *testing.T) {
+	setup()
+
+	csv := "uuid,event_id,category,type,value,comment,to_ids,date,object_relation,attribute_tag,object_uuid,object_name,object_meta_category\n" +
+		strings.Repeat(`"5e1f4f1b-0010-4a1e-9fba-5b2a0a3ac101",1,"Network activity","domain","foobar.com","",1,1579110170,"","","","",""`+"\n", 1000)
+
+	mux.HandleFunc("/attributes/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req struct {
+				Request AttributeQuery `json:"request"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Cannot decode json AttributeQuery request: %s", err)
+			}
+			if req.Request.ReturnFormat != ReturnFormatCSV || req.Request.Type != "domain" {
+				t.Errorf("Unexpected export request: %+v", req.Request)
+			}
+
+			fmt.Fprint(w, csv)
+		})
+
+	q := &AttributeQuery{Type: "domain"}
+
+	var buf bytes.Buffer
+	n, err := client.ExportAttributes(q, ReturnFormatCSV, &buf)
+	if err != nil {
+		t.Fatalf("ExportAttributes returned an error: %s", err)
+	}
+	if n != int64(len(csv)) || buf.String() != csv {
+		t.Errorf("ExportAttributes wrote %d bytes, want %d", n, len(csv))
+	}
+	if q.ReturnFormat != "" {
+		t.Errorf("ExportAttributes modified the query")
+	}
+}
+
+func TestExportEvents(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req struct {
+				Request map[string]interface{} `json:"request"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Cannot decode json EventQuery request: %s", err)
+			}
+
+			switch req.Request["returnFormat"] {
+			case "suricata":
+				fmt.Fprint(w, `alert dns any any -> any any (msg: "MISP e1 [] Domain: foobar.com"; dns.query; content:"foobar.com"; nocase; sid:1000010; rev:1;)`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"name":"Invalid format.","message":"Invalid format.","url":"\/events\/restSearch"}`)
+			}
+		})
+
+	var buf bytes.Buffer
+	if _, err := client.ExportEvents(&EventQuery{EventID: "1"}, ReturnFormatSuricata, &buf); err != nil {
+		t.Fatalf("ExportEvents returned an error: %s", err)
+	}
+	if !strings.HasPrefix(buf.String(), "alert dns") {
+		t.Errorf("ExportEvents wrote %q", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := client.ExportEvents(&EventQuery{EventID: "1"}, ReturnFormat("unknown"), &buf); err == nil {
+		t.Errorf("ExportEvents did not return an error for an unknown format")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("ExportEvents wrote an error body: %q", buf.String())
+	}
+}
@@ -0,0 +1,169 @@
+package misp
+
+import (
+	"fmt"
+)
+
+// Source formats of a feed
+const (
+	FeedFormatMISP     = "misp"
+	FeedFormatFreetext = "freetext"
+	FeedFormatCSV      = "csv"
+)
+
+// Feed is a remote source of events configured on the server. The booleans
+// are always sent, so they can be turned off by EditFeed.
+type Feed struct {
+	ID              string       `json:"id,omitempty"`
+	Name            string       `json:"name,omitempty"`
+	Provider        string       `json:"provider,omitempty"`
+	URL             string       `json:"url,omitempty"`
+	Rules           string       `json:"rules,omitempty"`
+	Enabled         bool         `json:"enabled"`
+	Distribution    Distribution `json:"distribution,omitempty"`
+	SharingGroupID  string       `json:"sharing_group_id,omitempty"`
+	TagID           string       `json:"tag_id,omitempty"`
+	Default         bool         `json:"default"`
+	SourceFormat    string       `json:"source_format,omitempty"`
+	FixedEvent      bool         `json:"fixed_event"`
+	DeltaMerge      bool         `json:"delta_merge"`
+	EventID         string       `json:"event_id,omitempty"`
+	Publish         bool         `json:"publish"`
+	OverrideIDS     bool         `json:"override_ids"`
+	Settings        string       `json:"settings,omitempty"`
+	InputSource     string       `json:"input_source,omitempty"`
+	DeleteLocalFile bool         `json:"delete_local_file"`
+	LookupVisible   bool         `json:"lookup_visible"`
+	Headers         string       `json:"headers,omitempty"`
+	CachingEnabled  bool         `json:"caching_enabled"`
+	ForceToIDS      bool         `json:"force_to_ids"`
+	OrgcID          string       `json:"orgc_id,omitempty"`
+}
+
+type feedWrapper struct {
+	Feed Feed `json:"Feed"`
+}
+
+// ListFeeds returns all the feeds configured on the server
+func (client *Client) ListFeeds() ([]Feed, error) {
+	var resp []feedWrapper
+	if err := client.call("GET", "/feeds/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	feeds := make([]Feed, len(resp))
+	for i, f := range resp {
+		feeds[i] = f.Feed
+	}
+
+	return feeds, nil
+}
+
+// GetFeed returns the feed with the given ID
+func (client *Client) GetFeed(feedID string) (*Feed, error) {
+	var resp feedWrapper
+	if err := client.call("GET", fmt.Sprintf("/feeds/view/%s", feedID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Feed, nil
+}
+
+// AddFeed creates a new feed and returns it as saved by the server
+func (client *Client) AddFeed(feed *Feed) (*Feed, error) {
+	if err := checkDistribution(feed.Distribution, feed.SharingGroupID, false); err != nil {
+		return nil, err
+	}
+
+	var resp feedWrapper
+	if err := client.call("POST", "/feeds/add", feedWrapper{Feed: *feed}, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Feed, nil
+}
+
+// EditFeed updates the feed identified by feed.ID. All the settings are
+// replaced, the booleans included: start from the feed returned by GetFeed
+// to only change some of them.
+func (client *Client) EditFeed(feed *Feed) (*Feed, error) {
+	if err := checkDistribution(feed.Distribution, feed.SharingGroupID, false); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/feeds/edit/%s", feed.ID)
+
+	var resp feedWrapper
+	if err := client.call("POST", path, feedWrapper{Feed: *feed}, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Feed, nil
+}
+
+// DeleteFeed removes a feed from the server
+func (client *Client) DeleteFeed(feedID string) error {
+	return client.postAction(fmt.Sprintf("/feeds/delete/%s", feedID), nil)
+}
+
+// EnableFeed enables a feed
+func (client *Client) EnableFeed(feedID string) error {
+	return client.postAction(fmt.Sprintf("/feeds/enable/%s", feedID), nil)
+}
+
+// DisableFeed disables a feed
+func (client *Client) DisableFeed(feedID string) error {
+	return client.postAction(fmt.Sprintf("/feeds/disable/%s", feedID), nil)
+}
+
+// SetFeedCaching enables or disables the caching of a feed
+func (client *Client) SetFeedCaching(feedID string, enabled bool) error {
+	// Only caching_enabled is sent, the other settings are unchanged
+	req := map[string]interface{}{
+		"Feed": map[string]interface{}{
+			"caching_enabled": enabled,
+		},
+	}
+
+	return client.postAction(fmt.Sprintf("/feeds/edit/%s", feedID), req)
+}
+
+// FetchFeed pulls the events of a feed. The fetch usually runs in a
+// background job.
+func (client *Client) FetchFeed(feedID string) (*JobHandle, error) {
+	return client.jobAction(fmt.Sprintf("/feeds/fetchFromFeed/%s", feedID))
+}
+
+// FetchAllFeeds pulls the events of every enabled feed
+func (client *Client) FetchAllFeeds() (*JobHandle, error) {
+	return client.jobAction("/feeds/fetchFromAllFeeds")
+}
+
+// CacheFeeds caches the content of the feeds. scope is either a feed ID or
+// one of "all", "freetext", "misp".
+func (client *Client) CacheFeeds(scope string) (*JobHandle, error) {
+	return client.jobAction(fmt.Sprintf("/feeds/cacheFeeds/%s", scope))
+}
+
+// PreviewFeed lists the events available in a feed, without importing them.
+// Only the metadata of the events (info, date, tags...) is filled.
+func (client *Client) PreviewFeed(feedID string) ([]Event, error) {
+	var events []Event
+	if err := client.call("GET", fmt.Sprintf("/feeds/previewIndex/%s", feedID), nil, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// PreviewFeedEvent returns an event of a feed, without importing it
+func (client *Client) PreviewFeedEvent(feedID string, eventUUID string) (*Event, error) {
+	path := fmt.Sprintf("/feeds/previewEvent/%s/%s", feedID, eventUUID)
+
+	var resp eventWrapper
+	if err := client.call("GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Event, nil
+}
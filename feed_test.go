@@ -0,0 +1,200 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestListFeeds(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/feeds/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			testAuthentication(t, r)
+			fmt.Fprint(w, `[{"Feed":{"id":"1","name":"CIRCL OSINT Feed","provider":"CIRCL","url":"https:\/\/www.circl.lu\/doc\/misp\/feed-osint","rules":"","enabled":true,"distribution":"3","sharing_group_id":"0","tag_id":"0","default":true,"source_format":"misp","fixed_event":false,"delta_merge":false,"event_id":"0","publish":false,"override_ids":false,"caching_enabled":true}}]`)
+		})
+
+	feeds, err := client.ListFeeds()
+	if err != nil {
+		t.Fatalf("ListFeeds returned an error: %s", err)
+	}
+
+	if len(feeds) != 1 {
+		t.Fatalf("ListFeeds returned %d feeds, want 1", len(feeds))
+	}
+
+	f := feeds[0]
+	if f.ID != "1" || f.Provider != "CIRCL" || !f.Enabled || !f.CachingEnabled || f.SourceFormat != FeedFormatMISP {
+		t.Errorf("ListFeeds returned %+v", f)
+	}
+}
+
+func TestAddFeed(t *testing.T) {
+	setup()
+
+	feed := &Feed{
+		Name:         "botvrij.eu",
+		Provider:     "Botvrij.eu",
+		URL:          "https://www.botvrij.eu/data/feed-osint",
+		SourceFormat: FeedFormatMISP,
+		Enabled:      true,
+	}
+
+	mux.HandleFunc("/feeds/add",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got feedWrapper
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Feed request: %s", err)
+			}
+
+			if got.Feed != *feed {
+				t.Errorf("AddFeed sent %+v, want %+v", got.Feed, *feed)
+			}
+
+			fmt.Fprint(w, `{"Feed":{"id":"2","name":"botvrij.eu","provider":"Botvrij.eu","url":"https:\/\/www.botvrij.eu\/data\/feed-osint","source_format":"misp","enabled":true}}`)
+		})
+
+	newFeed, err := client.AddFeed(feed)
+	if err != nil {
+		t.Fatalf("AddFeed returned an error: %s", err)
+	}
+
+	if newFeed.ID != "2" {
+		t.Errorf("AddFeed returned ID %q, want 2", newFeed.ID)
+	}
+}
+
+func TestEditFeed(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/feeds/edit/2",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Feed request: %s", err)
+			}
+			for _, field := range []string{"enabled", "publish", "delta_merge"} {
+				if v, ok := got["Feed"][field]; !ok || v != false {
+					t.Errorf("EditFeed sent %+v, want %s=false", got, field)
+				}
+			}
+
+			fmt.Fprint(w, `{"Feed":{"id":"2","name":"botvrij.eu","enabled":false}}`)
+		})
+
+	feed, err := client.EditFeed(&Feed{ID: "2", Name: "botvrij.eu"})
+	if err != nil {
+		t.Fatalf("EditFeed returned an error: %s", err)
+	}
+	if feed.Enabled {
+		t.Errorf("EditFeed returned %+v", feed)
+	}
+}
+
+func TestSetFeedCaching(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/feeds/edit/3",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Feed request: %s", err)
+			}
+
+			if v, ok := got["Feed"]["caching_enabled"]; !ok || v != false {
+				t.Errorf("SetFeedCaching sent %+v, want caching_enabled=false", got)
+			}
+
+			fmt.Fprint(w, `{"Feed":{"id":"3","caching_enabled":false}}`)
+		})
+
+	if err := client.SetFeedCaching("3", false); err != nil {
+		t.Errorf("SetFeedCaching returned an error: %s", err)
+	}
+}
+
+func TestEnableFeed(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/feeds/enable/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":true,"name":"Feed enabled.","message":"Feed enabled.","url":"\/feeds\/enable\/1"}`)
+		})
+
+	mux.HandleFunc("/feeds/disable/9",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Feed could not be disabled.","message":"Feed could not be disabled.","url":"\/feeds\/disable\/9","errors":"Feed could not be disabled."}`)
+		})
+
+	if err := client.EnableFeed("1"); err != nil {
+		t.Errorf("EnableFeed returned an error: %s", err)
+	}
+
+	if err := client.DisableFeed("9"); err == nil {
+		t.Errorf("DisableFeed did not return an error")
+	}
+}
+
+func TestFetchFeed(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/feeds/fetchFromFeed/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"name":"Pull queued for background execution. Job ID: 42","message":"Pull queued for background execution. Job ID: 42","url":"\/feeds\/fetchFromFeed\/1"}`)
+		})
+
+	job, err := client.FetchFeed("1")
+	if err != nil {
+		t.Fatalf("FetchFeed returned an error: %s", err)
+	}
+
+	if job.ID != "42" || job.Message != "Pull queued for background execution. Job ID: 42" {
+		t.Errorf("FetchFeed returned %+v", job)
+	}
+}
+
+func TestPreviewFeed(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/feeds/previewIndex/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[{"uuid":"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101","info":"OSINT - Foobar campaign","Orgc":{"name":"CIRCL","uuid":"55f6ea5e-2c60-40e5-964f-47a8950d210f"},"analysis":"2","threat_level_id":3,"timestamp":"1579110170","date":"2020-01-15","Tag":[{"name":"tlp:white","colour":"#ffffff"}]}]`)
+		})
+
+	mux.HandleFunc("/feeds/previewEvent/1/5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"Event":{"uuid":"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101","info":"OSINT - Foobar campaign","Attribute":[{"type":"domain","category":"Network activity","value":"foobar.com","to_ids":true}]}}`)
+		})
+
+	events, err := client.PreviewFeed("1")
+	if err != nil {
+		t.Fatalf("PreviewFeed returned an error: %s", err)
+	}
+
+	if len(events) != 1 || events[0].Orgc.Name != "CIRCL" || events[0].ThreatLevelID != "3" || events[0].Tag[0].Name != "tlp:white" {
+		t.Errorf("PreviewFeed returned %+v", events)
+	}
+
+	event, err := client.PreviewFeedEvent("1", events[0].UUID)
+	if err != nil {
+		t.Fatalf("PreviewFeedEvent returned an error: %s", err)
+	}
+
+	if len(event.Attribute) != 1 || event.Attribute[0].Value != "foobar.com" {
+		t.Errorf("PreviewFeedEvent returned %+v", event)
+	}
+}
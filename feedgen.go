@@ -0,0 +1,408 @@
+package misp
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FeedGenerator writes events to a directory in the MISP feed format, so
+// other instances can subscribe to it. It works like the feed-generator of
+// PyMISP: the feed is updated incrementally, events already present with the
+// same timestamp are not written again.
+type FeedGenerator struct {
+	// Directory of the feed, created if needed
+	Dir string
+
+	// Only the events with at least one of these tags are exported, all the
+	// events when empty
+	Tags []string
+
+	// Events with one of these tags are never exported
+	ExcludeTags []string
+
+	// Distribution levels of the events, objects and attributes to export,
+	// all of them when empty. Objects and attributes inheriting their
+	// distribution are checked against the one of their event or object,
+	// those without a distribution are never exported.
+	Distributions []Distribution
+
+	// Creator organisation of the events missing one
+	Orgc *Organisation
+}
+
+// AddEvents adds or updates events in the feed. Events of the feed which
+// no longer pass the filters are removed from it. It returns the number of
+// events written or removed, events not modified are skipped.
+func (g *FeedGenerator) AddEvents(events ...Event) (int, error) {
+	if err := os.MkdirAll(g.Dir, 0755); err != nil {
+		return 0, err
+	}
+
+	manifest, err := g.readManifest()
+	if err != nil {
+		return 0, err
+	}
+
+	hashes, err := g.readHashes()
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	var removed []string
+	for i := range events {
+		event := &events[i]
+		if event.UUID == "" {
+			return written, fmt.Errorf("event %q has no UUID", event.Info)
+		}
+
+		if !g.accept(event) {
+			if _, ok := manifest[event.UUID]; ok {
+				delete(manifest, event.UUID)
+				delete(hashes, event.UUID)
+				removed = append(removed, event.UUID)
+				written++
+			}
+			continue
+		}
+
+		if old, ok := manifest[event.UUID]; ok && old.Timestamp == event.Timestamp && event.Timestamp != "" {
+			continue
+		}
+
+		feedEvent := g.feedEvent(event)
+		buf, err := json.Marshal(eventWrapper{Event: *feedEvent})
+		if err != nil {
+			return written, err
+		}
+
+		if err := writeFileAtomic(filepath.Join(g.Dir, feedEvent.UUID+".json"), buf); err != nil {
+			return written, err
+		}
+
+		manifest[feedEvent.UUID] = manifestEntry(feedEvent)
+		hashes[feedEvent.UUID] = eventHashes(feedEvent)
+		written++
+	}
+
+	if err := g.writeHashes(hashes); err != nil {
+		return written, err
+	}
+	if err := g.writeManifest(manifest); err != nil {
+		return written, err
+	}
+
+	// Once out of the manifest, so subscribers never miss a listed event
+	for _, uuid := range removed {
+		err := os.Remove(filepath.Join(g.Dir, uuid+".json"))
+		if err != nil && !os.IsNotExist(err) {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// AddFromSearch adds to the feed the events returned by a search on the
+// server
+func (g *FeedGenerator) AddFromSearch(client *Client, q *EventQuery) (int, error) {
+	events, err := client.SearchEvent(q)
+	if err != nil {
+		return 0, err
+	}
+
+	return g.AddEvents(events...)
+}
+
+// accept checks the event against the tags and distribution filters
+func (g *FeedGenerator) accept(event *Event) bool {
+	if !g.distributionAllowed(event.Distribution) {
+		return false
+	}
+
+	tags := make(map[string]bool, len(event.Tag))
+	for _, tag := range event.Tag {
+		tags[tag.Name] = true
+	}
+
+	for _, tag := range g.ExcludeTags {
+		if tags[tag] {
+			return false
+		}
+	}
+
+	if len(g.Tags) == 0 {
+		return true
+	}
+
+	for _, tag := range g.Tags {
+		if tags[tag] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *FeedGenerator) distributionAllowed(distribution Distribution) bool {
+	if len(g.Distributions) == 0 {
+		return true
+	}
+
+	for _, d := range g.Distributions {
+		if d == distribution {
+			return true
+		}
+	}
+
+	return false
+}
+
+// childDistribution resolves the distribution of an attribute or object
+// inheriting the one of its parent
+func childDistribution(parent, distribution Distribution) Distribution {
+	if distribution == DistributionInherit {
+		return parent
+	}
+
+	return distribution
+}
+
+// feedEvent returns a copy of event with only the fields published in feeds
+func (g *FeedGenerator) feedEvent(event *Event) *Event {
+	e := &Event{
+		UUID:             event.UUID,
+		Info:             event.Info,
+		Date:             event.Date,
+		ThreatLevelID:    event.ThreatLevelID,
+		Analysis:         event.Analysis,
+		Published:        event.Published,
+		Timestamp:        event.Timestamp,
+		PublishTimestamp: event.PublishTimestamp,
+		ExtendsUUID:      event.ExtendsUUID,
+		Tag:              feedTags(event.Tag),
+	}
+
+	orgc := event.Orgc
+	if orgc == nil {
+		orgc = g.Orgc
+	}
+	if orgc != nil {
+		e.Orgc = &Organisation{Name: orgc.Name, UUID: orgc.UUID}
+	}
+
+	for _, attr := range event.Attribute {
+		if g.distributionAllowed(childDistribution(event.Distribution, attr.Distribution)) {
+			e.Attribute = append(e.Attribute, feedAttribute(attr))
+		}
+	}
+
+	for _, obj := range event.Object {
+		objDistribution := childDistribution(event.Distribution, obj.Distribution)
+		if !g.distributionAllowed(objDistribution) {
+			continue
+		}
+
+		o := Object{
+			Name:            obj.Name,
+			MetaCategory:    obj.MetaCategory,
+			Description:     obj.Description,
+			TemplateUUID:    obj.TemplateUUID,
+			TemplateVersion: obj.TemplateVersion,
+			UUID:            obj.UUID,
+			Timestamp:       obj.Timestamp,
+			Comment:         obj.Comment,
+			Deleted:         obj.Deleted,
+			FirstSeen:       obj.FirstSeen,
+			LastSeen:        obj.LastSeen,
+		}
+		for _, attr := range obj.Attribute {
+			if g.distributionAllowed(childDistribution(objDistribution, attr.Distribution)) {
+				o.Attribute = append(o.Attribute, feedAttribute(attr))
+			}
+		}
+		for _, ref := range obj.ObjectReference {
+			o.ObjectReference = append(o.ObjectReference, ObjectReference{
+				UUID:             ref.UUID,
+				Timestamp:        ref.Timestamp,
+				ObjectUUID:       ref.ObjectUUID,
+				ReferencedUUID:   ref.ReferencedUUID,
+				RelationshipType: ref.RelationshipType,
+				Comment:          ref.Comment,
+				Deleted:          ref.Deleted,
+			})
+		}
+		e.Object = append(e.Object, o)
+	}
+
+	return e
+}
+
+func feedAttribute(attr Attribute) Attribute {
+	return Attribute{
+		UUID:               attr.UUID,
+		Type:               attr.Type,
+		Category:           attr.Category,
+		Value:              attr.Value,
+		Comment:            attr.Comment,
+		Data:               attr.Data,
+		Deleted:            attr.Deleted,
+		Timestamp:          attr.Timestamp,
+		ToIDS:              attr.ToIDS,
+		DisableCorrelation: attr.DisableCorrelation,
+		ObjectRelation:     attr.ObjectRelation,
+		FirstSeen:          attr.FirstSeen,
+		LastSeen:           attr.LastSeen,
+		Tag:                feedTags(attr.Tag),
+	}
+}
+
+func feedTags(tags []Tag) []Tag {
+	var out []Tag
+	for _, tag := range tags {
+		out = append(out, Tag{Name: tag.Name, Colour: tag.Colour})
+	}
+
+	return out
+}
+
+// manifestEntry returns the metadata of the event stored in manifest.json
+func manifestEntry(e *Event) Event {
+	return Event{
+		Info:          e.Info,
+		Date:          e.Date,
+		Analysis:      e.Analysis,
+		ThreatLevelID: e.ThreatLevelID,
+		Timestamp:     e.Timestamp,
+		Orgc:          e.Orgc,
+		Tag:           e.Tag,
+	}
+}
+
+// eventHashes returns the MD5 of every attribute value of the event, each
+// part of composite values being hashed separately
+func eventHashes(e *Event) []string {
+	var hashes []string
+
+	add := func(attr *Attribute) {
+		values := []string{attr.Value}
+		if strings.Contains(attr.Type, "|") {
+			values = strings.Split(attr.Value, "|")
+		}
+		for _, v := range values {
+			sum := md5.Sum([]byte(v))
+			hashes = append(hashes, hex.EncodeToString(sum[:]))
+		}
+	}
+
+	for i := range e.Attribute {
+		add(&e.Attribute[i])
+	}
+	for i := range e.Object {
+		for j := range e.Object[i].Attribute {
+			add(&e.Object[i].Attribute[j])
+		}
+	}
+
+	return hashes
+}
+
+func (g *FeedGenerator) readManifest() (map[string]Event, error) {
+	manifest := make(map[string]Event)
+
+	buf, err := ioutil.ReadFile(filepath.Join(g.Dir, FeedManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return nil, fmt.Errorf("Could not decode %s: %s", FeedManifestFile, err)
+	}
+
+	return manifest, nil
+}
+
+func (g *FeedGenerator) writeManifest(manifest map[string]Event) error {
+	for uuid, e := range manifest {
+		e.UUID = ""
+		manifest[uuid] = e
+	}
+
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(g.Dir, FeedManifestFile), buf)
+}
+
+// readHashes returns the content of hashes.csv grouped by event UUID
+func (g *FeedGenerator) readHashes() (map[string][]string, error) {
+	hashes := make(map[string][]string)
+
+	buf, err := ioutil.ReadFile(filepath.Join(g.Dir, FeedHashesFile))
+	if os.IsNotExist(err) {
+		return hashes, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		if len(fields) == 2 {
+			hashes[fields[1]] = append(hashes[fields[1]], fields[0])
+		}
+	}
+
+	return hashes, nil
+}
+
+func (g *FeedGenerator) writeHashes(hashes map[string][]string) error {
+	uuids := make([]string, 0, len(hashes))
+	for uuid := range hashes {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	var b strings.Builder
+	for _, uuid := range uuids {
+		for _, hash := range hashes[uuid] {
+			fmt.Fprintf(&b, "%s,%s\n", hash, uuid)
+		}
+	}
+
+	return writeFileAtomic(filepath.Join(g.Dir, FeedHashesFile), []byte(b.String()))
+}
+
+// writeFileAtomic writes to a temporary file renamed once complete, so
+// readers of the feed never see a partial file
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,203 @@
+package misp
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFeedGenerator(t *testing.T) {
+	g := &FeedGenerator{
+		Dir:           t.TempDir(),
+		Tags:          []string{"tlp:white", "tlp:green"},
+		ExcludeTags:   []string{"tlp:red"},
+		Distributions: []Distribution{DistributionThisCommunityOnly, DistributionConnectedCommunities, DistributionAllCommunities},
+		Orgc:          &Organisation{Name: "Contoso SOC", UUID: "0f6d3b8e-5a21-4c7d-9e40-7b2c1d9a8e36"},
+	}
+
+	events := []Event{
+		{
+			ID:           "31",
+			UUID:         "8c4e1d2a-6b7f-4e93-9a15-d0c3b8f2e761",
+			Info:         "Ransomware affiliate infrastructure",
+			Timestamp:    "1579110170",
+			Distribution: "3",
+			Tag:          []Tag{{ID: "4", Name: "tlp:white"}},
+			Attribute: []Attribute{
+				{Type: "domain", Value: "relay.example", Distribution: "5"},
+				{Type: "domain|ip", Value: "panel.example|198.51.100.7", Distribution: "5"},
+				{Type: "ip-dst", Value: "10.0.0.1", Distribution: "0"},
+				{Type: "ip-dst", Value: "10.0.0.2"},
+			},
+			Object: []Object{
+				{
+					Name:         "file",
+					Distribution: "5",
+					Attribute: []Attribute{
+						{Type: "md5", Value: "68b329da9893e34099c7d8ad5cb9c940", Distribution: "5"},
+						{Type: "filename", Value: "unset.exe"},
+					},
+				},
+				{
+					Name:         "file",
+					Distribution: "0",
+					Attribute: []Attribute{
+						{Type: "md5", Value: "b026324c6904b2a9cb4b88d6d61c81d1", Distribution: "5"},
+					},
+				},
+				{
+					Name: "file",
+					Attribute: []Attribute{
+						{Type: "md5", Value: "26ab0db90d72e28ad0ba1e22ee510510", Distribution: "5"},
+					},
+				},
+			},
+		},
+		{UUID: "b7a2f0d9-3c5e-4d18-8e6a-41f9c2d7e053", Timestamp: "1579800000", Distribution: "0", Tag: []Tag{{Name: "tlp:white"}}},
+		{UUID: "e05c9a71-2f4b-4a86-b3d2-9c6e8f1a2b47", Timestamp: "1579800000", Distribution: "3", Tag: []Tag{{Name: "tlp:red"}}},
+	}
+
+	n, err := g.AddEvents(events...)
+	if err != nil {
+		t.Fatalf("AddEvents returned an error: %s", err)
+	}
+	if n != 1 {
+		t.Errorf("AddEvents wrote %d events, want 1", n)
+	}
+
+	r := NewFeedReader(os.DirFS(g.Dir))
+	manifest, err := r.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest returned an error: %s", err)
+	}
+	if len(manifest) != 1 || manifest["8c4e1d2a-6b7f-4e93-9a15-d0c3b8f2e761"].Orgc.Name != "Contoso SOC" {
+		t.Errorf("Manifest is %+v", manifest)
+	}
+
+	event, err := r.Event("8c4e1d2a-6b7f-4e93-9a15-d0c3b8f2e761")
+	if err != nil {
+		t.Fatalf("Event returned an error: %s", err)
+	}
+	if event.ID != "" || event.Tag[0].ID != "" {
+		t.Errorf("Event has local identifiers: %+v", event)
+	}
+	var values []string
+	for _, attr := range event.Attribute {
+		values = append(values, attr.Value)
+	}
+	if !reflect.DeepEqual(values, []string{"relay.example", "panel.example|198.51.100.7"}) {
+		t.Errorf("Event has attributes %v", values)
+	}
+
+	for _, value := range []string{"relay.example", "198.51.100.7", "68b329da9893e34099c7d8ad5cb9c940"} {
+		found, err := r.Lookup(value)
+		if err != nil {
+			t.Fatalf("Lookup returned an error: %s", err)
+		}
+		if len(found) != 1 {
+			t.Errorf("Lookup(%q) returned %v", value, found)
+		}
+	}
+
+	// Without a distribution, or inheriting a filtered out one
+	for _, value := range []string{"10.0.0.1", "10.0.0.2", "unset.exe", "b026324c6904b2a9cb4b88d6d61c81d1", "26ab0db90d72e28ad0ba1e22ee510510"} {
+		if found, _ := r.Lookup(value); len(found) != 0 {
+			t.Errorf("Lookup(%q) returned %v", value, found)
+		}
+	}
+	if len(event.Object) != 1 || len(event.Object[0].Attribute) != 1 {
+		t.Errorf("Event has objects %+v", event.Object)
+	}
+
+	// Nothing changed, nothing is written
+	n, err = g.AddEvents(events...)
+	if err != nil {
+		t.Fatalf("AddEvents returned an error: %s", err)
+	}
+	if n != 0 {
+		t.Errorf("AddEvents wrote %d unmodified events", n)
+	}
+
+	// An updated event replaces its hashes
+	events = events[:1]
+	events[0].Timestamp = "1579200000"
+	events[0].Attribute = events[0].Attribute[:1]
+	events[0].Object = nil
+	if n, err = g.AddEvents(events...); err != nil || n != 1 {
+		t.Fatalf("AddEvents returned %d, %v", n, err)
+	}
+
+	r = NewFeedReader(os.DirFS(g.Dir))
+	if found, _ := r.Lookup("198.51.100.7"); len(found) != 0 {
+		t.Errorf("Lookup of a removed value returned %v", found)
+	}
+	if found, _ := r.Lookup("relay.example"); len(found) != 1 {
+		t.Errorf("Lookup of an updated event returned %v", found)
+	}
+
+	// An event no longer shared is removed from the feed
+	events[0].Timestamp = "1579300000"
+	events[0].Tag = append(events[0].Tag, Tag{Name: "tlp:red"})
+	if n, err = g.AddEvents(events...); err != nil || n != 1 {
+		t.Fatalf("AddEvents returned %d, %v", n, err)
+	}
+
+	r = NewFeedReader(os.DirFS(g.Dir))
+	if manifest, _ := r.Manifest(); len(manifest) != 0 {
+		t.Errorf("Manifest of a removed event is %+v", manifest)
+	}
+	if found, _ := r.Lookup("relay.example"); len(found) != 0 {
+		t.Errorf("Lookup in a removed event returned %v", found)
+	}
+	if _, err := os.Stat(filepath.Join(g.Dir, events[0].UUID+".json")); !os.IsNotExist(err) {
+		t.Errorf("File of a removed event was kept: %v", err)
+	}
+}
+
+func TestChildDistribution(t *testing.T) {
+	tests := []struct {
+		event, object, attribute, want Distribution
+	}{
+		{DistributionAllCommunities, DistributionInherit, DistributionInherit, DistributionAllCommunities},
+		{DistributionAllCommunities, DistributionYourOrgOnly, DistributionInherit, DistributionYourOrgOnly},
+		{DistributionYourOrgOnly, DistributionAllCommunities, DistributionInherit, DistributionAllCommunities},
+		{DistributionAllCommunities, DistributionInherit, DistributionThisCommunityOnly, DistributionThisCommunityOnly},
+		{DistributionAllCommunities, "", DistributionInherit, ""},
+	}
+	for _, test := range tests {
+		got := childDistribution(childDistribution(test.event, test.object), test.attribute)
+		if got != test.want {
+			t.Errorf("childDistribution of %+v returned %q", test, got)
+		}
+	}
+}
+
+func TestFeedGenerator_AddFromSearch(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"response":[{"Event":{"id":"12","uuid":"8c4e1d2a-6b7f-4e93-9a15-d0c3b8f2e761","info":"Ransomware affiliate infrastructure","timestamp":"1579110170","distribution":"3","Orgc":{"id":"1","name":"CIRCL","uuid":"55f6ea5e-2c60-40e5-964f-47a8950d210f"},"Attribute":[{"id":"100","type":"domain","category":"Network activity","value":"relay.example","distribution":"5"}]}}]}`)
+		})
+
+	g := &FeedGenerator{Dir: t.TempDir()}
+	n, err := g.AddFromSearch(client, &EventQuery{Tags: "tlp:white", Published: "1"})
+	if err != nil {
+		t.Fatalf("AddFromSearch returned an error: %s", err)
+	}
+	if n != 1 {
+		t.Errorf("AddFromSearch wrote %d events, want 1", n)
+	}
+
+	event, err := NewFeedReader(os.DirFS(g.Dir)).Event("8c4e1d2a-6b7f-4e93-9a15-d0c3b8f2e761")
+	if err != nil {
+		t.Fatalf("Event returned an error: %s", err)
+	}
+	if event.Orgc.ID != "" || event.Orgc.Name != "CIRCL" || len(event.Attribute) != 1 {
+		t.Errorf("Event is %+v", event)
+	}
+}
@@ -0,0 +1,330 @@
+package misp
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Files of a feed in the MISP format
+const (
+	FeedManifestFile = "manifest.json"
+	FeedHashesFile   = "hashes.csv"
+)
+
+// FeedReader reads events from a feed in the MISP format: a manifest.json
+// index, one JSON file per event named after its UUID and an optional
+// hashes.csv file. It does not need a MISP server.
+type FeedReader struct {
+	fsys fs.FS
+
+	manifest map[string]Event
+	hashes   map[string][]string
+}
+
+// NewFeedReader returns a reader of the feed stored at the root of fsys
+func NewFeedReader(fsys fs.FS) *FeedReader {
+	return &FeedReader{fsys: fsys}
+}
+
+// NewHTTPFeedReader returns a reader of the feed published at baseURL, for
+// example https://www.circl.lu/doc/misp/feed-osint/
+func NewHTTPFeedReader(baseURL string, httpClient *http.Client) (*FeedReader, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFeedReader(&HTTPFS{BaseURL: u, Client: httpClient}), nil
+}
+
+// Manifest returns the index of the feed, keyed by event UUID. Only the
+// metadata of the events is filled. The manifest is cached until the next
+// call to Events or Refresh.
+func (r *FeedReader) Manifest() (map[string]Event, error) {
+	if r.manifest != nil {
+		return r.manifest, nil
+	}
+
+	return r.readManifest()
+}
+
+// Refresh drops the cached manifest and hashes, read again from the feed
+// when next needed
+func (r *FeedReader) Refresh() {
+	r.manifest = nil
+	r.hashes = nil
+}
+
+func (r *FeedReader) readManifest() (map[string]Event, error) {
+	f, err := r.fsys.Open(FeedManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest := make(map[string]Event)
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("Could not decode %s: %s", FeedManifestFile, err)
+	}
+
+	for uuid, e := range manifest {
+		e.UUID = uuid
+		manifest[uuid] = e
+	}
+	r.manifest = manifest
+
+	return manifest, nil
+}
+
+// Event reads the event with the given UUID
+func (r *FeedReader) Event(uuid string) (*Event, error) {
+	name := uuid + ".json"
+	if !fs.ValidPath(name) || strings.Contains(uuid, "/") {
+		return nil, fmt.Errorf("invalid event UUID %q", uuid)
+	}
+
+	f, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	event, err := decodeFeedEvent(f)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode %s: %s", name, err)
+	}
+
+	return event, nil
+}
+
+// feedNumberFields are the fields the package decodes as strings, that
+// feeds written by other tools than MISP may hold as JSON numbers
+var feedNumberFields = map[string]bool{
+	"timestamp":        true,
+	"template_version": true,
+}
+
+// decodeFeedEvent decodes an event file, quoting the numbers of
+// feedNumberFields first
+func decodeFeedEvent(r io.Reader) (*Event, error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+
+	var raw interface{}
+	if err := d.Decode(&raw); err != nil {
+		return nil, err
+	}
+	quoteFeedNumbers(raw)
+
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapper eventWrapper
+	if err := json.Unmarshal(buf, &wrapper); err != nil {
+		return nil, err
+	}
+
+	return &wrapper.Event, nil
+}
+
+func quoteFeedNumbers(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if n, ok := value.(json.Number); ok && feedNumberFields[key] {
+				v[key] = string(n)
+				continue
+			}
+			quoteFeedNumbers(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			quoteFeedNumbers(value)
+		}
+	}
+}
+
+// Events reads every event of the feed whose manifest timestamp is strictly
+// greater than since, oldest first, and calls fn for each of them. Use 0 to
+// read the whole feed. Iteration stops at the first error returned by fn.
+//
+// Callers following a feed keep the highest Timestamp seen and pass it back
+// on the next call: the manifest is read again from the feed on each call.
+func (r *FeedReader) Events(since int64, fn func(*Event) error) error {
+	manifest, err := r.readManifest()
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		uuid      string
+		timestamp int64
+	}
+
+	var entries []entry
+	for uuid, e := range manifest {
+		ts, _ := e.Timestamp.Int64()
+		if ts > since {
+			entries = append(entries, entry{uuid, ts})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].timestamp != entries[j].timestamp {
+			return entries[i].timestamp < entries[j].timestamp
+		}
+		return entries[i].uuid < entries[j].uuid
+	})
+
+	for _, e := range entries {
+		event, err := r.Event(e.uuid)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the UUIDs of the events holding an attribute with the given
+// value, using the hashes.csv file of the feed
+func (r *FeedReader) Lookup(value string) ([]string, error) {
+	if r.hashes == nil {
+		if err := r.loadHashes(); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := md5.Sum([]byte(value))
+	return r.hashes[hex.EncodeToString(sum[:])], nil
+}
+
+func (r *FeedReader) loadHashes() error {
+	f, err := r.fsys.Open(FeedHashesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hashes := make(map[string][]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: invalid line %q", FeedHashesFile, line, text)
+		}
+
+		hash := strings.ToLower(fields[0])
+		hashes[hash] = append(hashes[hash], fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	r.hashes = hashes
+
+	return nil
+}
+
+// HTTPFS is a read-only fs.FS serving the files published under BaseURL,
+// it allows to read feeds from a web server
+type HTTPFS struct {
+	BaseURL *url.URL
+
+	// Client used to send the requests, http.DefaultClient when nil
+	Client *http.Client
+
+	// Header is added to every request, for example for authentication
+	Header http.Header
+}
+
+// Open fetches the file with a GET request
+func (h *HTTPFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	u := *h.BaseURL
+	u.Path = path.Join("/", u.Path, name)
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+
+	httpClient := h.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	default:
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("server replied status=%d", resp.StatusCode)}
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return &httpFile{
+		body: resp.Body,
+		info: httpFileInfo{
+			name:    path.Base(name),
+			size:    resp.ContentLength,
+			modTime: modTime,
+		},
+	}, nil
+}
+
+type httpFile struct {
+	body io.ReadCloser
+	info httpFileInfo
+}
+
+func (f *httpFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *httpFile) Read(p []byte) (int, error) { return f.body.Read(p) }
+func (f *httpFile) Close() error               { return f.body.Close() }
+
+type httpFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi httpFileInfo) Name() string       { return fi.name }
+func (fi httpFileInfo) Size() int64        { return fi.size }
+func (fi httpFileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi httpFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi httpFileInfo) IsDir() bool        { return false }
+func (fi httpFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,152 @@
+package misp
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+var testFeed = fstest.MapFS{
+	"manifest.json": {Data: []byte(`{
+		"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101": {"info": "Foobar campaign", "Orgc": {"name": "CIRCL", "uuid": "55f6ea5e-2c60-40e5-964f-47a8950d210f"}, "analysis": "2", "threat_level_id": "3", "timestamp": "1579110170", "date": "2020-01-15", "Tag": [{"name": "tlp:white", "colour": "#ffffff"}]},
+		"5e2a1b6c-9d1c-4c8e-8f0d-2c4d0a3ac101": {"info": "Bazqux phishing", "Orgc": {"name": "CIRCL", "uuid": "55f6ea5e-2c60-40e5-964f-47a8950d210f"}, "analysis": 0, "threat_level_id": 1, "timestamp": 1579800000, "date": "2020-01-23"}
+	}`)},
+	"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101.json": {Data: []byte(`{"Event": {
+		"uuid": "5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101", "info": "Foobar campaign", "timestamp": "1579110170", "published": true,
+		"Attribute": [{"uuid": "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101", "type": "domain", "category": "Network activity", "value": "foobar.com", "to_ids": true, "timestamp": "1579110170"}],
+		"Object": [{"name": "file", "meta-category": "file", "template_version": 17, "uuid": "5e1f4f1c-2222-4a1e-9fba-5b2a0a3ac101", "Attribute": [{"type": "md5", "object_relation": "md5", "value": "68b329da9893e34099c7d8ad5cb9c940", "timestamp": 1579110170}]}]
+	}}`)},
+	"5e2a1b6c-9d1c-4c8e-8f0d-2c4d0a3ac101.json": {Data: []byte(`{"Event": {
+		"uuid": "5e2a1b6c-9d1c-4c8e-8f0d-2c4d0a3ac101", "info": "Bazqux phishing", "timestamp": 1579800000,
+		"Attribute": [{"type": "email-src", "category": "Payload delivery", "value": "bad@bazqux.com", "timestamp": 1579800000}]
+	}}`)},
+	// md5("foobar.com") and md5("68b329da9893e34099c7d8ad5cb9c940")
+	"hashes.csv": {Data: []byte("0ea368ae3a44dc2058f4e661d307f5b8,5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101\n" +
+		"8c67dbaf0ba22f2e7fbc26413b86051b,5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101\n")},
+}
+
+func TestFeedReader(t *testing.T) {
+	testFeedReader(t, NewFeedReader(testFeed))
+}
+
+func TestFeedReaderFollow(t *testing.T) {
+	feed := fstest.MapFS{}
+	for name, file := range testFeed {
+		feed[name] = file
+	}
+	feed["manifest.json"] = &fstest.MapFile{Data: []byte(`{
+		"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101": {"info": "Foobar campaign", "timestamp": "1579110170"}
+	}`)}
+
+	r := NewFeedReader(feed)
+	read := func(since int64) []string {
+		var uuids []string
+		err := r.Events(since, func(e *Event) error {
+			uuids = append(uuids, e.UUID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Events returned an error: %s", err)
+		}
+		return uuids
+	}
+
+	if uuids := read(0); len(uuids) != 1 {
+		t.Fatalf("Events(0) read %v", uuids)
+	}
+
+	// An event published on the feed after the first call
+	feed["manifest.json"] = testFeed["manifest.json"]
+	want := []string{"5e2a1b6c-9d1c-4c8e-8f0d-2c4d0a3ac101"}
+	if uuids := read(1579110170); !reflect.DeepEqual(uuids, want) {
+		t.Errorf("Events(1579110170) read %v, want %v", uuids, want)
+	}
+	if manifest, _ := r.Manifest(); len(manifest) != 2 {
+		t.Errorf("Manifest returned %d events after Events", len(manifest))
+	}
+}
+
+func TestHTTPFeedReader(t *testing.T) {
+	server := httptest.NewServer(http.StripPrefix("/feed/", http.FileServer(http.FS(testFeed))))
+	defer server.Close()
+
+	r, err := NewHTTPFeedReader(server.URL+"/feed/", nil)
+	if err != nil {
+		t.Fatalf("NewHTTPFeedReader returned an error: %s", err)
+	}
+
+	testFeedReader(t, r)
+
+	if _, err := r.Event("5e000000-0000-0000-0000-000000000000"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Event() of an unknown UUID returned %v, want fs.ErrNotExist", err)
+	}
+}
+
+func testFeedReader(t *testing.T, r *FeedReader) {
+	manifest, err := r.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest returned an error: %s", err)
+	}
+
+	e, ok := manifest["5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101"]
+	if !ok || len(manifest) != 2 {
+		t.Fatalf("Manifest returned %+v", manifest)
+	}
+	if e.UUID != "5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101" || e.Orgc.Name != "CIRCL" || e.Tag[0].Name != "tlp:white" {
+		t.Errorf("Manifest entry is %+v", e)
+	}
+
+	var uuids []string
+	err = r.Events(0, func(e *Event) error {
+		uuids = append(uuids, e.UUID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Events returned an error: %s", err)
+	}
+
+	want := []string{"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101", "5e2a1b6c-9d1c-4c8e-8f0d-2c4d0a3ac101"}
+	if !reflect.DeepEqual(uuids, want) {
+		t.Errorf("Events(0) read %v, want %v", uuids, want)
+	}
+
+	uuids = nil
+	err = r.Events(1579110170, func(e *Event) error {
+		uuids = append(uuids, e.UUID)
+		if len(e.Attribute) != 1 || e.Attribute[0].Value != "bad@bazqux.com" {
+			t.Errorf("Event %s has attributes %+v", e.UUID, e.Attribute)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Events returned an error: %s", err)
+	}
+	if !reflect.DeepEqual(uuids, want[1:]) {
+		t.Errorf("Events(1579110170) read %v, want %v", uuids, want[1:])
+	}
+
+	event, err := r.Event("5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101")
+	if err != nil {
+		t.Fatalf("Event returned an error: %s", err)
+	}
+	if len(event.Object) != 1 || event.Object[0].Attribute[0].Value != "68b329da9893e34099c7d8ad5cb9c940" {
+		t.Errorf("Event returned objects %+v", event.Object)
+	}
+
+	// Numbers written by other tools are read as strings
+	if obj := event.Object[0]; obj.TemplateVersion != "17" || obj.Attribute[0].Timestamp != "1579110170" {
+		t.Errorf("Event returned the object %+v", obj)
+	}
+
+	found, err := r.Lookup("foobar.com")
+	if err != nil {
+		t.Fatalf("Lookup returned an error: %s", err)
+	}
+	if !reflect.DeepEqual(found, want[:1]) {
+		t.Errorf("Lookup returned %v", found)
+	}
+}
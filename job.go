@@ -0,0 +1,221 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultJobPollInterval is the delay between two checks of a background
+// job when Client.JobPollInterval is not set
+const DefaultJobPollInterval = 2 * time.Second
+
+// JobStatus is the state of a background job
+type JobStatus string
+
+// Job states
+const (
+	JobStatusWaiting   JobStatus = "1"
+	JobStatusRunning   JobStatus = "2"
+	JobStatusFailed    JobStatus = "3"
+	JobStatusCompleted JobStatus = "4"
+)
+
+var jobStatusNames = map[JobStatus]string{
+	JobStatusWaiting:   "Waiting",
+	JobStatusRunning:   "Running",
+	JobStatusFailed:    "Failed",
+	JobStatusCompleted: "Completed",
+}
+
+// String returns the name of the job state
+func (s JobStatus) String() string {
+	if name, ok := jobStatusNames[s]; ok {
+		return name
+	}
+
+	return string(s)
+}
+
+// Done tells if the job is finished, successfully or not
+func (s JobStatus) Done() bool {
+	return s == JobStatusFailed || s == JobStatusCompleted
+}
+
+// UnmarshalJSON accepts both strings and integers, and the names of the
+// states returned by /jobs/getStatus
+func (s *JobStatus) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalEnum(data)
+	*s = JobStatus(v)
+	for status, name := range jobStatusNames {
+		if strings.EqualFold(v, name) {
+			*s = status
+		}
+	}
+	if strings.EqualFold(v, "Queued") {
+		*s = JobStatusWaiting
+	}
+
+	return err
+}
+
+// Job is a task run in the background by the workers of the server
+type Job struct {
+	ID           string      `json:"id"`
+	Worker       string      `json:"worker,omitempty"`
+	JobType      string      `json:"job_type,omitempty"`
+	JobInput     string      `json:"job_input,omitempty"`
+	Status       JobStatus   `json:"status,omitempty"`
+	Retries      json.Number `json:"retries,omitempty"`
+	Message      string      `json:"message,omitempty"`
+	Progress     json.Number `json:"progress,omitempty"`
+	OrgID        string      `json:"org_id,omitempty"`
+	ProcessID    string      `json:"process_id,omitempty"`
+	DateCreated  string      `json:"date_created,omitempty"`
+	DateModified string      `json:"date_modified,omitempty"`
+}
+
+// Percent returns the progress of the job, between 0 and 100
+func (j *Job) Percent() int {
+	n, _ := j.Progress.Int64()
+	return int(n)
+}
+
+type jobWrapper struct {
+	Job Job `json:"Job"`
+}
+
+// ListJobs returns the last background jobs
+func (client *Client) ListJobs() ([]Job, error) {
+	var resp []jobWrapper
+	if err := client.call("GET", "/jobs/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, len(resp))
+	for i := range resp {
+		jobs[i] = resp[i].Job
+	}
+
+	return jobs, nil
+}
+
+// GetJob returns the state of the background job with the given ID. The
+// fields other than the ID, the status, the progress and the message are
+// only set by the servers returning the whole job.
+func (client *Client) GetJob(jobID string) (*Job, error) {
+	var raw json.RawMessage
+	if err := client.call("GET", fmt.Sprintf("/jobs/getStatus/%s", jobID), nil, &raw); err != nil {
+		return nil, err
+	}
+
+	// The job, wrapped or not
+	var resp jobWrapper
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	job := resp.Job
+	if job.Status == "" {
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+		}
+	}
+	if job.ID == "" {
+		job.ID = jobID
+	}
+
+	return &job, nil
+}
+
+// WaitForJob polls a background job until it is finished or ctx is done.
+// It returns an error if the job failed.
+func (client *Client) WaitForJob(ctx context.Context, jobID string) (*Job, error) {
+	interval := client.JobPollInterval
+	if interval <= 0 {
+		interval = DefaultJobPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := client.GetJob(jobID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch job.Status {
+		case JobStatusCompleted:
+			return job, nil
+		case JobStatusFailed:
+			return job, fmt.Errorf("job %s failed: %s", jobID, job.Message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// JobHandle is returned by the calls starting a background job
+type JobHandle struct {
+	// ID of the job, empty when the server did not queue a job (the work
+	// was done synchronously, e.g. when background workers are disabled)
+	ID string
+
+	// Message returned by the server when starting the job
+	Message string
+
+	client *Client
+}
+
+var jobIDRegexp = regexp.MustCompile(`Job ID: (\d+)`)
+
+func (client *Client) newJobHandle(message string) *JobHandle {
+	h := &JobHandle{Message: message, client: client}
+	if m := jobIDRegexp.FindStringSubmatch(message); m != nil {
+		h.ID = m[1]
+	}
+
+	return h
+}
+
+// Queued tells if the work runs in a background job
+func (h *JobHandle) Queued() bool {
+	return h.ID != ""
+}
+
+// Job returns the current state of the job
+func (h *JobHandle) Job() (*Job, error) {
+	if !h.Queued() {
+		return nil, fmt.Errorf("no job was queued: %s", h.Message)
+	}
+
+	return h.client.GetJob(h.ID)
+}
+
+// Wait blocks until the job is finished or ctx is done. It returns
+// immediately when no job was queued.
+func (h *JobHandle) Wait(ctx context.Context) error {
+	if !h.Queued() {
+		return nil
+	}
+
+	_, err := h.client.WaitForJob(ctx, h.ID)
+	return err
+}
+
+// jobAction calls an endpoint starting a background job
+func (client *Client) jobAction(path string) (*JobHandle, error) {
+	var resp actionResponse
+	if err := client.call("GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return client.newJobHandle(resp.message()), nil
+}
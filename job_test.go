@@ -0,0 +1,121 @@
+package misp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListJobs(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/jobs/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[{"Job":{"id":"42","worker":"default","job_type":"fetch_feeds","job_input":"Feed: 1","status":"2","retries":"0","message":"Fetching events.","progress":"35","org_id":"1"}},{"Job":{"id":"41","job_type":"cache_feeds","status":4,"progress":100}}]`)
+		})
+
+	jobs, err := client.ListJobs()
+	if err != nil {
+		t.Fatalf("ListJobs returned an error: %s", err)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("ListJobs returned %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].Status != JobStatusRunning || jobs[0].Percent() != 35 || jobs[0].Status.Done() {
+		t.Errorf("ListJobs returned %+v", jobs[0])
+	}
+	if jobs[1].Status != JobStatusCompleted || jobs[1].Percent() != 100 || jobs[1].Status.String() != "Completed" {
+		t.Errorf("ListJobs returned %+v", jobs[1])
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	setup()
+	client.JobPollInterval = time.Millisecond
+
+	polls := 0
+	mux.HandleFunc("/jobs/getStatus/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			polls++
+			if polls < 3 {
+				fmt.Fprintf(w, `{"Job":{"id":"42","status":"2","progress":"%d"}}`, polls*30)
+				return
+			}
+			fmt.Fprint(w, `{"status":"Completed","progress":100,"message":"Job done."}`)
+		})
+	mux.HandleFunc("/jobs/getStatus/43",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"Job":{"id":"43","status":"3","message":"Could not fetch the feed."}}`)
+		})
+	mux.HandleFunc("/jobs/getStatus/44",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"status":"Queued"}`)
+		})
+
+	job, err := client.WaitForJob(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("WaitForJob returned an error: %s", err)
+	}
+	if polls != 3 || job.ID != "42" || job.Status != JobStatusCompleted || job.Percent() != 100 || job.Message != "Job done." {
+		t.Errorf("WaitForJob returned %+v after %d polls", job, polls)
+	}
+
+	if _, err := client.WaitForJob(context.Background(), "43"); err == nil {
+		t.Errorf("WaitForJob did not return an error for a failed job")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.WaitForJob(ctx, "44"); err != context.DeadlineExceeded {
+		t.Errorf("WaitForJob returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestJobHandle(t *testing.T) {
+	setup()
+	client.JobPollInterval = time.Millisecond
+
+	mux.HandleFunc("/feeds/cacheFeeds/all",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"name":"Feed caching job initiated.","message":"Feed caching job initiated. Job ID: 7","url":"\/feeds\/cacheFeeds\/all"}`)
+		})
+	mux.HandleFunc("/feeds/fetchFromAllFeeds",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"name":"Fetched","message":"Fetching the feeds done.","url":"\/feeds\/fetchFromAllFeeds"}`)
+		})
+	mux.HandleFunc("/jobs/getStatus/7",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"Job":{"id":"7","status":"4"}}`)
+		})
+
+	h, err := client.CacheFeeds("all")
+	if err != nil {
+		t.Fatalf("CacheFeeds returned an error: %s", err)
+	}
+	if h.ID != "7" {
+		t.Errorf("CacheFeeds returned job %q, want 7", h.ID)
+	}
+	if err := h.Wait(context.Background()); err != nil {
+		t.Errorf("Wait returned an error: %s", err)
+	}
+
+	h, err = client.FetchAllFeeds()
+	if err != nil {
+		t.Fatalf("FetchAllFeeds returned an error: %s", err)
+	}
+	if h.Queued() {
+		t.Errorf("FetchAllFeeds returned a queued job %+v", h)
+	}
+	if err := h.Wait(context.Background()); err != nil {
+		t.Errorf("Wait returned an error for a synchronous action: %s", err)
+	}
+	if _, err := h.Job(); err == nil {
+		t.Errorf("Job did not return an error when no job was queued")
+	}
+}
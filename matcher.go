@@ -0,0 +1,406 @@
+package misp
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// IOCMatch is an attribute matching a value, with the metadata of its
+// event when known
+type IOCMatch struct {
+	Attribute *Attribute
+	Event     *Event
+}
+
+// IOCMatcher matches values, such as the fields of logs, against a set of
+// attributes without calling the server:
+//
+//   - ip-src and ip-dst attributes match the addresses of their network
+//   - domain attributes match the domain and its subdomains, hostname
+//     attributes only the host itself
+//   - url attributes match the URLs equal once normalised: without scheme,
+//     default port and fragment, with the host in lower case
+//   - hashes and email addresses are compared without case, the other
+//     types exactly
+//
+// Composite attributes (such as "domain|ip" or "filename|md5") match each
+// of their parts. The attributes can be replaced at any time with Load or
+// Reload, the lookups in progress completing on the previous set.
+//
+// The returned attributes and events are shared between the lookups, and
+// must not be modified.
+type IOCMatcher struct {
+	index atomic.Value // *iocIndex
+}
+
+// iocIndex is an immutable set of attributes indexed by kind of value
+type iocIndex struct {
+	count int
+
+	// Values compared exactly, and in lower case
+	exact  map[string][]*IOCMatch
+	folded map[string][]*IOCMatch
+
+	// Domains matching their subdomains, hosts only matching themselves
+	domains map[string][]*IOCMatch
+	hosts   map[string][]*IOCMatch
+
+	urls map[string][]*IOCMatch
+
+	ipv4, ipv6 ipTrie
+}
+
+// foldedIOCTypes are the types compared without case
+var foldedIOCTypes = map[string]bool{
+	"md5":                    true,
+	"sha1":                   true,
+	"sha224":                 true,
+	"sha256":                 true,
+	"sha384":                 true,
+	"sha512":                 true,
+	"sha512/224":             true,
+	"sha512/256":             true,
+	"sha3-224":               true,
+	"sha3-256":               true,
+	"sha3-384":               true,
+	"sha3-512":               true,
+	"imphash":                true,
+	"impfuzzy":               true,
+	"authentihash":           true,
+	"pehash":                 true,
+	"tlsh":                   true,
+	"ja3-fingerprint-md5":    true,
+	"jarm-fingerprint":       true,
+	"hassh-md5":              true,
+	"hasshserver-md5":        true,
+	"email":                  true,
+	"email-src":              true,
+	"email-dst":              true,
+	"target-email":           true,
+	"whois-registrant-email": true,
+}
+
+// NewIOCMatcher returns a matcher of attrs. The event of each match is the
+// Event of its attribute, set by searches with IncludeContext.
+func NewIOCMatcher(attrs []Attribute) *IOCMatcher {
+	m := &IOCMatcher{}
+	m.Load(attrs)
+
+	return m
+}
+
+// Load replaces the attributes of the matcher. Deleted attributes are
+// skipped.
+func (m *IOCMatcher) Load(attrs []Attribute) {
+	x := &iocIndex{
+		exact:   make(map[string][]*IOCMatch),
+		folded:  make(map[string][]*IOCMatch),
+		domains: make(map[string][]*IOCMatch),
+		hosts:   make(map[string][]*IOCMatch),
+		urls:    make(map[string][]*IOCMatch),
+	}
+
+	for i := range attrs {
+		attr := attrs[i]
+		if attr.Deleted {
+			continue
+		}
+		x.add(&IOCMatch{Attribute: &attr, Event: attr.Event})
+	}
+
+	m.index.Store(x)
+}
+
+// Reload replaces the attributes of the matcher by the results of a
+// search, with their event. The matcher is unchanged on error.
+func (m *IOCMatcher) Reload(client *Client, q *AttributeQuery) error {
+	req := *q
+	req.IncludeContext = "1"
+
+	attrs, err := client.SearchAttribute(&req)
+	if err != nil {
+		return err
+	}
+	m.Load(attrs)
+
+	return nil
+}
+
+// Len returns the number of attributes of the matcher
+func (m *IOCMatcher) Len() int {
+	if x := m.load(); x != nil {
+		return x.count
+	}
+
+	return 0
+}
+
+func (m *IOCMatcher) load() *iocIndex {
+	x, _ := m.index.Load().(*iocIndex)
+	return x
+}
+
+func (x *iocIndex) add(match *IOCMatch) {
+	attr := match.Attribute
+	x.count++
+
+	types := strings.Split(attr.Type, "|")
+	values := []string{attr.Value}
+	if len(types) > 1 {
+		values = strings.SplitN(attr.Value, "|", len(types))
+	}
+
+	for i, t := range types {
+		if i >= len(values) {
+			break
+		}
+		value := strings.TrimSpace(values[i])
+		if value == "" {
+			continue
+		}
+
+		switch {
+		case t == "ip-src" || t == "ip-dst" || t == "ip":
+			if n, err := parseCIDR(value); err == nil {
+				if ip4, ones, ok := ipv4Prefix(n); ok {
+					x.ipv4.insert(ip4, ones, match)
+				} else {
+					ones, _ := n.Mask.Size()
+					x.ipv6.insert(n.IP.To16(), ones, match)
+				}
+			}
+		case t == "domain":
+			name := strings.TrimPrefix(normalizeHostname(value), "*.")
+			x.domains[name] = append(x.domains[name], match)
+		case t == "hostname":
+			name := normalizeHostname(value)
+			x.hosts[name] = append(x.hosts[name], match)
+		case t == "url" || t == "link":
+			key := normalizeIOCURL(value)
+			x.urls[key] = append(x.urls[key], match)
+		case t == "port":
+			// Too common to be matched alone
+		case foldedIOCTypes[t]:
+			key := strings.ToLower(value)
+			x.folded[key] = append(x.folded[key], match)
+		default:
+			x.exact[value] = append(x.exact[value], match)
+		}
+	}
+}
+
+// ipv4Prefix returns the IPv4 address and prefix length of n, including
+// the IPv4-mapped IPv6 networks of at least 96 bits such as
+// ::ffff:10.0.0.0/104
+func ipv4Prefix(n *net.IPNet) (net.IP, int, bool) {
+	ip4 := n.IP.To4()
+	if ip4 == nil {
+		return nil, 0, false
+	}
+
+	ones, bits := n.Mask.Size()
+	if bits == 128 {
+		if ones < 96 {
+			return nil, 0, false
+		}
+		ones -= 96
+	}
+
+	return ip4, ones, true
+}
+
+// normalizeIOCURL returns the key of a URL, with or without scheme: the
+// host in lower case, its port unless the default one, the path and the
+// query
+func normalizeIOCURL(s string) string {
+	u, err := parseIOCURL(s)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+
+	key := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		key += ":" + port
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key += path
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+
+	return key
+}
+
+func parseIOCURL(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	return url.Parse(s)
+}
+
+// iocMatches collects the matches of a lookup without duplicates
+type iocMatches struct {
+	found []IOCMatch
+	seen  map[*IOCMatch]bool
+}
+
+func (r *iocMatches) add(matches []*IOCMatch) {
+	for _, match := range matches {
+		if r.seen == nil {
+			r.seen = make(map[*IOCMatch]bool)
+		}
+		if r.seen[match] {
+			continue
+		}
+		r.seen[match] = true
+		r.found = append(r.found, *match)
+	}
+}
+
+// Match returns the attributes matching value, whatever its kind: an
+// address, a host name, a URL, or any other value
+func (m *IOCMatcher) Match(value string) []IOCMatch {
+	x := m.load()
+	if x == nil {
+		return nil
+	}
+
+	value = strings.TrimSpace(value)
+
+	var r iocMatches
+	if ip := net.ParseIP(value); ip != nil {
+		x.matchIP(&r, ip)
+		return r.found
+	}
+
+	r.add(x.exact[value])
+	r.add(x.folded[strings.ToLower(value)])
+	if strings.Contains(value, "/") {
+		x.matchURL(&r, value)
+	} else if strings.Contains(value, ".") {
+		x.matchHost(&r, value)
+	}
+
+	return r.found
+}
+
+// MatchIP returns the ip-src and ip-dst attributes whose network contains
+// ip
+func (m *IOCMatcher) MatchIP(ip net.IP) []IOCMatch {
+	x := m.load()
+	if x == nil {
+		return nil
+	}
+
+	var r iocMatches
+	x.matchIP(&r, ip)
+
+	return r.found
+}
+
+// MatchHost returns the hostname attributes equal to name, and the domain
+// attributes of name or of its parent domains
+func (m *IOCMatcher) MatchHost(name string) []IOCMatch {
+	x := m.load()
+	if x == nil {
+		return nil
+	}
+
+	var r iocMatches
+	x.matchHost(&r, name)
+
+	return r.found
+}
+
+// MatchURL returns the url attributes equal to rawurl once normalised, and
+// the attributes matching its host
+func (m *IOCMatcher) MatchURL(rawurl string) []IOCMatch {
+	x := m.load()
+	if x == nil {
+		return nil
+	}
+
+	var r iocMatches
+	x.matchURL(&r, rawurl)
+
+	return r.found
+}
+
+func (x *iocIndex) matchIP(r *iocMatches, ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		x.ipv4.lookup(ip4, r)
+	} else if ip16 := ip.To16(); ip16 != nil {
+		x.ipv6.lookup(ip16, r)
+	}
+}
+
+func (x *iocIndex) matchHost(r *iocMatches, name string) {
+	name = normalizeHostname(name)
+	r.add(x.hosts[name])
+
+	for {
+		r.add(x.domains[name])
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return
+		}
+		name = name[i+1:]
+	}
+}
+
+func (x *iocIndex) matchURL(r *iocMatches, rawurl string) {
+	r.add(x.urls[normalizeIOCURL(rawurl)])
+
+	u, err := parseIOCURL(rawurl)
+	if err != nil {
+		return
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		x.matchIP(r, ip)
+	} else if host := u.Hostname(); host != "" {
+		x.matchHost(r, host)
+	}
+}
+
+// ipTrie is a binary radix tree of networks, each node holding the
+// attributes of the network of its path
+type ipTrie struct {
+	root ipTrieNode
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	matches  []*IOCMatch
+}
+
+func (t *ipTrie) insert(ip net.IP, ones int, match *IOCMatch) {
+	n := &t.root
+	for i := 0; i < ones; i++ {
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &ipTrieNode{}
+		}
+		n = n.children[bit]
+	}
+	n.matches = append(n.matches, match)
+}
+
+// lookup adds the attributes of all the networks containing ip
+func (t *ipTrie) lookup(ip net.IP, r *iocMatches) {
+	n := &t.root
+	for i := 0; n != nil; i++ {
+		r.add(n.matches)
+		if i == len(ip)*8 {
+			return
+		}
+		n = n.children[ip[i/8]>>(7-uint(i%8))&1]
+	}
+}
@@ -0,0 +1,155 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func matchedUUIDs(matches []IOCMatch) string {
+	uuids := make([]string, len(matches))
+	for i, match := range matches {
+		uuids[i] = match.Attribute.UUID
+	}
+	sort.Strings(uuids)
+
+	return strings.Join(uuids, ",")
+}
+
+func TestIOCMatcher(t *testing.T) {
+	event := &Event{ID: "12", UUID: "5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101", Info: "Foobar campaign"}
+	m := NewIOCMatcher([]Attribute{
+		{UUID: "ip", Type: "ip-dst", Value: "198.51.100.7", Event: event},
+		{UUID: "net", Type: "ip-src", Value: "198.51.100.0/24"},
+		{UUID: "net6", Type: "ip-dst", Value: "2001:db8::/32"},
+		{UUID: "domain", Type: "domain", Value: "Foo.Example."},
+		{UUID: "host", Type: "hostname", Value: "www.bar.example"},
+		{UUID: "url", Type: "url", Value: "https://baz.example:443/login?user=1#top"},
+		{UUID: "md5", Type: "md5", Value: "D41D8CD98F00B204E9800998ECF8427E"},
+		{UUID: "file", Type: "filename|sha1", Value: "Evil.exe|da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+		{UUID: "pair", Type: "domain|ip", Value: "qux.example|203.0.113.9"},
+		{UUID: "ua", Type: "user-agent", Value: "Mozilla/4.0 (Evil)"},
+		{UUID: "deleted", Type: "domain", Value: "gone.example", Deleted: true},
+		{UUID: "mapped", Type: "ip-dst", Value: "::ffff:10.0.0.0/104"},
+		{UUID: "mapped6", Type: "ip-dst", Value: "::ffff:0:0/95"},
+	})
+	if m.Len() != 12 {
+		t.Errorf("Len returned %d", m.Len())
+	}
+
+	tests := map[string]string{
+		"198.51.100.7":                             "ip,net",
+		"198.51.100.8":                             "net",
+		"198.51.101.1":                             "",
+		"::ffff:198.51.100.8":                      "net",
+		"2001:db8:1::1":                            "net6",
+		"203.0.113.9":                              "pair",
+		"foo.example":                              "domain",
+		"a.b.FOO.example":                          "domain",
+		"barfoo.example":                           "",
+		"www.bar.example":                          "host",
+		"sub.www.bar.example":                      "",
+		"qux.example":                              "pair",
+		"gone.example":                             "",
+		"http://BAZ.example/login?user=1":          "url",
+		"baz.example/login?user=1":                 "url",
+		"https://baz.example/login?user=2":         "",
+		"https://sub.foo.example/index.html":       "domain",
+		"http://198.51.100.7:8080/payload":         "ip,net",
+		"d41d8cd98f00b204e9800998ecf8427e":         "md5",
+		"DA39A3EE5E6B4B0D3255BFEF95601890AFD80709": "file",
+		"Evil.exe":                                 "file",
+		"evil.exe":                                 "",
+		"Mozilla/4.0 (Evil)":                       "ua",
+		"10.1.2.3":                                 "mapped",
+		"::ffff:10.1.2.3":                          "mapped",
+		"11.1.2.3":                                 "",
+		"::fffe:1:1":                               "mapped6",
+	}
+	for value, want := range tests {
+		if got := matchedUUIDs(m.Match(value)); got != want {
+			t.Errorf("Match(%q) returned %s, want %s", value, got, want)
+		}
+	}
+
+	// From the widest network to the address
+	if matches := m.MatchIP(net.ParseIP("198.51.100.7")); len(matches) != 2 {
+		t.Errorf("MatchIP returned %v", matches)
+	} else if matches[1].Attribute.UUID != "ip" || matches[1].Event != event {
+		t.Errorf("MatchIP returned %+v", matches[1])
+	}
+	if got := matchedUUIDs(m.MatchHost("x.foo.example")); got != "domain" {
+		t.Errorf("MatchHost returned %s", got)
+	}
+	if got := matchedUUIDs(m.MatchURL("www.bar.example/foo")); got != "host" {
+		t.Errorf("MatchURL returned %s", got)
+	}
+
+	var empty IOCMatcher
+	if empty.Match("198.51.100.7") != nil || empty.Len() != 0 {
+		t.Errorf("Empty matcher matched")
+	}
+}
+
+func TestIOCMatcherReload(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	var mu sync.Mutex
+	value := "198.51.100.7"
+	mux.HandleFunc("/attributes/restSearch/json/",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req struct {
+				Request AttributeQuery `json:"request"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Request.IncludeContext != "1" || req.Request.Type != "ip-dst" {
+				t.Errorf("Search request is %+v", req.Request)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, `{"response": {"Attribute": [{"id": "1", "uuid": "a1", "event_id": "12", "type": "ip-dst", "value": %q, "Event": {"id": "12", "info": "Foobar campaign", "uuid": "5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101"}}]}}`, value)
+		})
+
+	m := &IOCMatcher{}
+	q := &AttributeQuery{Type: "ip-dst"}
+	if err := m.Reload(client, q); err != nil {
+		t.Fatalf("Reload returned an error: %s", err)
+	}
+	matches := m.Match("198.51.100.7")
+	if len(matches) != 1 || matches[0].Event == nil || matches[0].Event.Info != "Foobar campaign" {
+		t.Fatalf("Match returned %+v", matches)
+	}
+
+	// Lookups running during the reload
+	mu.Lock()
+	value = "203.0.113.9"
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Match("198.51.100.7")
+			}
+		}()
+	}
+	if err := m.Reload(client, q); err != nil {
+		t.Fatalf("Reload returned an error: %s", err)
+	}
+	wg.Wait()
+
+	if len(m.Match("198.51.100.7")) != 0 || len(m.Match("203.0.113.9")) != 1 {
+		t.Errorf("Reload did not replace the attributes")
+	}
+}
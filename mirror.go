@@ -0,0 +1,417 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mirror is a local copy of the events and attributes of a MISP server,
+// kept in a JSON file and synchronised by timestamp pulls, to query them
+// offline.
+//
+// Events are mirrored with their metadata and tags, attributes separately:
+// the event of an attribute is found by its EventID.
+//
+// The whole mirror is held in memory, rewritten to a single file by each
+// sync, and queried by scanning every attribute: it suits the subsets of
+// a server of up to a few hundred thousand attributes, not the mirroring
+// of a whole instance. Its cursor is never compacted, as the deletions of
+// the attributes would be missed.
+type Mirror struct {
+	// Client of the mirrored server, only needed by Sync
+	Client *Client
+
+	// Path of the file of the mirror
+	Path string
+
+	// PageSize of the searches, DefaultChangeFeedPageSize when zero
+	PageSize int
+
+	// CheckDeletedEvents lists the events at each sync to remove the
+	// deleted ones, and those no longer matching EventQuery
+	CheckDeletedEvents bool
+
+	// EventQuery and AttributeQuery restrict the mirrored elements, as
+	// those of ChangeFeed
+	EventQuery     EventQuery
+	AttributeQuery AttributeQuery
+
+	syncMu sync.Mutex // serialises the syncs
+
+	mu    sync.RWMutex
+	state mirrorState
+
+	// Event IDs to UUIDs
+	eventUUIDs map[string]string
+}
+
+// mirrorState is the content of the file of a Mirror
+type mirrorState struct {
+	Cursor     *ChangeCursor         `json:"cursor"`
+	Events     map[string]*Event     `json:"events"`
+	Attributes map[string]*Attribute `json:"attributes"`
+}
+
+// OpenMirror opens the mirror kept in path, empty when the file does not
+// exist yet
+func OpenMirror(client *Client, path string) (*Mirror, error) {
+	m := &Mirror{Client: client, Path: path}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(buf, &m.state); err != nil {
+			return nil, fmt.Errorf("Could not decode mirror %s: %s", path, err)
+		}
+	}
+
+	if m.state.Cursor == nil {
+		m.state.Cursor = NewChangeCursor(time.Time{})
+	}
+	if m.state.Cursor.Events == nil {
+		m.state.Cursor.Events = make(map[string]int64)
+	}
+	if m.state.Cursor.Attributes == nil {
+		m.state.Cursor.Attributes = make(map[string]int64)
+	}
+	if m.state.Events == nil {
+		m.state.Events = make(map[string]*Event)
+	}
+	if m.state.Attributes == nil {
+		m.state.Attributes = make(map[string]*Attribute)
+	}
+
+	m.eventUUIDs = make(map[string]string)
+	for uuid, event := range m.state.Events {
+		m.eventUUIDs[event.ID] = uuid
+	}
+
+	return m, nil
+}
+
+// Sync pulls the changes since the previous sync, and saves the mirror. It
+// returns the number of changes applied.
+func (m *Mirror) Sync(ctx context.Context) (int, error) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+
+	feed := &ChangeFeed{
+		Client:             m.Client,
+		Cursor:             m.state.Cursor,
+		PageSize:           m.PageSize,
+		CheckDeletedEvents: m.CheckDeletedEvents,
+		EventQuery:         m.EventQuery,
+		AttributeQuery:     m.AttributeQuery,
+	}
+
+	ch := make(chan Change)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for c := range ch {
+			m.apply(c)
+			n++
+		}
+		done <- n
+	}()
+
+	err := feed.Poll(ctx, ch)
+	close(ch)
+	n := <-done
+	if err != nil {
+		return n, err
+	}
+
+	return n, m.Save()
+}
+
+func (m *Mirror) apply(c Change) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case c.Event != nil && (c.Kind == ChangeDeleted || c.Kind == ChangeRemoved):
+		event, ok := m.state.Events[c.Event.UUID]
+		if !ok {
+			return
+		}
+		delete(m.state.Events, c.Event.UUID)
+		delete(m.eventUUIDs, event.ID)
+		for uuid, attr := range m.state.Attributes {
+			if attr.EventID == event.ID {
+				delete(m.state.Attributes, uuid)
+			}
+		}
+	case c.Event != nil:
+		m.state.Events[c.Event.UUID] = c.Event
+		m.eventUUIDs[c.Event.ID] = c.Event.UUID
+	case c.Attribute != nil && c.Kind == ChangeDeleted:
+		delete(m.state.Attributes, c.Attribute.UUID)
+	case c.Attribute != nil:
+		m.state.Attributes[c.Attribute.UUID] = c.Attribute
+	}
+}
+
+// Save writes the mirror to its file. The file is replaced as a whole,
+// its writing taking as long as the encoding of every event and attribute.
+func (m *Mirror) Save() error {
+	m.mu.RLock()
+	buf, err := json.Marshal(&m.state)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(m.Path, buf)
+}
+
+// Event returns the mirrored event with the given ID or UUID
+func (m *Mirror) Event(id string) (*Event, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if uuid, ok := m.eventUUIDs[id]; ok {
+		id = uuid
+	}
+	event, ok := m.state.Events[id]
+
+	return event, ok
+}
+
+// Query returns the mirrored attributes matching q, as SearchAttribute
+// does on the server, ordered by timestamp. The value and the tags accept
+// the % wildcard, and are compared without case. Last and Timestamp are
+// relative to now when not unix timestamps.
+//
+// The fields not about the content of the attributes, such as
+// WithAttachment or ReturnFormat, are ignored. The attributes are not
+// indexed: each query checks all of them.
+func (m *Mirror) Query(q *AttributeQuery) ([]Attribute, error) {
+	f, err := newMirrorFilter(q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	var found []Attribute
+	for _, attr := range m.state.Attributes {
+		var event *Event
+		if uuid, ok := m.eventUUIDs[attr.EventID]; ok {
+			event = m.state.Events[uuid]
+		}
+		if f.match(attr, event) {
+			found = append(found, *attr)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(found, func(i, j int) bool {
+		ti, tj := numberToInt64(json.Number(found[i].Timestamp)), numberToInt64(json.Number(found[j].Timestamp))
+		if ti != tj {
+			return ti < tj
+		}
+		return found[i].UUID < found[j].UUID
+	})
+
+	if q.Limit > 0 {
+		page := q.Page
+		if page < 1 {
+			page = 1
+		}
+		start := (page - 1) * q.Limit
+		if start > len(found) {
+			start = len(found)
+		}
+		end := start + q.Limit
+		if end > len(found) {
+			end = len(found)
+		}
+		found = found[start:end]
+	}
+
+	return found, nil
+}
+
+// mirrorFilter is an AttributeQuery parsed for Mirror.Query
+type mirrorFilter struct {
+	q *AttributeQuery
+
+	// Tags to include (all of them) and to exclude
+	tags, notTags []string
+
+	// Lowest publish timestamp of the events, lowest timestamp of the
+	// attributes
+	published, timestamp int64
+}
+
+func newMirrorFilter(q *AttributeQuery, now time.Time) (*mirrorFilter, error) {
+	f := &mirrorFilter{q: q}
+
+	for _, tag := range strings.Split(q.Tags, "&&") {
+		tag = strings.ReplaceAll(strings.TrimSpace(tag), ";", ":")
+		switch {
+		case tag == "" || tag == "!":
+		case tag[0] == '!':
+			f.notTags = append(f.notTags, tag[1:])
+		default:
+			f.tags = append(f.tags, tag)
+		}
+	}
+
+	var err error
+	if q.Last != "" {
+		if f.published, err = parseMirrorTime(q.Last, now); err != nil {
+			return nil, fmt.Errorf("Invalid last %q: %s", q.Last, err)
+		}
+	}
+	if q.Timestamp != "" {
+		if f.timestamp, err = parseMirrorTime(q.Timestamp, now); err != nil {
+			return nil, fmt.Errorf("Invalid timestamp %q: %s", q.Timestamp, err)
+		}
+	}
+
+	return f, nil
+}
+
+// parseMirrorTime parses a unix timestamp, or a duration before now such
+// as 5d, 12h or 30m
+func parseMirrorTime(s string, now time.Time) (int64, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+
+	if len(s) < 2 {
+		return 0, fmt.Errorf("unknown format")
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown format")
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'd':
+		unit = 24 * time.Hour
+	case 'h':
+		unit = time.Hour
+	case 'm':
+		unit = time.Minute
+	case 's':
+		unit = time.Second
+	default:
+		return 0, fmt.Errorf("unknown unit")
+	}
+
+	return now.Add(-time.Duration(n) * unit).Unix(), nil
+}
+
+func (f *mirrorFilter) match(attr *Attribute, event *Event) bool {
+	q := f.q
+
+	if attr.Deleted {
+		return false
+	}
+	if q.Value != "" && !likeMatch(q.Value, attr.Value) {
+		return false
+	}
+	if q.Type != "" && q.Type != attr.Type {
+		return false
+	}
+	if q.Category != "" && q.Category != attr.Category {
+		return false
+	}
+	if q.EventID != "" && q.EventID != attr.EventID {
+		return false
+	}
+	if q.UUID != "" && q.UUID != attr.UUID && (event == nil || q.UUID != event.UUID) {
+		return false
+	}
+	if f.timestamp != 0 && numberToInt64(json.Number(attr.Timestamp)) < f.timestamp {
+		return false
+	}
+
+	// Filters on the event
+	if q.Org != "" && (event == nil || event.Orgc == nil || q.Org != event.Orgc.ID && !strings.EqualFold(q.Org, event.Orgc.Name)) {
+		return false
+	}
+	if (q.From != "" || q.To != "") && event == nil {
+		return false
+	}
+	if q.From != "" && event.Date < q.From {
+		return false
+	}
+	if q.To != "" && event.Date > q.To {
+		return false
+	}
+	if f.published != 0 && (event == nil || numberToInt64(event.PublishTimestamp) < f.published) {
+		return false
+	}
+
+	// Tags of the attribute and of its event
+	if len(f.tags) == 0 && len(f.notTags) == 0 {
+		return true
+	}
+	tags := attr.Tag
+	if event != nil {
+		tags = append(append([]Tag(nil), tags...), event.Tag...)
+	}
+	for _, pattern := range f.notTags {
+		if hasTagLike(tags, pattern) {
+			return false
+		}
+	}
+	for _, pattern := range f.tags {
+		if !hasTagLike(tags, pattern) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasTagLike(tags []Tag, pattern string) bool {
+	for _, tag := range tags {
+		if likeMatch(pattern, tag.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// likeMatch reports whether s matches pattern without case, % matching any
+// sequence of characters as in the SQL LIKE used by MISP
+func likeMatch(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+
+	parts := strings.Split(pattern, "%")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+
+	return strings.HasSuffix(s, last)
+}
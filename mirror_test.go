@@ -0,0 +1,141 @@
+package misp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func attributeUUIDs(attrs []Attribute) string {
+	uuids := make([]string, len(attrs))
+	for i, attr := range attrs {
+		uuids[i] = attr.UUID
+	}
+
+	return strings.Join(uuids, ",")
+}
+
+func TestMirror(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	s := &changeFeedTestServer{
+		events: []Event{
+			{ID: "1", UUID: "e1", Info: "Foo", Date: "2020-01-10", Timestamp: "100", PublishTimestamp: "100",
+				Orgc: &Organisation{ID: "2", Name: "CIRCL"}, Tag: []Tag{{Name: "tlp:white"}}},
+			{ID: "2", UUID: "e2", Info: "Bar", Date: "2020-02-20", Timestamp: "200", PublishTimestamp: "200",
+				Orgc: &Organisation{ID: "3", Name: "ACME"}, Tag: []Tag{{Name: "tlp:amber"}}},
+		},
+		attributes: []Attribute{
+			{UUID: "a1", EventID: "1", Type: "domain", Category: "Network activity", Value: "foo.example", Timestamp: "100"},
+			{UUID: "a2", EventID: "1", Type: "ip-dst", Category: "Network activity", Value: "198.51.100.7", Timestamp: "110",
+				Tag: []Tag{{Name: "misp-galaxy:threat-actor=\"APT 28\""}}},
+			{UUID: "a3", EventID: "2", Type: "url", Category: "Network activity", Value: "http://bar.example/login", Timestamp: "200"},
+			{UUID: "a4", EventID: "2", Type: "domain", Category: "Network activity", Value: "Bar.Example", Timestamp: "210"},
+		},
+	}
+	s.register(t)
+
+	path := filepath.Join(t.TempDir(), "mirror.json")
+	m, err := OpenMirror(client, path)
+	if err != nil {
+		t.Fatalf("OpenMirror returned an error: %s", err)
+	}
+	m.CheckDeletedEvents = true
+
+	if n, err := m.Sync(context.Background()); err != nil || n != 6 {
+		t.Fatalf("Sync returned %d, %v", n, err)
+	}
+
+	tests := []struct {
+		q    AttributeQuery
+		want string
+	}{
+		{AttributeQuery{}, "a1,a2,a3,a4"},
+		{AttributeQuery{Value: "bar.example"}, "a4"},
+		{AttributeQuery{Value: "%bar.example%"}, "a3,a4"},
+		{AttributeQuery{Type: "domain"}, "a1,a4"},
+		{AttributeQuery{Tags: "tlp;white"}, "a1,a2"},
+		{AttributeQuery{Tags: "!tlp:white"}, "a3,a4"},
+		{AttributeQuery{Tags: "tlp:white&&misp-galaxy:threat-actor=%"}, "a2"},
+		{AttributeQuery{From: "2020-02-01"}, "a3,a4"},
+		{AttributeQuery{To: "2020-01-31"}, "a1,a2"},
+		{AttributeQuery{Org: "acme"}, "a3,a4"},
+		{AttributeQuery{EventID: "1", Timestamp: "105"}, "a2"},
+		{AttributeQuery{UUID: "e2"}, "a3,a4"},
+		{AttributeQuery{Limit: 3, Page: 2}, "a4"},
+		{AttributeQuery{Last: "1d"}, ""},
+	}
+	for _, test := range tests {
+		found, err := m.Query(&test.q)
+		if err != nil {
+			t.Fatalf("Query returned an error: %s", err)
+		}
+		if got := attributeUUIDs(found); got != test.want {
+			t.Errorf("Query(%+v) returned %s, want %s", test.q, got, test.want)
+		}
+	}
+
+	if _, err := m.Query(&AttributeQuery{Last: "1w"}); err == nil {
+		t.Errorf("Query accepted an invalid last")
+	}
+
+	// Changes on the server, synced by a mirror reopened from its file
+	s.events = s.events[:1]
+	s.attributes = s.attributes[:2]
+	s.attributes[0].Timestamp = "300"
+	s.attributes[0].Comment = "sinkholed"
+	s.attributes[1].Timestamp = "300"
+	s.attributes[1].Deleted = true
+
+	m, err = OpenMirror(client, path)
+	if err != nil {
+		t.Fatalf("OpenMirror returned an error: %s", err)
+	}
+	m.CheckDeletedEvents = true
+	if n, err := m.Sync(context.Background()); err != nil || n != 3 {
+		t.Fatalf("Sync returned %d, %v", n, err)
+	}
+
+	found, err := m.Query(&AttributeQuery{})
+	if err != nil {
+		t.Fatalf("Query returned an error: %s", err)
+	}
+	if len(found) != 1 || found[0].UUID != "a1" || found[0].Comment != "sinkholed" {
+		t.Errorf("Query after the sync returned %+v", found)
+	}
+	if event, ok := m.Event("1"); !ok || event.UUID != "e1" {
+		t.Errorf("Event returned %+v", event)
+	}
+	if _, ok := m.Event("e2"); ok {
+		t.Errorf("Deleted event is still mirrored")
+	}
+}
+
+func TestLikeMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"foo.example", "FOO.example", true},
+		{"foo", "foo.example", false},
+		{"%.example", "foo.example", true},
+		{"foo%", "foo.example", true},
+		{"%o.e%", "foo.example", true},
+		{"f%x%e", "foo.example", true},
+		{"a%a", "a", false},
+		{"%", "", true},
+	}
+	for _, test := range tests {
+		if got := likeMatch(test.pattern, test.s); got != test.want {
+			t.Errorf("likeMatch(%q, %q) returned %v", test.pattern, test.s, got)
+		}
+	}
+
+	now := time.Unix(100000, 0)
+	if ts, err := parseMirrorTime("2h", now); err != nil || ts != 100000-7200 {
+		t.Errorf("parseMirrorTime returned %d, %v", ts, err)
+	}
+}
@@ -10,21 +10,29 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Client ... XXX
 type Client struct {
 	BaseURL *url.URL
 	APIKey  string
+
+	// JobPollInterval is the delay between two checks of a background job
+	// in WaitForJob, DefaultJobPollInterval when zero
+	JobPollInterval time.Duration
 }
 
 // Sighting ... XXX
 type Sighting struct {
-	ID        string   `json:"id,omitempty"`
-	UUID      string   `json:"uuid,omitempty"`
-	Value     string   `json:"value,omitempty"`
-	Values    []string `json:"values,omitempty"`
-	Timestamp int      `json:"timestamp,omitempty"`
+	ID        string       `json:"id,omitempty"`
+	UUID      string       `json:"uuid,omitempty"`
+	Value     string       `json:"value,omitempty"`
+	Values    []string     `json:"values,omitempty"`
+	Timestamp int          `json:"timestamp,omitempty"`
+	Type      SightingType `json:"type,omitempty"`
+	Source    string       `json:"source,omitempty"`
 }
 
 // Request ... XXX
@@ -41,7 +49,7 @@ type SampleFile struct {
 // SampleUpload ... XXX
 type SampleUpload struct {
 	Files        []SampleFile `json:"files,omitempty"`
-	Distribution string       `json:"distribution,omitempty"`
+	Distribution Distribution `json:"distribution,omitempty"`
 	Comment      string       `json:"comment,omitempty"` // comment field of any attribute created
 	EventID      string       `json:"event_id,omitempty"`
 	ToIDS        bool         `json:"to_ids,omitempty"`
@@ -73,22 +81,35 @@ type searchInnerResponse struct {
 
 // Attribute ...
 type Attribute struct {
-	Comment            string `json:"comment,omitempty"`
-	ID                 string `json:"id,omitempty"`
-	EventID            string `json:"event_id,omitempty"`
-	Distribution       string `json:"distribution,omitempty"`
-	ObjectID           string `json:"object_id,omitempty"`
-	ObjectRelation     string `json:"object_relation,omitempty"`
-	DisableCorrelation bool   `json:"disable_correlation,omitempty"`
-	Deleted            bool   `json:"deleted,omitempty"`
-	Filename           string `json:"filename,omitempty"`
-	Type               string `json:"type,omitempty"`
-	Timestamp          string `json:"timestamp,omitempty"`
-	Value              string `json:"value,omitempty"`
-	SharingGroupID     string `json:"sharing_group_id,omitempty"`
-	Category           string `json:"category,omitempty"`
-	UUID               string `json:"uuid,omitempty"`
-	ToIDS              bool   `json:"to_ids,omitempty"`
+	Comment            string       `json:"comment,omitempty"`
+	ID                 string       `json:"id,omitempty"`
+	EventID            string       `json:"event_id,omitempty"`
+	Distribution       Distribution `json:"distribution,omitempty"`
+	ObjectID           string       `json:"object_id,omitempty"`
+	ObjectRelation     string       `json:"object_relation,omitempty"`
+	DisableCorrelation bool         `json:"disable_correlation,omitempty"`
+	Deleted            bool         `json:"deleted,omitempty"`
+	Filename           string       `json:"filename,omitempty"`
+	Type               string       `json:"type,omitempty"`
+	Timestamp          string       `json:"timestamp,omitempty"`
+	Value              string       `json:"value,omitempty"`
+	SharingGroupID     string       `json:"sharing_group_id,omitempty"`
+	Category           string       `json:"category,omitempty"`
+	UUID               string       `json:"uuid,omitempty"`
+	ToIDS              bool         `json:"to_ids,omitempty"`
+	FirstSeen          string       `json:"first_seen,omitempty"`
+	LastSeen           string       `json:"last_seen,omitempty"`
+	Data               string       `json:"data,omitempty"` // base64 encoded attachment
+	Tag                []Tag        `json:"Tag,omitempty"`
+	Galaxy             []Galaxy     `json:"Galaxy,omitempty"`
+
+	// Attributes of other events with the same value, filled by GetEvent
+	// and by searches including correlations
+	RelatedAttribute []RelatedAttribute `json:"RelatedAttribute,omitempty"`
+
+	// Metadata of the event of the attribute, filled by searches including
+	// the context
+	Event *Event `json:"Event,omitempty"`
 }
 
 // AttributeQuery ...
@@ -137,6 +158,28 @@ type AttributeQuery struct {
 	// The returned events must include an attribute with the given UUID, or
 	// alternatively the event's UUID must match the value(s) passed.
 	UUID string `json:"uuid,omitempty"`
+
+	// Include the correlating attributes of other events ("1")
+	IncludeCorrelations string `json:"includeCorrelations,omitempty"`
+
+	// Include the metadata of the event of each attribute ("1")
+	IncludeContext string `json:"includeContext,omitempty"`
+
+	// Attributes modified after the given unix timestamp, or within the
+	// last x amount of time (same format as Last).
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Soft deleted attributes: [1] to only fetch them, [0, 1] to include
+	// them
+	Deleted []int `json:"deleted,omitempty"`
+
+	// Pagination of the results
+	Limit int `json:"limit,omitempty"`
+	Page  int `json:"page,omitempty"`
+
+	// Output format, only used by ExportAttributes. SearchAttribute always
+	// asks for JSON.
+	ReturnFormat ReturnFormat `json:"returnFormat,omitempty"`
 }
 
 // Search ... XXX
@@ -235,6 +278,12 @@ type UploadResponse struct {
 
 // UploadSample ... XXX
 func (client *Client) UploadSample(sample *SampleUpload) (*UploadResponse, error) {
+	// A new event is created when no event ID is given, there is nothing to
+	// inherit the distribution from
+	if err := checkDistribution(sample.Distribution, "", sample.EventID != ""); err != nil {
+		return nil, err
+	}
+
 	req := &Request{Request: sample}
 
 	url := fmt.Sprintf("/events/upload_sample/%s", sample.EventID)
@@ -309,6 +358,10 @@ type attributeResponse struct {
 
 // AddAttribute adds an attribute to an event
 func (client *Client) AddAttribute(eventID string, attr Attribute) (*Attribute, error) {
+	if err := checkDistribution(attr.Distribution, attr.SharingGroupID, true); err != nil {
+		return nil, err
+	}
+
 	urlPath := fmt.Sprintf("/attributes/add/%s", eventID)
 	resp, err := client.Post(urlPath, attr)
 	if err != nil {
@@ -327,7 +380,10 @@ func (client *Client) AddAttribute(eventID string, attr Attribute) (*Attribute,
 
 // SearchAttribute ...
 func (client *Client) SearchAttribute(q *AttributeQuery) ([]Attribute, error) {
-	httpResp, err := client.Post("/attributes/restSearch/json/", Request{Request: q})
+	req := *q
+	req.ReturnFormat = "" // the path asks for JSON
+
+	httpResp, err := client.Post("/attributes/restSearch/json/", Request{Request: &req})
 	if err != nil {
 		return nil, err
 	}
@@ -352,6 +408,87 @@ func (client *Client) SearchAttribute(q *AttributeQuery) ([]Attribute, error) {
 	return inner.Attribute, nil
 }
 
+// actionResponse is the answer of the server to actions which do not return
+// a model, such as enabling a feed
+type actionResponse struct {
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Saved   bool   `json:"saved,omitempty"`
+	Result  string `json:"result,omitempty"`
+
+	// Success is either a message or a boolean
+	Success json.RawMessage `json:"success,omitempty"`
+
+	// Errors can be a string, a list or an object
+	Errors json.RawMessage `json:"errors,omitempty"`
+}
+
+// message returns the human readable part of the response
+func (r *actionResponse) message() string {
+	switch {
+	case r.Message != "":
+		return r.Message
+	case r.Result != "":
+		return r.Result
+	}
+
+	var success string
+	if json.Unmarshal(r.Success, &success) == nil && success != "" {
+		return success
+	}
+
+	return r.Name
+}
+
+// postAction sends req to path and fails if the server answered with
+// errors, even with a 200 status code
+func (client *Client) postAction(path string, req interface{}) error {
+	var resp actionResponse
+	if err := client.call("POST", path, req, &resp); err != nil {
+		return err
+	}
+
+	switch string(resp.Errors) {
+	case "", "null", `""`, "[]", "{}":
+		return nil
+	}
+
+	return fmt.Errorf("MISP returned an error: %s", resp.Errors)
+}
+
+// call sends req to path with the given method and decodes the JSON response
+// into out. The response body is always closed, out can be nil when the
+// caller does not care about the answer.
+func (client *Client) call(method, path string, req, out interface{}) error {
+	resp, err := client.Do(method, path, req)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if out == nil {
+		resp.Body.Close()
+		return nil
+	}
+
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse decodes the JSON body of resp into v and closes the body
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	return nil
+}
+
 // Do set the HTTP headers, encode the data in the JSON format and send it to the
 // server.
 // It checks the HTTP response by looking at the status code and decodes the JSON structure
@@ -367,9 +504,15 @@ func (client *Client) Do(method, path string, req interface{}) (*http.Response,
 		httpReq.Body = ioutil.NopCloser(bytes.NewReader(jsonBuf))
 	}
 
+	// path can hold a query string, and BaseURL must not be modified
+	u := *client.BaseURL
+	u.Path, u.RawQuery = path, ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		u.Path, u.RawQuery = path[:i], path[i+1:]
+	}
+
 	httpReq.Method = method
-	httpReq.URL = client.BaseURL
-	httpReq.URL.Path = path
+	httpReq.URL = &u
 
 	httpReq.Header = make(http.Header)
 	httpReq.Header.Set("Authorization", client.APIKey)
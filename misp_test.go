@@ -48,6 +48,32 @@ func testAuthentication(t *testing.T, r *http.Request) {
 	testHeader(t, r, "Authorization", client.APIKey)
 }
 
+func TestDoQueryString(t *testing.T) {
+	setup()
+	defer server.Close()
+
+	mux.HandleFunc("/events/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			if got := r.URL.Query().Get("searchinfo"); got != "foo bar" {
+				t.Errorf("Query string is %q", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `[]`)
+		})
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Do("GET", "/events/index?searchinfo=foo+bar", nil)
+		if err != nil {
+			t.Fatalf("Do returned an error: %s", err)
+		}
+		resp.Body.Close()
+	}
+
+	if client.BaseURL.Path != "" || client.BaseURL.RawQuery != "" {
+		t.Errorf("BaseURL was modified: %s", client.BaseURL)
+	}
+}
+
 type attributeRequest struct {
 	Request AttributeQuery
 }
@@ -0,0 +1,622 @@
+package misp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// NIDSFormat is the rule syntax produced by NIDSGenerator
+type NIDSFormat string
+
+// Rule syntaxes
+const (
+	NIDSSuricata NIDSFormat = "suricata"
+	NIDSSnort    NIDSFormat = "snort"
+)
+
+// DefaultNIDSStartSID is the first sid allocated by NIDSGenerator
+const DefaultNIDSStartSID = 1000000
+
+// DefaultNIDSMsgTemplate is the msg of the rules exported by MISP
+const DefaultNIDSMsgTemplate = "MISP e{{.EventID}} [{{.Tags}}] {{.Description}}: {{.Value}}"
+
+// NIDSMessage holds the fields available to the msg template of the rules
+type NIDSMessage struct {
+	EventID   string
+	EventUUID string
+	EventInfo string
+
+	// Tags of the event and of the attribute, separated by commas
+	Tags string
+
+	// Description of the rule, such as "Outgoing To IP"
+	Description string
+
+	Type     string
+	Category string
+	Value    string
+	Comment  string
+}
+
+// NIDSGenerator writes Suricata or Snort rules for the attributes with the
+// IDS flag, with the type mapping of the NIDS export of MISP
+type NIDSGenerator struct {
+	Format NIDSFormat
+
+	// First sid, DefaultNIDSStartSID when zero. The rules of an attribute
+	// get StartSID + 10 * ID and the following numbers.
+	StartSID int
+
+	// SID overrides the allocation of the first sid of the rules of an
+	// attribute, for attributes without numeric ID such as those of feeds
+	SID func(attr *Attribute) (int, error)
+
+	// Text/template of the msg option, DefaultNIDSMsgTemplate when empty,
+	// executed with a NIDSMessage
+	MsgTemplate string
+
+	// URL of the MISP server, used for the url references to the events
+	BaseURL string
+
+	msg *template.Template
+}
+
+var nidsDescriptions = map[string]string{
+	"ip-dst":              "Outgoing To IP",
+	"ip-src":              "Incoming From IP",
+	"ip-dst|port":         "Outgoing To IP",
+	"ip-src|port":         "Incoming From IP",
+	"email-src":           "Source Email Address",
+	"email-dst":           "Destination Email Address",
+	"email-subject":       "Bad Email Subject",
+	"email-attachment":    "Bad Email Attachment",
+	"domain":              "Domain",
+	"hostname":            "Hostname",
+	"domain|ip":           "Domain",
+	"url":                 "Outgoing HTTP URL",
+	"user-agent":          "Outgoing User-Agent",
+	"snort":               "Custom Rule",
+	"ja3-fingerprint-md5": "JA3 Hash",
+}
+
+// nidsAttributes returns the attributes of an event to export, including
+// those of its objects
+func nidsAttributes(event *Event) []*Attribute {
+	var attrs []*Attribute
+
+	add := func(attr *Attribute) {
+		if attr.ToIDS && !attr.Deleted {
+			attrs = append(attrs, attr)
+		}
+	}
+	for i := range event.Attribute {
+		add(&event.Attribute[i])
+	}
+	for i := range event.Object {
+		if event.Object[i].Deleted {
+			continue
+		}
+		for j := range event.Object[i].Attribute {
+			add(&event.Object[i].Attribute[j])
+		}
+	}
+
+	return attrs
+}
+
+// Write writes the rules of the attributes of the events
+func (g *NIDSGenerator) Write(w io.Writer, events ...Event) error {
+	bw := bufio.NewWriter(w)
+
+	for i := range events {
+		for _, attr := range nidsAttributes(&events[i]) {
+			rules, err := g.AttributeRules(&events[i], attr)
+			if err != nil {
+				return err
+			}
+			for _, rule := range rules {
+				bw.WriteString(rule)
+				bw.WriteByte('\n')
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// AttributeRules returns the rules of an attribute of event, none for types
+// without rules
+func (g *NIDSGenerator) AttributeRules(event *Event, attr *Attribute) ([]string, error) {
+	desc, ok := nidsDescriptions[attr.Type]
+	if !ok || (attr.Type == "ja3-fingerprint-md5" && g.Format == NIDSSnort) {
+		return nil, nil
+	}
+
+	sid, err := g.sid(attr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &nidsRules{g: g, event: event, attr: attr, sid: sid}
+	r.msg, err = g.message(event, attr, desc, attr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	values := strings.SplitN(attr.Value, "|", 2)
+	switch attr.Type {
+	case "ip-dst", "ip-src":
+		r.ip(attr.Type == "ip-dst", attr.Value, "")
+	case "ip-dst|port", "ip-src|port":
+		if len(values) != 2 {
+			return nil, fmt.Errorf("invalid %s value %q", attr.Type, attr.Value)
+		}
+		r.ip(attr.Type == "ip-dst|port", values[0], values[1])
+	case "domain", "hostname":
+		r.domain(attr.Value)
+	case "domain|ip":
+		if len(values) != 2 {
+			return nil, fmt.Errorf("invalid %s value %q", attr.Type, attr.Value)
+		}
+		r.domain(values[0])
+		r.ip(true, values[1], "")
+	case "url":
+		r.url(attr.Value)
+	case "user-agent":
+		r.userAgent(attr.Value)
+	case "email-src":
+		r.email(`MAIL FROM:`, attr.Value)
+	case "email-dst":
+		r.email(`RCPT TO:`, attr.Value)
+	case "email-subject":
+		r.email(`Subject:`, attr.Value)
+	case "email-attachment":
+		r.attachment(attr.Value)
+	case "ja3-fingerprint-md5":
+		r.add("alert tls any any -> any any", "ja3.hash", fmt.Sprintf(`content:"%s"`, nidsContent(attr.Value)))
+	case "snort":
+		rule, err := g.customRule(event, attr, sid)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	return r.rules, nil
+}
+
+func (g *NIDSGenerator) sid(attr *Attribute) (int, error) {
+	if g.SID != nil {
+		return g.SID(attr)
+	}
+
+	id, err := strconv.Atoi(attr.ID)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %s has no numeric ID to allocate sids", attr.UUID)
+	}
+
+	start := g.StartSID
+	if start == 0 {
+		start = DefaultNIDSStartSID
+	}
+
+	return start + 10*id, nil
+}
+
+func (g *NIDSGenerator) message(event *Event, attr *Attribute, desc, value string) (string, error) {
+	if g.msg == nil {
+		text := g.MsgTemplate
+		if text == "" {
+			text = DefaultNIDSMsgTemplate
+		}
+		t, err := template.New("msg").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("invalid msg template: %s", err)
+		}
+		g.msg = t
+	}
+
+	eventID := event.ID
+	if eventID == "" {
+		eventID = attr.EventID
+	}
+
+	var tags []string
+	for _, tag := range event.Tag {
+		tags = append(tags, tag.Name)
+	}
+	for _, tag := range attr.Tag {
+		tags = append(tags, tag.Name)
+	}
+
+	var buf bytes.Buffer
+	err := g.msg.Execute(&buf, NIDSMessage{
+		EventID:     eventID,
+		EventUUID:   event.UUID,
+		EventInfo:   event.Info,
+		Tags:        strings.Join(tags, ","),
+		Description: desc,
+		Type:        attr.Type,
+		Category:    attr.Category,
+		Value:       value,
+		Comment:     attr.Comment,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid msg template: %s", err)
+	}
+
+	return nidsMsg(buf.String()), nil
+}
+
+// nidsMsg escapes the characters with a meaning in rule options
+func nidsMsg(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `;`, `\;`, "\n", " ", "\r", " ").Replace(s)
+}
+
+// nidsContent escapes a content match, the special characters being
+// written in hexadecimal
+func nidsContent(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '|' || c == '"' || c == ';' || c == ':' || c == '\\' || c < 0x20 || c >= 0x7f {
+			fmt.Fprintf(&b, "|%02X|", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// nidsDNSName returns a domain name as in DNS messages,
+// |03|www|07|example|03|com|00|
+func nidsDNSName(name string) string {
+	var b strings.Builder
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		fmt.Fprintf(&b, "|%02X|%s", len(label), nidsContent(label))
+	}
+	b.WriteString("|00|")
+
+	return b.String()
+}
+
+// nidsPCRE escapes a string for a pcre option
+func nidsPCRE(s string) string {
+	return strings.NewReplacer(`"`, `\x22`, `;`, `\x3b`, `/`, `\/`).Replace(regexp.QuoteMeta(s))
+}
+
+// nidsRules builds the rules of an attribute
+type nidsRules struct {
+	g     *NIDSGenerator
+	event *Event
+	attr  *Attribute
+	msg   string
+	sid   int
+	rules []string
+}
+
+// add appends a rule made of its header and options, the common options
+// being added
+func (r *nidsRules) add(header string, options ...string) {
+	options = append([]string{fmt.Sprintf(`msg:"%s"`, r.msg)}, options...)
+	options = append(options, "classtype:trojan-activity", fmt.Sprintf("sid:%d", r.sid+len(r.rules)), "rev:1")
+
+	if p, err := strconv.Atoi(string(r.event.ThreatLevelID)); err == nil && p >= 1 && p <= 4 {
+		options = append(options, fmt.Sprintf("priority:%d", p))
+	}
+
+	if r.event.UUID != "" {
+		if r.g.BaseURL != "" {
+			options = append(options, fmt.Sprintf("reference:url,%s/events/view/%s", strings.TrimPrefix(strings.TrimPrefix(strings.TrimRight(r.g.BaseURL, "/"), "https://"), "http://"), r.event.UUID))
+		}
+		options = append(options, "metadata:misp_event_uuid "+r.event.UUID)
+	}
+
+	r.rules = append(r.rules, fmt.Sprintf("%s (%s;)", header, strings.Join(options, "; ")))
+}
+
+func (r *nidsRules) ip(outgoing bool, ip, port string) {
+	if net.ParseIP(ip) == nil {
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return
+		}
+	}
+
+	if port == "" {
+		if outgoing {
+			r.add(fmt.Sprintf("alert ip $HOME_NET any -> %s any", ip))
+		} else {
+			r.add(fmt.Sprintf("alert ip %s any -> $HOME_NET any", ip))
+		}
+		return
+	}
+
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return
+	}
+	for _, proto := range []string{"tcp", "udp"} {
+		if outgoing {
+			r.add(fmt.Sprintf("alert %s $HOME_NET any -> %s %s", proto, ip, port))
+		} else {
+			r.add(fmt.Sprintf("alert %s %s %s -> $HOME_NET any", proto, ip, port))
+		}
+	}
+}
+
+func (r *nidsRules) domain(name string) {
+	name = strings.ToLower(strings.Trim(name, "."))
+	if name == "" {
+		return
+	}
+
+	if r.g.Format == NIDSSuricata {
+		// dotprefix matches the name and its subdomains
+		suffix := fmt.Sprintf(`content:".%s"`, nidsContent(name))
+		r.add("alert dns $HOME_NET any -> any any", "dns.query", "dotprefix", suffix, "nocase", "endswith")
+		r.add("alert http $HOME_NET any -> $EXTERNAL_NET any", "flow:established,to_server", "http.host", "dotprefix", suffix, "endswith")
+		r.add("alert tls $HOME_NET any -> $EXTERNAL_NET any", "flow:established,to_server", "tls.sni", "dotprefix", suffix, "nocase", "endswith")
+		return
+	}
+
+	dns := fmt.Sprintf(`content:"%s"`, nidsDNSName(name))
+	r.add("alert udp any any -> any 53", dns, "fast_pattern:only")
+	r.add("alert tcp any any -> any 53", dns, "fast_pattern:only")
+	r.add("alert tcp $HOME_NET any -> $EXTERNAL_NET $HTTP_PORTS",
+		"flow:to_server,established",
+		`content:"Host|3A|"`, "nocase", "http_header",
+		fmt.Sprintf(`content:"%s"`, nidsContent(name)), "fast_pattern", "nocase", "http_header",
+		fmt.Sprintf(`pcre:"/(^|[^A-Za-z0-9-\.])%s[^A-Za-z0-9-\.]/Hi"`, nidsPCRE(name)))
+}
+
+func (r *nidsRules) url(value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Host == "" && u.Path == "") {
+		return
+	}
+	if u.Host == "" && !strings.HasPrefix(u.Path, "/") {
+		// Without scheme, e.g. www.example.com/login
+		if u, err = url.Parse("http://" + value); err != nil {
+			return
+		}
+	}
+
+	uri := u.RequestURI()
+	var options []string
+	if r.g.Format == NIDSSuricata {
+		options = append(options, "flow:established,to_server")
+		if u.Host != "" {
+			// http.host is normalised to lower case and rejects nocase
+			options = append(options, "http.host", fmt.Sprintf(`content:"%s"`, nidsContent(strings.ToLower(u.Hostname()))), "endswith")
+		}
+		if uri != "/" {
+			options = append(options, "http.uri", fmt.Sprintf(`content:"%s"`, nidsContent(uri)))
+		}
+		r.add("alert http $HOME_NET any -> $EXTERNAL_NET any", options...)
+		return
+	}
+
+	options = append(options, "flow:to_server,established")
+	if u.Host != "" {
+		options = append(options, fmt.Sprintf(`content:"Host|3A| %s"`, nidsContent(strings.ToLower(u.Hostname()))), "nocase", "http_header")
+	}
+	if uri != "/" {
+		options = append(options, fmt.Sprintf(`content:"%s"`, nidsContent(uri)), "http_uri")
+	}
+	r.add("alert tcp $HOME_NET any -> $EXTERNAL_NET $HTTP_PORTS", options...)
+}
+
+func (r *nidsRules) userAgent(ua string) {
+	if r.g.Format == NIDSSuricata {
+		r.add("alert http $HOME_NET any -> $EXTERNAL_NET any", "flow:established,to_server", "http.user_agent", fmt.Sprintf(`content:"%s"`, nidsContent(ua)), "bsize:"+strconv.Itoa(len(ua)))
+		return
+	}
+
+	r.add("alert tcp $HOME_NET any -> $EXTERNAL_NET $HTTP_PORTS", "flow:to_server,established", fmt.Sprintf(`content:"User-Agent|3A| %s|0D 0A|"`, nidsContent(ua)), "http_header")
+}
+
+func (r *nidsRules) email(command, value string) {
+	r.add("alert tcp $EXTERNAL_NET any -> $SMTP_SERVERS 25",
+		"flow:established,to_server",
+		fmt.Sprintf(`content:"%s"`, nidsContent(command)), "nocase",
+		fmt.Sprintf(`content:"%s"`, nidsContent(value)), "fast_pattern", "nocase",
+		`content:"|0D 0A 0D 0A|"`, "within:8192")
+}
+
+func (r *nidsRules) attachment(filename string) {
+	r.add("alert tcp $EXTERNAL_NET any -> $SMTP_SERVERS 25",
+		"flow:established,to_server",
+		`content:"Content-Disposition|3A| attachment|3B| filename=|22|"`, "nocase",
+		fmt.Sprintf(`content:"%s|22|"`, nidsContent(filename)), "within:256", "nocase")
+}
+
+var (
+	nidsSIDOption = regexp.MustCompile(`sid\s*:\s*\d+\s*;`)
+	nidsMsgOption = regexp.MustCompile(`msg\s*:\s*"((?:[^"\\]|\\.)*)"\s*;`)
+)
+
+// customRule renumbers a rule stored in a snort attribute and prefixes its
+// msg
+func (g *NIDSGenerator) customRule(event *Event, attr *Attribute, sid int) (string, error) {
+	rule := strings.TrimSpace(attr.Value)
+	end := strings.LastIndexByte(rule, ')')
+	if end < 0 {
+		return "", fmt.Errorf("invalid rule in attribute %s", attr.UUID)
+	}
+
+	option := fmt.Sprintf("sid:%d;", sid)
+	if nidsSIDOption.MatchString(rule) {
+		rule = nidsSIDOption.ReplaceAllLiteralString(rule, option)
+	} else {
+		rule = rule[:end] + " " + option + rule[end:]
+		end = strings.LastIndexByte(rule, ')')
+	}
+
+	var original string
+	if m := nidsMsgOption.FindStringSubmatch(rule); m != nil {
+		original = strings.NewReplacer(`\"`, `"`, `\;`, `;`, `\\`, `\`).Replace(m[1])
+	}
+	msg, err := g.message(event, attr, nidsDescriptions["snort"], original)
+	if err != nil {
+		return "", err
+	}
+
+	option = fmt.Sprintf(`msg:"%s";`, msg)
+	if nidsMsgOption.MatchString(rule) {
+		return nidsMsgOption.ReplaceAllLiteralString(rule, option), nil
+	}
+	if i := strings.IndexByte(rule, '('); i >= 0 {
+		return rule[:i+1] + option + " " + rule[i+1:], nil
+	}
+
+	return rule, nil
+}
+
+// ZeekIntelGenerator writes the attributes with the IDS flag as a file of
+// the Intel framework of Zeek, with the type mapping of the Bro export of
+// MISP
+type ZeekIntelGenerator struct {
+	// Source of the indicators, the creator organisation of the event when
+	// empty
+	Source string
+
+	// URL of the MISP server, used for the meta.url field
+	BaseURL string
+
+	// Whether Zeek should raise notices for the matches
+	DoNotice bool
+}
+
+var zeekIntelTypes = map[string]string{
+	"ip-dst":                "Intel::ADDR",
+	"ip-src":                "Intel::ADDR",
+	"ip-dst|port":           "Intel::ADDR",
+	"ip-src|port":           "Intel::ADDR",
+	"email-src":             "Intel::EMAIL",
+	"email-dst":             "Intel::EMAIL",
+	"email":                 "Intel::EMAIL",
+	"target-email":          "Intel::EMAIL",
+	"domain":                "Intel::DOMAIN",
+	"hostname":              "Intel::DOMAIN",
+	"url":                   "Intel::URL",
+	"uri":                   "Intel::URL",
+	"user-agent":            "Intel::SOFTWARE",
+	"filename":              "Intel::FILE_NAME",
+	"md5":                   "Intel::FILE_HASH",
+	"sha1":                  "Intel::FILE_HASH",
+	"sha256":                "Intel::FILE_HASH",
+	"x509-fingerprint-sha1": "Intel::CERT_HASH",
+}
+
+// ZeekIntelHeader is the header of the files written by ZeekIntelGenerator
+const ZeekIntelHeader = "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\tmeta.url\tmeta.do_notice\tmeta.if_in\n"
+
+// Write writes the header and the indicators of the events, sorted and
+// without duplicates
+func (g *ZeekIntelGenerator) Write(w io.Writer, events ...Event) error {
+	seen := make(map[string]bool)
+	var lines []string
+
+	for i := range events {
+		for _, attr := range nidsAttributes(&events[i]) {
+			for _, line := range g.AttributeLines(&events[i], attr) {
+				if !seen[line] {
+					seen[line] = true
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+	sort.Strings(lines)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(ZeekIntelHeader)
+	for _, line := range lines {
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+// AttributeLines returns the lines of an attribute of event, none for types
+// without Intel type
+func (g *ZeekIntelGenerator) AttributeLines(event *Event, attr *Attribute) []string {
+	var indicators [][2]string
+
+	values := strings.SplitN(attr.Value, "|", 2)
+	switch {
+	case attr.Type == "domain|ip" && len(values) == 2:
+		indicators = append(indicators, [2]string{values[0], "Intel::DOMAIN"}, [2]string{values[1], "Intel::ADDR"})
+	case strings.HasPrefix(attr.Type, "filename|") && len(values) == 2:
+		indicators = append(indicators, [2]string{values[0], "Intel::FILE_NAME"})
+		if t := zeekIntelTypes[strings.TrimPrefix(attr.Type, "filename|")]; t != "" {
+			indicators = append(indicators, [2]string{values[1], t})
+		}
+	case strings.HasSuffix(attr.Type, "|port") && len(values) == 2:
+		indicators = append(indicators, [2]string{values[0], zeekIntelTypes[attr.Type]})
+	case zeekIntelTypes[attr.Type] != "":
+		value := attr.Value
+		if attr.Type == "url" || attr.Type == "uri" {
+			// Zeek matches URLs without scheme
+			value = strings.TrimPrefix(strings.TrimPrefix(value, "https://"), "http://")
+		}
+		indicators = append(indicators, [2]string{value, zeekIntelTypes[attr.Type]})
+	}
+
+	source := g.Source
+	if source == "" && event.Orgc != nil {
+		source = event.Orgc.Name
+	}
+	if source == "" {
+		source = "MISP"
+	}
+
+	desc := event.Info
+	if attr.Comment != "" {
+		desc += " - " + attr.Comment
+	}
+
+	eventURL := "-"
+	if g.BaseURL != "" && event.UUID != "" {
+		eventURL = strings.TrimRight(g.BaseURL, "/") + "/events/view/" + event.UUID
+	}
+
+	notice := "F"
+	if g.DoNotice {
+		notice = "T"
+	}
+
+	var lines []string
+	for _, ind := range indicators {
+		if ind[0] == "" {
+			continue
+		}
+		fields := []string{ind[0], ind[1], source, desc, eventURL, notice, "-"}
+		for i, f := range fields {
+			fields[i] = zeekField(f)
+		}
+		lines = append(lines, strings.Join(fields, "\t"))
+	}
+
+	return lines
+}
+
+// zeekField replaces the separators in a field, and empty fields by "-"
+func zeekField(s string) string {
+	s = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,141 @@
+package misp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNIDSGeneratorSuricata(t *testing.T) {
+	g := &NIDSGenerator{Format: NIDSSuricata, BaseURL: "https://misp.example/"}
+
+	event := Event{
+		ID:            "27",
+		UUID:          "3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44",
+		ThreatLevelID: ThreatLevelHigh,
+		Tag:           []Tag{{Name: "tlp:amber"}},
+		Attribute: []Attribute{
+			{ID: "1", Type: "ip-dst", Value: "198.51.100.7", ToIDS: true},
+			{ID: "2", Type: "domain", Value: "foo.example", ToIDS: true},
+			{ID: "3", Type: "url", Value: "http://foo.example/gate.php?id=1", ToIDS: true},
+			{ID: "4", Type: "ip-src|port", Value: "203.0.113.5|8080", ToIDS: true},
+			{ID: "5", Type: "email-subject", Value: `Invoice "urgent"; pay`, ToIDS: true},
+			{ID: "6", Type: "domain", Value: "benign.example", ToIDS: false},
+			{ID: "7", Type: "snort", Value: `alert tcp any any -> any any (msg:"Foo"; content:"bar"; sid:1; rev:2;)`, ToIDS: true},
+			{ID: "8", Type: "ja3-fingerprint-md5", Value: "e7d705a3286e19ea42f587b344ee6865", ToIDS: true},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := g.Write(&buf, event); err != nil {
+		t.Fatalf("Write returned an error: %s", err)
+	}
+	rules := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	want := []string{
+		`alert ip $HOME_NET any -> 198.51.100.7 any (msg:"MISP e27 [tlp:amber] Outgoing To IP: 198.51.100.7"; classtype:trojan-activity; sid:1000010; rev:1; priority:1; reference:url,misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44; metadata:misp_event_uuid 3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44;)`,
+		`alert dns $HOME_NET any -> any any (msg:"MISP e27 [tlp:amber] Domain: foo.example"; dns.query; dotprefix; content:".foo.example"; nocase; endswith; classtype:trojan-activity; sid:1000020; rev:1; priority:1; reference:url,misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44; metadata:misp_event_uuid 3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44;)`,
+	}
+	for i, w := range want {
+		if rules[i] != w {
+			t.Errorf("Rule %d is\n%s\nwant\n%s", i, rules[i], w)
+		}
+	}
+
+	// 1 ip, 3 domain, 1 url, 2 ip|port, 1 subject, 1 custom, 1 ja3
+	if len(rules) != 10 {
+		t.Fatalf("Write wrote %d rules:\n%s", len(rules), buf.String())
+	}
+	if !strings.Contains(rules[2], "sid:1000021;") || !strings.Contains(rules[3], "sid:1000022;") {
+		t.Errorf("Domain rules are not numbered in sequence:\n%s\n%s", rules[2], rules[3])
+	}
+	if !strings.Contains(rules[4], `http.host; content:"foo.example"; endswith; http.uri; content:"/gate.php?id=1";`) {
+		t.Errorf("URL rule is %s", rules[4])
+	}
+	if !strings.HasPrefix(rules[5], "alert tcp 203.0.113.5 8080 -> $HOME_NET any") || !strings.HasPrefix(rules[6], "alert udp 203.0.113.5 8080") {
+		t.Errorf("IP port rules are\n%s\n%s", rules[5], rules[6])
+	}
+	if !strings.Contains(rules[7], `msg:"MISP e27 [tlp:amber] Bad Email Subject: Invoice \"urgent\"\; pay"`) || !strings.Contains(rules[7], `content:"Invoice |22|urgent|22||3B| pay"`) {
+		t.Errorf("Email subject rule is %s", rules[7])
+	}
+	if rules[8] != `alert tcp any any -> any any (msg:"MISP e27 [tlp:amber] Custom Rule: Foo"; content:"bar"; sid:1000070; rev:2;)` {
+		t.Errorf("Custom rule is %s", rules[8])
+	}
+	if !strings.Contains(rules[9], `ja3.hash; content:"e7d705a3286e19ea42f587b344ee6865"`) {
+		t.Errorf("JA3 rule is %s", rules[9])
+	}
+}
+
+func TestNIDSGeneratorSnort(t *testing.T) {
+	g := &NIDSGenerator{
+		Format:      NIDSSnort,
+		StartSID:    5000000,
+		MsgTemplate: "{{.EventUUID}} {{.Description}} {{.Value}}",
+	}
+
+	event := &Event{UUID: "3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44", ThreatLevelID: ThreatLevelHigh}
+
+	rules, err := g.AttributeRules(event, &Attribute{ID: "2", Type: "hostname", Value: "www.foo.example", ToIDS: true})
+	if err != nil {
+		t.Fatalf("AttributeRules returned an error: %s", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("AttributeRules returned %d rules", len(rules))
+	}
+	if rules[0] != `alert udp any any -> any 53 (msg:"3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44 Hostname www.foo.example"; content:"|03|www|03|foo|07|example|00|"; fast_pattern:only; classtype:trojan-activity; sid:5000020; rev:1; priority:1; metadata:misp_event_uuid 3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44;)` {
+		t.Errorf("DNS rule is %s", rules[0])
+	}
+	if !strings.Contains(rules[2], `pcre:"/(^|[^A-Za-z0-9-\.])www\.foo\.example[^A-Za-z0-9-\.]/Hi"`) {
+		t.Errorf("HTTP rule is %s", rules[2])
+	}
+
+	if rules, _ := g.AttributeRules(event, &Attribute{ID: "9", Type: "ja3-fingerprint-md5", Value: "e7d705a3286e19ea42f587b344ee6865"}); rules != nil {
+		t.Errorf("AttributeRules returned JA3 rules for Snort: %v", rules)
+	}
+
+	if _, err := g.AttributeRules(event, &Attribute{Type: "domain", Value: "foo.example"}); err == nil {
+		t.Errorf("AttributeRules allocated a sid for an attribute without ID")
+	}
+
+	g.SID = func(attr *Attribute) (int, error) { return 42, nil }
+	if rules, err := g.AttributeRules(event, &Attribute{Type: "ip-dst", Value: "198.51.100.7"}); err != nil || !strings.Contains(rules[0], "sid:42;") {
+		t.Errorf("AttributeRules returned %v %v", rules, err)
+	}
+}
+
+func TestZeekIntelGenerator(t *testing.T) {
+	event := Event{
+		UUID: "3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44",
+		Info: "Loader distribution",
+		Orgc: &Organisation{Name: "Northwind CSIRT"},
+		Attribute: []Attribute{
+			{Type: "ip-dst", Value: "198.51.100.7", ToIDS: true},
+			{Type: "domain", Value: "foo.example", ToIDS: true, Comment: "C2"},
+			{Type: "url", Value: "http://foo.example/gate.php?id=1", ToIDS: true},
+			{Type: "ip-src|port", Value: "203.0.113.5|8080", ToIDS: true},
+			{Type: "md5", Value: "68b329da9893e34099c7d8ad5cb9c940", ToIDS: true},
+			{Type: "domain", Value: "benign.example", ToIDS: false},
+			{Type: "filename|sha256", Value: "foo.exe|e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ToIDS: true},
+			{Type: "ip-dst", Value: "198.51.100.7", ToIDS: true},
+		},
+	}
+
+	g := &ZeekIntelGenerator{BaseURL: "https://misp.example", DoNotice: true}
+
+	var buf bytes.Buffer
+	if err := g.Write(&buf, event); err != nil {
+		t.Fatalf("Write returned an error: %s", err)
+	}
+
+	want := ZeekIntelHeader +
+		"198.51.100.7\tIntel::ADDR\tNorthwind CSIRT\tLoader distribution\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n" +
+		"203.0.113.5\tIntel::ADDR\tNorthwind CSIRT\tLoader distribution\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n" +
+		"68b329da9893e34099c7d8ad5cb9c940\tIntel::FILE_HASH\tNorthwind CSIRT\tLoader distribution\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\tIntel::FILE_HASH\tNorthwind CSIRT\tLoader distribution\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n" +
+		"foo.example\tIntel::DOMAIN\tNorthwind CSIRT\tLoader distribution - C2\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n" +
+		"foo.example/gate.php?id=1\tIntel::URL\tNorthwind CSIRT\tLoader distribution\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n" +
+		"foo.exe\tIntel::FILE_NAME\tNorthwind CSIRT\tLoader distribution\thttps://misp.example/events/view/3d9b2c7e-8f41-4b6a-a0d5-6e2f9c1b7a44\tT\t-\n"
+	if buf.String() != want {
+		t.Errorf("Write wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,117 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Proposal is a change suggested on an event by someone who can not edit
+// it, also known as shadow attribute. A proposal either creates a new
+// attribute, modifies the attribute OldID or asks for its deletion.
+type Proposal struct {
+	ID                 string      `json:"id,omitempty"`
+	OldID              string      `json:"old_id,omitempty"`
+	EventID            string      `json:"event_id,omitempty"`
+	EventUUID          string      `json:"event_uuid,omitempty"`
+	EventOrgID         string      `json:"event_org_id,omitempty"`
+	OrgID              string      `json:"org_id,omitempty"`
+	Email              string      `json:"email,omitempty"`
+	UUID               string      `json:"uuid,omitempty"`
+	Type               string      `json:"type,omitempty"`
+	Category           string      `json:"category,omitempty"`
+	Value              string      `json:"value,omitempty"`
+	Comment            string      `json:"comment,omitempty"`
+	ToIDS              bool        `json:"to_ids,omitempty"`
+	DisableCorrelation bool        `json:"disable_correlation,omitempty"`
+	Deleted            bool        `json:"deleted,omitempty"`
+	ProposalToDelete   bool        `json:"proposal_to_delete,omitempty"`
+	Timestamp          json.Number `json:"timestamp,omitempty"`
+	FirstSeen          string      `json:"first_seen,omitempty"`
+	LastSeen           string      `json:"last_seen,omitempty"`
+}
+
+type proposalWrapper struct {
+	ShadowAttribute Proposal `json:"ShadowAttribute"`
+}
+
+// ProposeAttribute proposes to add a new attribute to an event
+func (client *Client) ProposeAttribute(eventID string, attr Attribute) (*Proposal, error) {
+	return client.propose(fmt.Sprintf("/shadowAttributes/add/%s", eventID), attr)
+}
+
+// ProposeAttributeEdit proposes to replace the attribute attributeID by attr
+func (client *Client) ProposeAttributeEdit(attributeID string, attr Attribute) (*Proposal, error) {
+	return client.propose(fmt.Sprintf("/shadowAttributes/edit/%s", attributeID), attr)
+}
+
+func (client *Client) propose(path string, attr Attribute) (*Proposal, error) {
+	var resp proposalWrapper
+	if err := client.call("POST", path, attr, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.ShadowAttribute, nil
+}
+
+// ProposeAttributeDeletion proposes to delete the attribute attributeID
+func (client *Client) ProposeAttributeDeletion(attributeID string) error {
+	return client.postAction(fmt.Sprintf("/shadowAttributes/delete/%s", attributeID), nil)
+}
+
+// GetProposal returns the proposal with the given ID
+func (client *Client) GetProposal(proposalID string) (*Proposal, error) {
+	var resp proposalWrapper
+	if err := client.call("GET", fmt.Sprintf("/shadowAttributes/view/%s", proposalID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.ShadowAttribute, nil
+}
+
+// ListProposals returns the pending proposals of an event, or of all the
+// events when eventID is empty
+func (client *Client) ListProposals(eventID string) ([]Proposal, error) {
+	path := "/shadowAttributes/index"
+	if eventID != "" {
+		path = fmt.Sprintf("/shadowAttributes/index/%s", eventID)
+	}
+
+	var resp []proposalWrapper
+	if err := client.call("GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	proposals := make([]Proposal, len(resp))
+	for i, p := range resp {
+		proposals[i] = p.ShadowAttribute
+	}
+
+	return proposals, nil
+}
+
+// ListOrgProposals returns the pending proposals made by an organisation
+func (client *Client) ListOrgProposals(orgID string) ([]Proposal, error) {
+	all, err := client.ListProposals("")
+	if err != nil {
+		return nil, err
+	}
+
+	var proposals []Proposal
+	for _, p := range all {
+		if p.OrgID == orgID {
+			proposals = append(proposals, p)
+		}
+	}
+
+	return proposals, nil
+}
+
+// AcceptProposal applies a proposal to its event
+func (client *Client) AcceptProposal(proposalID string) error {
+	return client.postAction(fmt.Sprintf("/shadowAttributes/accept/%s", proposalID), nil)
+}
+
+// DiscardProposal drops a proposal without applying it
+func (client *Client) DiscardProposal(proposalID string) error {
+	return client.postAction(fmt.Sprintf("/shadowAttributes/discard/%s", proposalID), nil)
+}
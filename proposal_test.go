@@ -0,0 +1,111 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestProposeAttribute(t *testing.T) {
+	setup()
+
+	attr := Attribute{
+		Value:    "foobar.com",
+		Type:     "domain",
+		Category: "Network activity",
+		ToIDS:    true,
+	}
+
+	mux.HandleFunc("/shadowAttributes/add/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got Attribute
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Attribute request: %s", err)
+			}
+			if !reflect.DeepEqual(got, attr) {
+				t.Errorf("ProposeAttribute sent %+v, want %+v", got, attr)
+			}
+
+			fmt.Fprint(w, `{"ShadowAttribute":{"id":"7","old_id":"0","event_id":"42","type":"domain","category":"Network activity","value":"foobar.com","to_ids":true,"uuid":"5e4b2a1c-0000-4c8e-8f0d-2c4d0a3ac101","org_id":"3","event_uuid":"5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101","deleted":false,"proposal_to_delete":false,"timestamp":"1581918748"}}`)
+		})
+
+	p, err := client.ProposeAttribute("42", attr)
+	if err != nil {
+		t.Fatalf("ProposeAttribute returned an error: %s", err)
+	}
+
+	if p.ID != "7" || p.EventID != "42" || p.OrgID != "3" || p.Value != "foobar.com" {
+		t.Errorf("ProposeAttribute returned %+v", p)
+	}
+}
+
+func TestListOrgProposals(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/shadowAttributes/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[{"ShadowAttribute":{"id":"7","event_id":"42","org_id":"3","value":"foobar.com"}},{"ShadowAttribute":{"id":"8","old_id":"1337","event_id":"42","org_id":"4","proposal_to_delete":true}}]`)
+		})
+
+	proposals, err := client.ListOrgProposals("4")
+	if err != nil {
+		t.Fatalf("ListOrgProposals returned an error: %s", err)
+	}
+
+	if len(proposals) != 1 || proposals[0].ID != "8" || !proposals[0].ProposalToDelete {
+		t.Errorf("ListOrgProposals returned %+v", proposals)
+	}
+}
+
+func TestAcceptDiscardProposal(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/shadowAttributes/accept/7",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":"Proposed change accepted."}`)
+		})
+
+	mux.HandleFunc("/shadowAttributes/discard/8",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"false":true,"errors":"You don't have permission to do that."}`)
+		})
+
+	if err := client.AcceptProposal("7"); err != nil {
+		t.Errorf("AcceptProposal returned an error: %s", err)
+	}
+
+	if err := client.DiscardProposal("8"); err == nil {
+		t.Errorf("DiscardProposal did not return an error")
+	}
+}
+
+func TestProposeAttributeDeletion(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/shadowAttributes/delete/12",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":true,"name":"Proposal saved.","message":"Proposal saved.","url":"\/shadowAttributes\/delete\/12"}`)
+		})
+
+	mux.HandleFunc("/shadowAttributes/delete/13",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Could not save the proposal.","message":"Could not save the proposal.","url":"\/shadowAttributes\/delete\/13","errors":"Could not save the proposal."}`)
+		})
+
+	if err := client.ProposeAttributeDeletion("12"); err != nil {
+		t.Errorf("ProposeAttributeDeletion returned an error: %s", err)
+	}
+
+	if err := client.ProposeAttributeDeletion("13"); err == nil {
+		t.Errorf("ProposeAttributeDeletion did not return an error")
+	}
+}
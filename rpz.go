@@ -0,0 +1,278 @@
+package misp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RPZPolicy is the action of a response policy zone on the listed names
+type RPZPolicy string
+
+// Policies of the RPZ export of MISP
+const (
+	RPZDrop         RPZPolicy = "DROP"
+	RPZNXDomain     RPZPolicy = "NXDOMAIN"
+	RPZNoData       RPZPolicy = "NODATA"
+	RPZWalledGarden RPZPolicy = "walled-garden"
+	RPZPassthru     RPZPolicy = "PASSTHRU"
+	RPZTCPOnly      RPZPolicy = "TCP-Only"
+)
+
+// RPZGenerator writes response policy zones from domain, hostname and
+// ip-dst attributes. The defaults are those of the RPZ export of MISP.
+type RPZGenerator struct {
+	// Policy, RPZNXDomain when empty
+	Policy RPZPolicy
+
+	// Host name, or address, the names are redirected to by the walled
+	// garden policy
+	WalledGarden string
+
+	// Default TTL of the records, "1w" when empty
+	TTL string
+
+	// Name server and email of the SOA record, "localhost." and
+	// "root.localhost." when empty
+	NS    string
+	Email string
+
+	// Serial of the SOA record, today's YYYYMMDD00 when zero. See
+	// NextRPZSerial to increase it on each update.
+	Serial uint32
+
+	// Timers of the SOA record, "2h", "30m", "30d" and "1h" when empty
+	Refresh    string
+	Retry      string
+	Expiry     string
+	MinimumTTL string
+}
+
+// NextRPZSerial returns the serial following prev, in the YYYYMMDDNN format:
+// the first serial of the day of now, or prev + 1 when prev is already a
+// serial of this day or later
+func NextRPZSerial(prev uint32, now time.Time) uint32 {
+	today, _ := strconv.ParseUint(now.UTC().Format("20060102"), 10, 32)
+	first := uint32(today) * 100
+	if prev >= first {
+		return prev + 1
+	}
+
+	return first
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
+
+// action returns the right hand side of the records of the policy
+func (g *RPZGenerator) action() (string, error) {
+	switch g.Policy {
+	case RPZDrop:
+		return "CNAME rpz-drop.", nil
+	case RPZNXDomain, "":
+		return "CNAME .", nil
+	case RPZNoData:
+		return "CNAME *.", nil
+	case RPZPassthru:
+		return "CNAME rpz-passthru.", nil
+	case RPZTCPOnly:
+		return "CNAME rpz-tcp-only.", nil
+	case RPZWalledGarden:
+		if g.WalledGarden == "" {
+			return "", fmt.Errorf("walled garden policy without walled garden")
+		}
+		if ip := net.ParseIP(g.WalledGarden); ip != nil {
+			// Local data
+			if ip.To4() != nil {
+				return "A " + ip.String(), nil
+			}
+			return "AAAA " + ip.String(), nil
+		}
+		return "CNAME " + strings.TrimSuffix(g.WalledGarden, ".") + ".", nil
+	}
+
+	return "", fmt.Errorf("unknown RPZ policy %q", g.Policy)
+}
+
+// Write writes the zone of the attributes with the IDS flag. Domains are
+// listed with their subdomains, hostnames alone; values starting with "*."
+// only list the subdomains. Invalid values are skipped.
+func (g *RPZGenerator) Write(w io.Writer, attrs []Attribute) error {
+	action, err := g.action()
+	if err != nil {
+		return err
+	}
+
+	serial := g.Serial
+	if serial == 0 {
+		serial = NextRPZSerial(0, time.Now())
+	}
+
+	seen := make(map[string]bool)
+	var names, ips []string
+	for _, attr := range attrs {
+		if !attr.ToIDS || attr.Deleted {
+			continue
+		}
+
+		var owners []string
+		switch attr.Type {
+		case "domain":
+			if name, ok := rpzName(attr.Value); ok {
+				if strings.HasPrefix(name, "*.") {
+					owners = []string{name}
+				} else {
+					owners = []string{name, "*." + name}
+				}
+			}
+		case "hostname":
+			if name, ok := rpzName(attr.Value); ok {
+				owners = []string{name}
+			}
+		case "ip-dst":
+			if owner, ok := rpzIP(attr.Value); ok {
+				owners = []string{owner}
+			}
+		}
+
+		for _, owner := range owners {
+			if seen[owner] {
+				continue
+			}
+			seen[owner] = true
+			if strings.HasSuffix(owner, ".rpz-ip") {
+				ips = append(ips, owner)
+			} else {
+				names = append(names, owner)
+			}
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(ips)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$TTL %s;\n", orDefault(g.TTL, "1w"))
+	fmt.Fprintf(bw, "@               SOA %s %s (%d %s %s %s %s)\n",
+		orDefault(g.NS, "localhost."), orDefault(g.Email, "root.localhost."), serial,
+		orDefault(g.Refresh, "2h"), orDefault(g.Retry, "30m"), orDefault(g.Expiry, "30d"), orDefault(g.MinimumTTL, "1h"))
+	fmt.Fprintf(bw, "                NS %s\n", orDefault(g.NS, "localhost."))
+
+	if len(names) > 0 {
+		fmt.Fprintf(bw, "\n; Domains and hostnames\n")
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s %s\n", name, action)
+		}
+	}
+	if len(ips) > 0 {
+		fmt.Fprintf(bw, "\n; IP addresses\n")
+		for _, ip := range ips {
+			fmt.Fprintf(bw, "%s %s\n", ip, action)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// rpzName normalises a domain name, keeping a leading wildcard label
+func rpzName(value string) (string, bool) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(value), "."))
+	if name == "" || name == "*" {
+		return "", false
+	}
+
+	for i, label := range strings.Split(name, ".") {
+		if label == "*" && i == 0 {
+			continue
+		}
+		if label == "" || len(label) > 63 {
+			return "", false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return "", false
+			}
+		}
+	}
+
+	return name, len(name) <= 253
+}
+
+// rpzIP returns the owner name of a response IP trigger for an address or a
+// network: 32.7.100.51.198.rpz-ip for 198.51.100.7, and
+// 128.1.zz.db8.2001.rpz-ip for 2001:db8::1
+func rpzIP(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+
+	var ip net.IP
+	var bits int
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		ip = network.IP
+		bits, _ = network.Mask.Size()
+		if ip.To4() != nil {
+			// IPv4-mapped network, such as ::ffff:10.0.0.0/104
+			var ok bool
+			if ip, bits, ok = ipv4Prefix(network); !ok {
+				return "", false
+			}
+		}
+	} else if ip = net.ParseIP(value); ip != nil {
+		bits = 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+	} else {
+		return "", false
+	}
+
+	labels := []string{strconv.Itoa(bits)}
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := 3; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip4[i])))
+		}
+		return strings.Join(labels, ".") + ".rpz-ip", true
+	}
+
+	var groups [8]uint16
+	for i := range groups {
+		groups[i] = uint16(ip[2*i])<<8 | uint16(ip[2*i+1])
+	}
+
+	// The longest run of zero groups is replaced by zz, as :: does
+	start, length := -1, 0
+	for i := 0; i < 8; {
+		if groups[i] != 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < 8 && groups[j] == 0 {
+			j++
+		}
+		if j-i > length && j-i > 1 {
+			start, length = i, j-i
+		}
+		i = j
+	}
+
+	for i := 7; i >= 0; i-- {
+		if i >= start && i < start+length {
+			if i == start {
+				labels = append(labels, "zz")
+			}
+			continue
+		}
+		labels = append(labels, strconv.FormatUint(uint64(groups[i]), 16))
+	}
+
+	return strings.Join(labels, ".") + ".rpz-ip", true
+}
@@ -0,0 +1,107 @@
+package misp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRPZGenerator(t *testing.T) {
+	attrs := []Attribute{
+		{Type: "domain", Value: "Foo.Example.", ToIDS: true},
+		{Type: "hostname", Value: "www.bar.example", ToIDS: true},
+		{Type: "domain", Value: "*.baz.example", ToIDS: true},
+		{Type: "domain", Value: "foo.example", ToIDS: true},
+		{Type: "domain", Value: "not a domain", ToIDS: true},
+		{Type: "domain", Value: "benign.example"},
+		{Type: "ip-dst", Value: "198.51.100.7", ToIDS: true},
+		{Type: "ip-dst", Value: "203.0.113.0/24", ToIDS: true},
+		{Type: "url", Value: "http://foo.example/", ToIDS: true},
+	}
+
+	g := &RPZGenerator{Serial: 2020011502}
+
+	var buf bytes.Buffer
+	if err := g.Write(&buf, attrs); err != nil {
+		t.Fatalf("Write returned an error: %s", err)
+	}
+
+	want := `$TTL 1w;
+@               SOA localhost. root.localhost. (2020011502 2h 30m 30d 1h)
+                NS localhost.
+
+; Domains and hostnames
+*.baz.example CNAME .
+*.foo.example CNAME .
+foo.example CNAME .
+www.bar.example CNAME .
+
+; IP addresses
+24.0.113.0.203.rpz-ip CNAME .
+32.7.100.51.198.rpz-ip CNAME .
+`
+	if buf.String() != want {
+		t.Errorf("Write wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestRPZGeneratorPolicies(t *testing.T) {
+	tests := []struct {
+		g    RPZGenerator
+		want string
+	}{
+		{RPZGenerator{Policy: RPZNoData}, "www.bar.example CNAME *.\n"},
+		{RPZGenerator{Policy: RPZDrop}, "www.bar.example CNAME rpz-drop.\n"},
+		{RPZGenerator{Policy: RPZWalledGarden, WalledGarden: "garden.example"}, "www.bar.example CNAME garden.example.\n"},
+		{RPZGenerator{Policy: RPZWalledGarden, WalledGarden: "192.0.2.1"}, "www.bar.example A 192.0.2.1\n"},
+	}
+
+	attrs := []Attribute{{Type: "hostname", Value: "www.bar.example", ToIDS: true}}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.g.Write(&buf, attrs); err != nil {
+			t.Fatalf("Write returned an error: %s", err)
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte(test.want)) {
+			t.Errorf("Write with policy %s wrote\n%s", test.g.Policy, buf.String())
+		}
+	}
+
+	for _, g := range []RPZGenerator{{Policy: RPZWalledGarden}, {Policy: "foo"}} {
+		if err := g.Write(&bytes.Buffer{}, attrs); err == nil {
+			t.Errorf("Write accepted invalid policy %q", g.Policy)
+		}
+	}
+}
+
+func TestRPZIP(t *testing.T) {
+	tests := map[string]string{
+		"2001:db8::1":          "128.1.zz.db8.2001.rpz-ip",
+		"2001:db8:0:1::/64":    "64.zz.1.0.db8.2001.rpz-ip",
+		"2001:db8:1:0:1::1":    "128.1.zz.1.0.1.db8.2001.rpz-ip",
+		"2001:db8:0:1:1:1:1:1": "128.1.1.1.1.1.0.db8.2001.rpz-ip",
+		"::ffff:198.51.100.7":  "32.7.100.51.198.rpz-ip",
+		"::ffff:10.0.0.0/104":  "8.0.0.0.10.rpz-ip",
+		"::ffff:0:0/96":        "0.0.0.0.0.rpz-ip",
+		"::fffe:0:0/95":        "95.0.0.fffe.zz.rpz-ip",
+	}
+	for ip, want := range tests {
+		if got, ok := rpzIP(ip); !ok || got != want {
+			t.Errorf("rpzIP(%s) returned %s, want %s", ip, got, want)
+		}
+	}
+}
+
+func TestNextRPZSerial(t *testing.T) {
+	now := time.Date(2020, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	if s := NextRPZSerial(0, now); s != 2020011500 {
+		t.Errorf("NextRPZSerial returned %d", s)
+	}
+	if s := NextRPZSerial(2020011500, now); s != 2020011501 {
+		t.Errorf("NextRPZSerial returned %d", s)
+	}
+	if s := NextRPZSerial(2020011407, now); s != 2020011500 {
+		t.Errorf("NextRPZSerial returned %d", s)
+	}
+}
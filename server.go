@@ -0,0 +1,312 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Server is a remote MISP instance events are synchronised with. The
+// booleans are always sent, so they can be turned off by EditServer.
+type Server struct {
+	ID                  string      `json:"id,omitempty"`
+	Name                string      `json:"name,omitempty"`
+	URL                 string      `json:"url,omitempty"`
+	AuthKey             string      `json:"authkey,omitempty"`
+	OrgID               string      `json:"org_id,omitempty"`
+	RemoteOrgID         string      `json:"remote_org_id,omitempty"`
+	Push                bool        `json:"push"`
+	Pull                bool        `json:"pull"`
+	PushSightings       bool        `json:"push_sightings"`
+	PushGalaxyClusters  bool        `json:"push_galaxy_clusters"`
+	PullGalaxyClusters  bool        `json:"pull_galaxy_clusters"`
+	PushAnalystData     bool        `json:"push_analyst_data"`
+	PullAnalystData     bool        `json:"pull_analyst_data"`
+	CachingEnabled      bool        `json:"caching_enabled"`
+	Internal            bool        `json:"internal"`
+	SelfSigned          bool        `json:"self_signed"`
+	SkipProxy           bool        `json:"skip_proxy"`
+	UnpublishEvent      bool        `json:"unpublish_event"`
+	PublishWithoutEmail bool        `json:"publish_without_email"`
+	LastPulledID        string      `json:"lastpulledid,omitempty"`
+	LastPushedID        string      `json:"lastpushedid,omitempty"`
+	PullRules           string      `json:"pull_rules,omitempty"`
+	PushRules           string      `json:"push_rules,omitempty"`
+	CertFile            string      `json:"cert_file,omitempty"`
+	ClientCertFile      string      `json:"client_cert_file,omitempty"`
+	Priority            json.Number `json:"priority,omitempty"`
+
+	// Filled when listing servers, ignored by the server otherwise
+	Organisation *Organisation `json:"-"`
+	RemoteOrg    *Organisation `json:"-"`
+}
+
+// Synchronisation techniques
+const (
+	SyncFull        = "full"
+	SyncIncremental = "incremental"
+	SyncUpdate      = "update"
+)
+
+// SyncRules are the filters applied when pulling from or pushing to a
+// server, they are stored as JSON in Server.PullRules and Server.PushRules
+type SyncRules struct {
+	Tags      SyncFilter `json:"tags"`
+	Orgs      SyncFilter `json:"orgs"`
+	TypeAttrs SyncFilter `json:"type_attributes,omitempty"`
+	TypeObjs  SyncFilter `json:"type_objects,omitempty"`
+	URLParams string     `json:"url_params,omitempty"`
+}
+
+// SyncFilter lists the values to include (OR) or exclude (NOT)
+type SyncFilter struct {
+	OR  []string `json:"OR"`
+	NOT []string `json:"NOT"`
+}
+
+// UnmarshalJSON accepts values given as strings or numbers (tag and
+// organisation IDs)
+func (f *SyncFilter) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		OR  []interface{} `json:"OR"`
+		NOT []interface{} `json:"NOT"`
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&raw); err != nil {
+		return err
+	}
+
+	f.OR, f.NOT = stringifyAll(raw.OR), stringifyAll(raw.NOT)
+	return nil
+}
+
+func stringifyAll(values []interface{}) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, fmt.Sprint(v))
+	}
+
+	return out
+}
+
+func parseSyncRules(s string) (*SyncRules, error) {
+	rules := &SyncRules{}
+	if s == "" || s == "[]" {
+		return rules, nil
+	}
+
+	if err := json.Unmarshal([]byte(s), rules); err != nil {
+		return nil, fmt.Errorf("Could not decode sync rules: %s", err)
+	}
+
+	return rules, nil
+}
+
+// ParsePullRules decodes the filters used when pulling from the server
+func (s *Server) ParsePullRules() (*SyncRules, error) {
+	return parseSyncRules(s.PullRules)
+}
+
+// ParsePushRules decodes the filters used when pushing to the server
+func (s *Server) ParsePushRules() (*SyncRules, error) {
+	return parseSyncRules(s.PushRules)
+}
+
+// SetPullRules encodes the filters used when pulling from the server
+func (s *Server) SetPullRules(rules *SyncRules) error {
+	buf, err := json.Marshal(rules)
+	s.PullRules = string(buf)
+	return err
+}
+
+// SetPushRules encodes the filters used when pushing to the server
+func (s *Server) SetPushRules(rules *SyncRules) error {
+	buf, err := json.Marshal(rules)
+	s.PushRules = string(buf)
+	return err
+}
+
+type serverWrapper struct {
+	Server       Server        `json:"Server"`
+	Organisation *Organisation `json:"Organisation,omitempty"`
+	RemoteOrg    *Organisation `json:"RemoteOrg,omitempty"`
+}
+
+func (w *serverWrapper) server() *Server {
+	s := w.Server
+	s.Organisation = w.Organisation
+	s.RemoteOrg = w.RemoteOrg
+	return &s
+}
+
+// ListServers returns the servers configured for synchronisation
+func (client *Client) ListServers() ([]Server, error) {
+	var resp []serverWrapper
+	if err := client.call("GET", "/servers/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, len(resp))
+	for i := range resp {
+		servers[i] = *resp[i].server()
+	}
+
+	return servers, nil
+}
+
+// GetServer returns the server with the given ID
+func (client *Client) GetServer(serverID string) (*Server, error) {
+	servers, err := client.ListServers()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range servers {
+		if servers[i].ID == serverID {
+			return &servers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("server %s not found", serverID)
+}
+
+// AddServer adds a server to synchronise with
+func (client *Client) AddServer(server *Server) (*Server, error) {
+	return client.serverCall("/servers/add", server)
+}
+
+// EditServer updates the server identified by server.ID. All the settings
+// are replaced, the booleans included: start from the server returned by
+// GetServer to only change some of them.
+func (client *Client) EditServer(server *Server) (*Server, error) {
+	return client.serverCall(fmt.Sprintf("/servers/edit/%s", server.ID), server)
+}
+
+func (client *Client) serverCall(path string, req interface{}) (*Server, error) {
+	var resp serverWrapper
+	if err := client.call("POST", path, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.server(), nil
+}
+
+// DeleteServer removes a server
+func (client *Client) DeleteServer(serverID string) error {
+	return client.postAction(fmt.Sprintf("/servers/delete/%s", serverID), nil)
+}
+
+// Status codes of a connection test
+const (
+	ServerStatusOK                   = 1
+	ServerStatusUnreachable          = 2
+	ServerStatusUnexpectedError      = 3
+	ServerStatusAuthenticationFailed = 4
+	ServerStatusPasswordChange       = 5
+	ServerStatusTermsNotAccepted     = 6
+	ServerStatusNotSyncUser          = 7
+)
+
+// ServerConnection is the result of a connection test to a remote server
+type ServerConnection struct {
+	Status       int    `json:"status"`
+	Message      string `json:"message,omitempty"`
+	Version      string `json:"version,omitempty"`
+	LocalVersion string `json:"local_version,omitempty"`
+	Newer        string `json:"newer,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+
+	// Mismatch is empty when both servers run the same version, otherwise
+	// it tells which part of the version differs (major, minor or hotfix)
+	Mismatch string `json:"-"`
+}
+
+// OK tells if the connection and the authentication succeeded
+func (c *ServerConnection) OK() bool {
+	return c.Status == ServerStatusOK
+}
+
+// TestServerConnection checks the connection to a remote server and reads
+// its version
+func (client *Client) TestServerConnection(serverID string) (*ServerConnection, error) {
+	var resp struct {
+		ServerConnection
+		Mismatch interface{} `json:"mismatch"`
+	}
+	if err := client.call("POST", fmt.Sprintf("/servers/testConnection/%s", serverID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	// mismatch is false or the name of the differing part
+	conn := resp.ServerConnection
+	if s, ok := resp.Mismatch.(string); ok {
+		conn.Mismatch = s
+	}
+
+	return &conn, nil
+}
+
+// RemoteServerVersion returns the version of MISP running on a remote
+// server
+func (client *Client) RemoteServerVersion(serverID string) (string, error) {
+	conn, err := client.TestServerConnection(serverID)
+	if err != nil {
+		return "", err
+	}
+
+	if !conn.OK() {
+		return "", fmt.Errorf("connection to server %s failed with status=%d", serverID, conn.Status)
+	}
+
+	return conn.Version, nil
+}
+
+// ServerVersion is the version of the local server
+type ServerVersion struct {
+	Version                  string `json:"version"`
+	PyMISPRecommendedVersion string `json:"pymisp_recommended_version,omitempty"`
+	PermSync                 bool   `json:"perm_sync,omitempty"`
+	PermSighting             bool   `json:"perm_sighting,omitempty"`
+	PermGalaxyEditor         bool   `json:"perm_galaxy_editor,omitempty"`
+}
+
+// GetVersion returns the version of the server the client talks to
+func (client *Client) GetVersion() (*ServerVersion, error) {
+	var v ServerVersion
+	if err := client.call("GET", "/servers/getVersion", nil, &v); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// PullServer pulls events from a server, technique is one of SyncFull,
+// SyncIncremental, SyncUpdate. The pull usually runs in a background job.
+func (client *Client) PullServer(serverID, technique string) (*JobHandle, error) {
+	return client.jobAction(fmt.Sprintf("/servers/pull/%s/%s", serverID, technique))
+}
+
+// PushServer pushes events to a server, technique is one of SyncFull,
+// SyncIncremental
+func (client *Client) PushServer(serverID, technique string) (*JobHandle, error) {
+	return client.jobAction(fmt.Sprintf("/servers/push/%s/%s", serverID, technique))
+}
+
+// SyncRules returns the pull and push filters of a server
+func (client *Client) SyncRules(serverID string) (pull *SyncRules, push *SyncRules, err error) {
+	server, err := client.GetServer(serverID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pull, err = server.ParsePullRules(); err != nil {
+		return nil, nil, err
+	}
+	if push, err = server.ParsePushRules(); err != nil {
+		return nil, nil, err
+	}
+
+	return pull, push, nil
+}
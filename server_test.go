@@ -0,0 +1,201 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const testServerIndex = `[
+	{"Server":{"id":"1","name":"Partner","url":"https:\/\/misp.partner.org","org_id":"1","remote_org_id":"3","push":true,"pull":true,"push_sightings":false,"lastpulledid":"1542","lastpushedid":"0","self_signed":false,"pull_rules":"{\"tags\":{\"OR\":[\"tlp:white\"],\"NOT\":[12]},\"orgs\":{\"OR\":[],\"NOT\":[]},\"url_params\":\"\"}","push_rules":"[]","priority":"1"},
+	 "Organisation":{"id":"1","name":"ACME CERT"},
+	 "RemoteOrg":{"id":"3","name":"Partner CERT"}},
+	{"Server":{"id":"2","name":"Archive","url":"https:\/\/archive.acme.com","pull":false,"pull_rules":"{broken"}}
+]`
+
+func TestListServers(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/servers/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, testServerIndex)
+		})
+
+	servers, err := client.ListServers()
+	if err != nil {
+		t.Fatalf("ListServers returned an error: %s", err)
+	}
+
+	if len(servers) != 2 {
+		t.Fatalf("ListServers returned %d servers, want 2", len(servers))
+	}
+	if s := servers[0]; !s.Push || !s.Pull || s.LastPulledID != "1542" || s.RemoteOrg.Name != "Partner CERT" || s.Organisation.Name != "ACME CERT" {
+		t.Errorf("ListServers returned %+v", s)
+	}
+
+	pull, push, err := client.SyncRules("1")
+	if err != nil {
+		t.Fatalf("SyncRules returned an error: %s", err)
+	}
+	if !reflect.DeepEqual(pull.Tags, SyncFilter{OR: []string{"tlp:white"}, NOT: []string{"12"}}) {
+		t.Errorf("SyncRules returned pull tags %+v", pull.Tags)
+	}
+	if len(push.Tags.OR) != 0 || len(push.Orgs.NOT) != 0 {
+		t.Errorf("SyncRules returned push rules %+v", push)
+	}
+
+	if _, _, err := client.SyncRules("2"); err == nil {
+		t.Errorf("SyncRules did not return an error for invalid rules")
+	}
+	if _, err := client.GetServer("3"); err == nil {
+		t.Errorf("GetServer did not return an error for an unknown server")
+	}
+}
+
+func TestAddServer(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/servers/add",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got Server
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Server request: %s", err)
+			}
+			if got.URL != "https://misp.partner.org" || got.AuthKey != "s3cr3t" || !got.Pull {
+				t.Errorf("Unexpected server request: %+v", got)
+			}
+
+			rules, err := got.ParsePullRules()
+			if err != nil || len(rules.Orgs.OR) != 1 || rules.Orgs.OR[0] != "3" {
+				t.Errorf("Unexpected pull rules: %q", got.PullRules)
+			}
+
+			fmt.Fprint(w, `{"Server":{"id":"4","name":"Partner","url":"https:\/\/misp.partner.org","pull":true}}`)
+		})
+
+	server := &Server{Name: "Partner", URL: "https://misp.partner.org", AuthKey: "s3cr3t", RemoteOrgID: "3", Pull: true}
+	if err := server.SetPullRules(&SyncRules{Orgs: SyncFilter{OR: []string{"3"}}}); err != nil {
+		t.Fatalf("SetPullRules returned an error: %s", err)
+	}
+
+	got, err := client.AddServer(server)
+	if err != nil {
+		t.Fatalf("AddServer returned an error: %s", err)
+	}
+	if got.ID != "4" {
+		t.Errorf("AddServer returned %+v", got)
+	}
+}
+
+func TestEditServer(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/servers/edit/4",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json Server request: %s", err)
+			}
+			if got["push"] != false || got["pull"] != false {
+				t.Errorf("EditServer sent %+v, want push and pull disabled", got)
+			}
+
+			fmt.Fprint(w, `{"Server":{"id":"4","name":"Partner","push":false,"pull":false}}`)
+		})
+
+	mux.HandleFunc("/servers/delete/5",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Invalid server.","message":"Invalid server.","url":"\/servers\/delete\/5","errors":"Invalid server."}`)
+		})
+
+	if _, err := client.EditServer(&Server{ID: "4", Name: "Partner"}); err != nil {
+		t.Errorf("EditServer returned an error: %s", err)
+	}
+
+	if err := client.DeleteServer("5"); err == nil {
+		t.Errorf("DeleteServer did not return an error")
+	}
+}
+
+func TestTestServerConnection(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/servers/testConnection/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"status":1,"local_version":"2.4.180","version":"2.4.176","mismatch":"hotfix","newer":"local","post":1}`)
+		})
+	mux.HandleFunc("/servers/testConnection/2",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"status":4,"mismatch":false}`)
+		})
+
+	conn, err := client.TestServerConnection("1")
+	if err != nil {
+		t.Fatalf("TestServerConnection returned an error: %s", err)
+	}
+	if !conn.OK() || conn.Version != "2.4.176" || conn.Mismatch != "hotfix" || conn.Newer != "local" {
+		t.Errorf("TestServerConnection returned %+v", conn)
+	}
+
+	if version, err := client.RemoteServerVersion("1"); err != nil || version != "2.4.176" {
+		t.Errorf("RemoteServerVersion returned %q, %v", version, err)
+	}
+
+	if _, err := client.RemoteServerVersion("2"); err == nil {
+		t.Errorf("RemoteServerVersion did not return an error when authentication failed")
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/servers/getVersion",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"version":"2.4.180","pymisp_recommended_version":"2.4.180","perm_sync":true,"perm_sighting":true,"perm_galaxy_editor":false}`)
+		})
+
+	v, err := client.GetVersion()
+	if err != nil {
+		t.Fatalf("GetVersion returned an error: %s", err)
+	}
+	if v.Version != "2.4.180" || !v.PermSync {
+		t.Errorf("GetVersion returned %+v", v)
+	}
+}
+
+func TestPullServer(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/servers/pull/1/incremental",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"name":"Pull queued","message":"Pull queued for background execution. Job ID: 57","url":"\/servers\/pull\/1\/incremental"}`)
+		})
+	mux.HandleFunc("/servers/push/1/full",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"name":"Push disabled","message":"Push disabled","url":"\/servers\/push\/1\/full"}`)
+		})
+
+	job, err := client.PullServer("1", SyncIncremental)
+	if err != nil {
+		t.Fatalf("PullServer returned an error: %s", err)
+	}
+	if !job.Queued() || job.ID != "57" {
+		t.Errorf("PullServer returned %+v", job)
+	}
+
+	if _, err := client.PushServer("1", SyncFull); err == nil {
+		t.Errorf("PushServer did not return an error")
+	}
+}
@@ -0,0 +1,174 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SharingGroup is a set of organisations and servers data can be shared
+// with, using the DistributionSharingGroup level
+type SharingGroup struct {
+	ID            string      `json:"id,omitempty"`
+	UUID          string      `json:"uuid,omitempty"`
+	Name          string      `json:"name,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	Releasability string      `json:"releasability,omitempty"`
+	Local         bool        `json:"local,omitempty"`
+	Active        bool        `json:"active,omitempty"`
+	Roaming       bool        `json:"roaming,omitempty"`
+	OrgID         string      `json:"org_id,omitempty"`
+	OrgCount      json.Number `json:"org_count,omitempty"`
+	Created       string      `json:"created,omitempty"`
+	Modified      string      `json:"modified,omitempty"`
+
+	// Filled when reading sharing groups, ignored by the server otherwise
+	Organisation       *Organisation        `json:"-"`
+	SharingGroupOrg    []SharingGroupOrg    `json:"-"`
+	SharingGroupServer []SharingGroupServer `json:"-"`
+}
+
+// SharingGroupOrg is the membership of an organisation in a sharing group
+type SharingGroupOrg struct {
+	ID             string        `json:"id,omitempty"`
+	SharingGroupID string        `json:"sharing_group_id,omitempty"`
+	OrgID          string        `json:"org_id,omitempty"`
+	Extend         bool          `json:"extend,omitempty"`
+	Organisation   *Organisation `json:"Organisation,omitempty"`
+}
+
+// SharingGroupServer is the membership of a server in a sharing group. When
+// AllOrgs is set, all the organisations of the server are members.
+type SharingGroupServer struct {
+	ID             string  `json:"id,omitempty"`
+	SharingGroupID string  `json:"sharing_group_id,omitempty"`
+	ServerID       string  `json:"server_id,omitempty"`
+	AllOrgs        bool    `json:"all_orgs,omitempty"`
+	Server         *Server `json:"Server,omitempty"`
+}
+
+type sharingGroupWrapper struct {
+	SharingGroup       SharingGroup         `json:"SharingGroup"`
+	Organisation       *Organisation        `json:"Organisation,omitempty"`
+	SharingGroupOrg    []SharingGroupOrg    `json:"SharingGroupOrg,omitempty"`
+	SharingGroupServer []SharingGroupServer `json:"SharingGroupServer,omitempty"`
+}
+
+func (w *sharingGroupWrapper) sharingGroup() *SharingGroup {
+	sg := w.SharingGroup
+	sg.Organisation = w.Organisation
+	sg.SharingGroupOrg = w.SharingGroupOrg
+	sg.SharingGroupServer = w.SharingGroupServer
+	return &sg
+}
+
+// HasOrg tells if the organisation is a member of the sharing group
+func (sg *SharingGroup) HasOrg(orgID string) bool {
+	for _, sgo := range sg.SharingGroupOrg {
+		if sgo.OrgID == orgID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ApplyToAttribute restricts the distribution of the attribute to the
+// sharing group
+func (sg *SharingGroup) ApplyToAttribute(attr *Attribute) {
+	attr.Distribution = DistributionSharingGroup
+	attr.SharingGroupID = sg.ID
+}
+
+// ApplyToEvent restricts the distribution of the event to the sharing group
+func (sg *SharingGroup) ApplyToEvent(event *Event) {
+	event.Distribution = DistributionSharingGroup
+	event.SharingGroupID = sg.ID
+}
+
+// ListSharingGroups returns the sharing groups visible by the user
+func (client *Client) ListSharingGroups() ([]SharingGroup, error) {
+	var resp struct {
+		Response []sharingGroupWrapper `json:"response"`
+	}
+	if err := client.call("GET", "/sharingGroups/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	groups := make([]SharingGroup, len(resp.Response))
+	for i := range resp.Response {
+		groups[i] = *resp.Response[i].sharingGroup()
+	}
+
+	return groups, nil
+}
+
+// GetSharingGroup returns the sharing group with the given ID or UUID
+func (client *Client) GetSharingGroup(id string) (*SharingGroup, error) {
+	return client.sharingGroupCall("GET", fmt.Sprintf("/sharingGroups/view/%s", id), nil)
+}
+
+// FindSharingGroup returns the sharing group with the given name
+func (client *Client) FindSharingGroup(name string) (*SharingGroup, error) {
+	groups, err := client.ListSharingGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		if groups[i].Name == name {
+			return &groups[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("sharing group %q not found", name)
+}
+
+// AddSharingGroup creates a sharing group
+func (client *Client) AddSharingGroup(sg *SharingGroup) (*SharingGroup, error) {
+	return client.sharingGroupCall("POST", "/sharingGroups/add", sg)
+}
+
+// EditSharingGroup updates the sharing group identified by sg.ID
+func (client *Client) EditSharingGroup(sg *SharingGroup) (*SharingGroup, error) {
+	return client.sharingGroupCall("POST", fmt.Sprintf("/sharingGroups/edit/%s", sg.ID), sg)
+}
+
+func (client *Client) sharingGroupCall(method, path string, req interface{}) (*SharingGroup, error) {
+	var resp sharingGroupWrapper
+	if err := client.call(method, path, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.sharingGroup(), nil
+}
+
+// DeleteSharingGroup deletes a sharing group
+func (client *Client) DeleteSharingGroup(id string) error {
+	return client.postAction(fmt.Sprintf("/sharingGroups/delete/%s", id), nil)
+}
+
+// AddSharingGroupOrg adds an organisation to a sharing group. When extend
+// is set, the organisation can add other members.
+func (client *Client) AddSharingGroupOrg(sgID, orgID string, extend bool) error {
+	req := map[string]interface{}{"sg_id": sgID, "org_id": orgID, "extend": extend}
+	return client.postAction("/sharingGroups/addOrg", req)
+}
+
+// RemoveSharingGroupOrg removes an organisation from a sharing group
+func (client *Client) RemoveSharingGroupOrg(sgID, orgID string) error {
+	req := map[string]interface{}{"sg_id": sgID, "org_id": orgID}
+	return client.postAction("/sharingGroups/removeOrg", req)
+}
+
+// AddSharingGroupServer adds a server to a sharing group. When allOrgs is
+// set, all the organisations of the server are members.
+func (client *Client) AddSharingGroupServer(sgID, serverID string, allOrgs bool) error {
+	req := map[string]interface{}{"sg_id": sgID, "server_id": serverID, "all_orgs": allOrgs}
+	return client.postAction("/sharingGroups/addServer", req)
+}
+
+// RemoveSharingGroupServer removes a server from a sharing group
+func (client *Client) RemoveSharingGroupServer(sgID, serverID string) error {
+	req := map[string]interface{}{"sg_id": sgID, "server_id": serverID}
+	return client.postAction("/sharingGroups/removeServer", req)
+}
@@ -0,0 +1,134 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+const testSharingGroupIndex = `{"response":[
+	{"SharingGroup":{"id":"1","uuid":"5f1a2b3c-0000-4c8e-8f0d-2c4d0a3ac101","name":"Aerospace ISAC","releasability":"Members only","local":true,"active":true,"roaming":false,"org_count":"2"},
+	 "Organisation":{"id":"1","name":"ACME CERT"},
+	 "SharingGroupOrg":[{"id":"1","sharing_group_id":"1","org_id":"1","extend":true,"Organisation":{"id":"1","name":"ACME CERT"}},{"id":"2","sharing_group_id":"1","org_id":"7","extend":false}],
+	 "SharingGroupServer":[{"id":"1","sharing_group_id":"1","server_id":"0","all_orgs":false,"Server":{"id":"0","name":"Local instance","url":"https:\/\/misp.acme.com"}}],
+	 "editable":true,"deletable":true},
+	{"SharingGroup":{"id":"2","name":"Partners"},"SharingGroupOrg":[]}
+]}`
+
+func TestFindSharingGroup(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/sharingGroups/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, testSharingGroupIndex)
+		})
+
+	sg, err := client.FindSharingGroup("Aerospace ISAC")
+	if err != nil {
+		t.Fatalf("FindSharingGroup returned an error: %s", err)
+	}
+
+	if sg.ID != "1" || sg.Organisation.Name != "ACME CERT" || !sg.HasOrg("7") || sg.HasOrg("3") {
+		t.Errorf("FindSharingGroup returned %+v", sg)
+	}
+	if len(sg.SharingGroupServer) != 1 || sg.SharingGroupServer[0].Server.URL != "https://misp.acme.com" {
+		t.Errorf("FindSharingGroup returned servers %+v", sg.SharingGroupServer)
+	}
+
+	attr := &Attribute{Value: "foobar.com", Type: "domain"}
+	sg.ApplyToAttribute(attr)
+	if attr.Distribution != "4" || attr.SharingGroupID != "1" {
+		t.Errorf("ApplyToAttribute set distribution=%q sharing_group_id=%q", attr.Distribution, attr.SharingGroupID)
+	}
+
+	if _, err := client.FindSharingGroup("Unknown"); err == nil {
+		t.Errorf("FindSharingGroup did not return an error for an unknown name")
+	}
+}
+
+func TestAddSharingGroup(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/sharingGroups/add",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got SharingGroup
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json SharingGroup request: %s", err)
+			}
+			if got.Name != "Partners" || got.Releasability != "TLP:AMBER" {
+				t.Errorf("AddSharingGroup sent %+v", got)
+			}
+
+			fmt.Fprint(w, `{"SharingGroup":{"id":"2","uuid":"5f1a2b3c-1111-4c8e-8f0d-2c4d0a3ac101","name":"Partners","releasability":"TLP:AMBER","active":true}}`)
+		})
+
+	sg, err := client.AddSharingGroup(&SharingGroup{Name: "Partners", Releasability: "TLP:AMBER", Active: true})
+	if err != nil {
+		t.Fatalf("AddSharingGroup returned an error: %s", err)
+	}
+
+	if sg.ID != "2" {
+		t.Errorf("AddSharingGroup returned %+v", sg)
+	}
+}
+
+func TestAddRemoveSharingGroupOrg(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/sharingGroups/addOrg",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json addOrg request: %s", err)
+			}
+			if got["sg_id"] != "2" || got["org_id"] != "7" || got["extend"] != true {
+				t.Errorf("AddSharingGroupOrg sent %+v", got)
+			}
+
+			fmt.Fprint(w, `{"saved":true,"success":"Organisation added to the sharing group.","name":"Organisation added to the sharing group.","message":"Organisation added to the sharing group.","url":"\/sharingGroups\/addOrg"}`)
+		})
+
+	mux.HandleFunc("/sharingGroups/removeOrg",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Organisation is not in the sharing group.","message":"Organisation is not in the sharing group.","url":"\/sharingGroups\/removeOrg","errors":"Organisation is not in the sharing group."}`)
+		})
+
+	if err := client.AddSharingGroupOrg("2", "7", true); err != nil {
+		t.Errorf("AddSharingGroupOrg returned an error: %s", err)
+	}
+
+	if err := client.RemoveSharingGroupOrg("2", "8"); err == nil {
+		t.Errorf("RemoveSharingGroupOrg did not return an error")
+	}
+}
+
+func TestDeleteSharingGroup(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/sharingGroups/delete/2",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":true,"success":true,"name":"Sharing group deleted.","message":"Sharing group deleted.","url":"\/sharingGroups\/delete\/2"}`)
+		})
+
+	mux.HandleFunc("/sharingGroups/delete/3",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"saved":false,"name":"Sharing group could not be deleted.","message":"Sharing group could not be deleted.","url":"\/sharingGroups\/delete\/3","errors":"Sharing group could not be deleted."}`)
+		})
+
+	if err := client.DeleteSharingGroup("2"); err != nil {
+		t.Errorf("DeleteSharingGroup returned an error: %s", err)
+	}
+
+	if err := client.DeleteSharingGroup("3"); err == nil {
+		t.Errorf("DeleteSharingGroup did not return an error")
+	}
+}
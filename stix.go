@@ -0,0 +1,1019 @@
+package misp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STIXObject is a STIX 2.1 object (SDO, SCO, SRO or marking definition) as
+// encoded in JSON
+type STIXObject map[string]interface{}
+
+// Type returns the STIX type of the object
+func (o STIXObject) Type() string {
+	return o.String("type")
+}
+
+// ID returns the STIX identifier of the object
+func (o STIXObject) ID() string {
+	return o.String("id")
+}
+
+// String returns the property key of the object when it is a string
+func (o STIXObject) String(key string) string {
+	s, _ := o[key].(string)
+	return s
+}
+
+// STIXBundle is a collection of STIX 2.1 objects
+type STIXBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []STIXObject `json:"objects"`
+}
+
+// Find returns the object of the bundle with the given identifier, nil if
+// it is missing
+func (b *STIXBundle) Find(id string) STIXObject {
+	for _, o := range b.Objects {
+		if o.ID() == id {
+			return o
+		}
+	}
+
+	return nil
+}
+
+// stixNamespace is the namespace of the UUIDv5 identifiers of the objects
+// built by the converter which have no MISP UUID, such as relationships
+// between attributes and galaxy clusters
+const stixNamespace = "8a3f5e4c-3b2e-5d7a-9f61-2c0b7e1d4a90"
+
+// stixSCONamespace is the namespace of the deterministic identifiers of
+// STIX cyber observables, defined by the STIX 2.1 specification
+const stixSCONamespace = "00abedb4-aa42-466c-9c01-fed23315a9b7"
+
+// uuid5 returns the version 5 UUID of name in namespace
+func uuid5(namespace, name string) string {
+	ns, _ := hex.DecodeString(strings.Replace(namespace, "-", "", -1))
+
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// stixIDContributingProperties lists, by SCO type, the properties the
+// identifier of an observable is derived from
+var stixIDContributingProperties = map[string][]string{
+	"autonomous-system":    {"number"},
+	"domain-name":          {"value"},
+	"email-addr":           {"value"},
+	"file":                 {"hashes", "name", "extensions", "parent_directory_ref"},
+	"ipv4-addr":            {"value"},
+	"ipv6-addr":            {"value"},
+	"mac-addr":             {"value"},
+	"mutex":                {"name"},
+	"network-traffic":      {"start", "end", "src_ref", "dst_ref", "src_port", "dst_port", "protocols", "extensions"},
+	"url":                  {"value"},
+	"windows-registry-key": {"key", "values"},
+	"x509-certificate":     {"hashes", "serial_number"},
+}
+
+// newSCO returns an observable with a deterministic identifier, as defined
+// by the STIX 2.1 specification. Observables without contributing
+// properties (e.g. email-message) are identified by all their properties.
+func newSCO(typ string, props STIXObject) STIXObject {
+	contributing := make(map[string]interface{})
+	if keys, ok := stixIDContributingProperties[typ]; ok {
+		for _, k := range keys {
+			if v, ok := props[k]; ok {
+				contributing[k] = v
+			}
+		}
+		if hashes, ok := contributing["hashes"]; ok {
+			contributing["hashes"] = stixPreferredHash(hashes)
+		}
+	} else {
+		for k, v := range props {
+			contributing[k] = v
+		}
+	}
+
+	// encoding/json sorts the keys of maps, which is enough to canonicalize
+	// these simple values as JCS (RFC 8785) does, once HTML escaping is off
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(contributing)
+
+	sco := STIXObject{
+		"type":         typ,
+		"spec_version": "2.1",
+		"id":           typ + "--" + uuid5(stixSCONamespace, strings.TrimSuffix(buf.String(), "\n")),
+	}
+	for k, v := range props {
+		sco[k] = v
+	}
+
+	return sco
+}
+
+// stixHashPreference is the order in which a hash is picked to identify
+// an observable
+var stixHashPreference = []string{"MD5", "SHA-1", "SHA-256", "SHA-512"}
+
+// stixPreferredHash returns the single hash of hashes contributing to the
+// identifier of an observable: the first one of stixHashPreference, or the
+// first algorithm in lexical order
+func stixPreferredHash(hashes interface{}) map[string]string {
+	all := make(map[string]string)
+	switch hashes := hashes.(type) {
+	case map[string]string:
+		all = hashes
+	case map[string]interface{}:
+		for k, v := range hashes {
+			all[k], _ = v.(string)
+		}
+	}
+
+	for _, algorithm := range stixHashPreference {
+		if h, ok := all[algorithm]; ok {
+			return map[string]string{algorithm: h}
+		}
+	}
+
+	var first string
+	for algorithm := range all {
+		if first == "" || algorithm < first {
+			first = algorithm
+		}
+	}
+	if first == "" {
+		return all
+	}
+
+	return map[string]string{first: all[first]}
+}
+
+// stixQuote returns s as a string literal of a STIX pattern
+func stixQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
+
+// stixHashPath returns the object path of a hash in a pattern
+func stixHashPath(object, algorithm string) string {
+	if strings.ContainsAny(algorithm, "-") {
+		algorithm = "'" + algorithm + "'"
+	}
+
+	return object + ":hashes." + algorithm
+}
+
+// stixTimeFormat is the format of STIX timestamps, in UTC with millisecond
+// precision
+const stixTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// stixTimestamp converts a MISP unix timestamp, fallback is returned when
+// it is not set
+func stixTimestamp(ts json.Number, fallback string) string {
+	n, err := ts.Int64()
+	if err != nil || n <= 0 {
+		return fallback
+	}
+
+	return time.Unix(n, 0).UTC().Format(stixTimeFormat)
+}
+
+// stixSeen converts the first_seen or last_seen field of an attribute
+func stixSeen(seen, fallback string) string {
+	t, err := time.Parse(time.RFC3339Nano, seen)
+	if err != nil {
+		return fallback
+	}
+
+	return t.UTC().Format(stixTimeFormat)
+}
+
+// stixTLPMarkings are the TLP marking definitions of the STIX 2.1
+// specification, by MISP tag
+var stixTLPMarkings = map[string]STIXObject{
+	"tlp:white": stixTLP("613f2e26-407d-48c7-9eca-b8e91df99dc9", "white"),
+	"tlp:clear": stixTLP("613f2e26-407d-48c7-9eca-b8e91df99dc9", "white"),
+	"tlp:green": stixTLP("34098fce-860f-48ae-8e50-ebd3cc5e41da", "green"),
+	"tlp:amber": stixTLP("f88d31f6-486f-44da-b317-01333bde0b82", "amber"),
+	"tlp:red":   stixTLP("5e57c739-391a-4eb3-b6be-7d15ca92d5ed", "red"),
+}
+
+func stixTLP(uuid, colour string) STIXObject {
+	return STIXObject{
+		"type":            "marking-definition",
+		"spec_version":    "2.1",
+		"id":              "marking-definition--" + uuid,
+		"created":         "2017-01-20T00:00:00.000Z",
+		"definition_type": "tlp",
+		"name":            "TLP:" + strings.ToUpper(colour),
+		"definition":      map[string]interface{}{"tlp": colour},
+	}
+}
+
+// stixAttributeMapping converts the values of an attribute type. Composite
+// values (e.g. filename|md5) are split. pattern returns the comparison
+// expressions of an indicator, observables the cyber observables; both
+// return nil when the value cannot be converted.
+type stixAttributeMapping struct {
+	pattern     func(v []string) []string
+	observables func(v []string) []STIXObject
+}
+
+func stixValueMapping(object, property string) stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			return []string{fmt.Sprintf("%s:%s = %s", object, property, stixQuote(v[0]))}
+		},
+		observables: func(v []string) []STIXObject {
+			return []STIXObject{newSCO(object, STIXObject{property: v[0]})}
+		},
+	}
+}
+
+func stixIPType(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "ipv6-addr"
+	}
+
+	return "ipv4-addr"
+}
+
+// stixIPMapping converts ip-src and ip-dst attributes, with a port when
+// withPort is set. side is "src" or "dst".
+func stixIPMapping(side string, withPort bool) stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			p := []string{
+				fmt.Sprintf("network-traffic:%s_ref.type = '%s'", side, stixIPType(v[0])),
+				fmt.Sprintf("network-traffic:%s_ref.value = %s", side, stixQuote(v[0])),
+			}
+			if withPort {
+				port, err := strconv.Atoi(v[1])
+				if err != nil {
+					return nil
+				}
+				p = append(p, fmt.Sprintf("network-traffic:%s_port = %d", side, port))
+			}
+			return p
+		},
+		observables: func(v []string) []STIXObject {
+			ip := newSCO(stixIPType(v[0]), STIXObject{"value": v[0]})
+			props := STIXObject{side + "_ref": ip.ID(), "protocols": []string{"tcp"}}
+			if withPort {
+				port, err := strconv.Atoi(v[1])
+				if err != nil {
+					return nil
+				}
+				props[side+"_port"] = port
+			}
+			return []STIXObject{ip, newSCO("network-traffic", props)}
+		},
+	}
+}
+
+func stixDomainIPMapping() stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			return []string{
+				"domain-name:value = " + stixQuote(v[0]),
+				"domain-name:resolves_to_refs[*].value = " + stixQuote(v[1]),
+			}
+		},
+		observables: func(v []string) []STIXObject {
+			ip := newSCO(stixIPType(v[1]), STIXObject{"value": v[1]})
+			domain := newSCO("domain-name", STIXObject{"value": v[0], "resolves_to_refs": []string{ip.ID()}})
+			return []STIXObject{domain, ip}
+		},
+	}
+}
+
+// stixHashMapping converts hashes of files, with the file name first when
+// withName is set
+func stixHashMapping(algorithm string, withName bool) stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			if withName {
+				return []string{
+					"file:name = " + stixQuote(v[0]),
+					stixHashPath("file", algorithm) + " = " + stixQuote(v[1]),
+				}
+			}
+			return []string{stixHashPath("file", algorithm) + " = " + stixQuote(v[0])}
+		},
+		observables: func(v []string) []STIXObject {
+			if withName {
+				return []STIXObject{newSCO("file", STIXObject{"name": v[0], "hashes": map[string]string{algorithm: v[1]}})}
+			}
+			return []STIXObject{newSCO("file", STIXObject{"hashes": map[string]string{algorithm: v[0]}})}
+		},
+	}
+}
+
+func stixX509Mapping(algorithm string) stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			return []string{stixHashPath("x509-certificate", algorithm) + " = " + stixQuote(v[0])}
+		},
+		observables: func(v []string) []STIXObject {
+			return []STIXObject{newSCO("x509-certificate", STIXObject{"hashes": map[string]string{algorithm: v[0]}})}
+		},
+	}
+}
+
+func stixIntMapping(object, property string, parse func(string) (int, error)) stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			n, err := parse(v[0])
+			if err != nil {
+				return nil
+			}
+			return []string{fmt.Sprintf("%s:%s = %d", object, property, n)}
+		},
+		observables: func(v []string) []STIXObject {
+			n, err := parse(v[0])
+			if err != nil {
+				return nil
+			}
+			return []STIXObject{newSCO(object, STIXObject{property: n})}
+		},
+	}
+}
+
+func stixParseAS(s string) (int, error) {
+	return strconv.Atoi(strings.TrimPrefix(strings.ToUpper(s), "AS"))
+}
+
+func stixEmailMapping(ref string) stixAttributeMapping {
+	return stixAttributeMapping{
+		pattern: func(v []string) []string {
+			path := ref + ".value"
+			if ref == "to_refs" {
+				path = "to_refs[*].value"
+			}
+			return []string{"email-message:" + path + " = " + stixQuote(v[0])}
+		},
+		observables: func(v []string) []STIXObject {
+			addr := newSCO("email-addr", STIXObject{"value": v[0]})
+			props := STIXObject{"is_multipart": false, ref: addr.ID()}
+			if ref == "to_refs" {
+				props[ref] = []string{addr.ID()}
+			}
+			return []STIXObject{addr, newSCO("email-message", props)}
+		},
+	}
+}
+
+// stixAttributeMappings follows the mapping of attributes to patterns and
+// observables used by misp-stix. Types missing here are exported as
+// x-misp-attribute custom objects.
+var stixAttributeMappings = map[string]stixAttributeMapping{
+	"AS":                      stixIntMapping("autonomous-system", "number", stixParseAS),
+	"domain":                  stixValueMapping("domain-name", "value"),
+	"domain|ip":               stixDomainIPMapping(),
+	"email":                   stixValueMapping("email-addr", "value"),
+	"email-dst":               stixEmailMapping("to_refs"),
+	"email-src":               stixEmailMapping("from_ref"),
+	"email-subject":           stixValueMapping("email-message", "subject"),
+	"filename":                stixValueMapping("file", "name"),
+	"filename|md5":            stixHashMapping("MD5", true),
+	"filename|sha1":           stixHashMapping("SHA-1", true),
+	"filename|sha256":         stixHashMapping("SHA-256", true),
+	"filename|sha512":         stixHashMapping("SHA-512", true),
+	"filename|ssdeep":         stixHashMapping("SSDEEP", true),
+	"filename|tlsh":           stixHashMapping("TLSH", true),
+	"hostname":                stixValueMapping("domain-name", "value"),
+	"ip-dst":                  stixIPMapping("dst", false),
+	"ip-dst|port":             stixIPMapping("dst", true),
+	"ip-src":                  stixIPMapping("src", false),
+	"ip-src|port":             stixIPMapping("src", true),
+	"link":                    stixValueMapping("url", "value"),
+	"mac-address":             stixValueMapping("mac-addr", "value"),
+	"md5":                     stixHashMapping("MD5", false),
+	"mutex":                   stixValueMapping("mutex", "name"),
+	"regkey":                  stixValueMapping("windows-registry-key", "key"),
+	"sha1":                    stixHashMapping("SHA-1", false),
+	"sha256":                  stixHashMapping("SHA-256", false),
+	"sha512":                  stixHashMapping("SHA-512", false),
+	"size-in-bytes":           stixIntMapping("file", "size", strconv.Atoi),
+	"ssdeep":                  stixHashMapping("SSDEEP", false),
+	"tlsh":                    stixHashMapping("TLSH", false),
+	"uri":                     stixValueMapping("url", "value"),
+	"url":                     stixValueMapping("url", "value"),
+	"x509-fingerprint-md5":    stixX509Mapping("MD5"),
+	"x509-fingerprint-sha1":   stixX509Mapping("SHA-1"),
+	"x509-fingerprint-sha256": stixX509Mapping("SHA-256"),
+
+	// No observable can hold these values alone, they are only exported as
+	// indicators
+	"port": {pattern: func(v []string) []string {
+		port, err := strconv.Atoi(v[0])
+		if err != nil {
+			return nil
+		}
+		return []string{fmt.Sprintf("network-traffic:dst_port = %d", port)}
+	}},
+	"user-agent": {pattern: func(v []string) []string {
+		return []string{"network-traffic:extensions.'http-request-ext'.request_header.'User-Agent' = " + stixQuote(v[0])}
+	}},
+}
+
+// stixAttributeValues splits the value of an attribute, nil is returned
+// when a composite value does not have two parts
+func stixAttributeValues(attr *Attribute) []string {
+	if !strings.Contains(attr.Type, "|") {
+		return []string{attr.Value}
+	}
+
+	v := strings.SplitN(attr.Value, "|", 2)
+	if len(v) != 2 {
+		return nil
+	}
+
+	return v
+}
+
+// stixGalaxyType returns the SDO type of the clusters of a galaxy, the
+// clusters of unknown galaxies are exported as x-misp-galaxy-cluster
+func stixGalaxyType(galaxyType string) string {
+	switch {
+	case strings.HasSuffix(galaxyType, "attack-pattern"):
+		return "attack-pattern"
+	case strings.HasSuffix(galaxyType, "course-of-action"):
+		return "course-of-action"
+	case strings.HasSuffix(galaxyType, "intrusion-set"):
+		return "intrusion-set"
+	case strings.HasSuffix(galaxyType, "malware"):
+		return "malware"
+	case strings.HasSuffix(galaxyType, "tool"):
+		return "tool"
+	}
+
+	switch galaxyType {
+	case "threat-actor", "microsoft-activity-group":
+		return "threat-actor"
+	case "malpedia", "ransomware", "rat", "botnet", "banker", "backdoor", "stealer", "android", "exploit-kit":
+		return "malware"
+	}
+
+	return "x-misp-galaxy-cluster"
+}
+
+type stixPendingReference struct {
+	id         string
+	sourceRef  string
+	targetUUID string
+	typ        string
+	created    string
+}
+
+// stixConverter accumulates the STIX objects of an event
+type stixConverter struct {
+	objects []STIXObject
+	seen    map[string]bool
+
+	// STIX identifier of the MISP objects and attributes, by MISP UUID
+	ids        map[string]string
+	references []stixPendingReference
+
+	createdBy string
+	markings  []string
+	now       string
+}
+
+func newSTIXConverter() *stixConverter {
+	return &stixConverter{
+		seen: make(map[string]bool),
+		ids:  make(map[string]string),
+		now:  time.Now().UTC().Format(stixTimeFormat),
+	}
+}
+
+func (c *stixConverter) add(o STIXObject) {
+	if c.seen[o.ID()] {
+		return
+	}
+
+	c.seen[o.ID()] = true
+	c.objects = append(c.objects, o)
+}
+
+// sdo returns a domain object with the properties shared by every object
+// converted from MISP
+func (c *stixConverter) sdo(typ, uuid, created, modified string, labels []string, tags []Tag) STIXObject {
+	o := STIXObject{
+		"type":         typ,
+		"spec_version": "2.1",
+		"id":           typ + "--" + uuid,
+		"created":      created,
+		"modified":     modified,
+	}
+
+	if c.createdBy != "" {
+		o["created_by_ref"] = c.createdBy
+	}
+
+	markings := append([]string(nil), c.markings...)
+	for _, tag := range tags {
+		if m, ok := stixTLPMarkings[strings.ToLower(tag.Name)]; ok {
+			c.add(m)
+			markings = appendUnique(markings, m.ID())
+		} else {
+			labels = append(labels, tag.Name)
+		}
+	}
+
+	if len(labels) > 0 {
+		o["labels"] = labels
+	}
+	if len(markings) > 0 {
+		o["object_marking_refs"] = markings
+	}
+
+	return o
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
+
+func stixBool(b bool) string {
+	if b {
+		return "True"
+	}
+
+	return "False"
+}
+
+// attribute converts an attribute and returns the identifier of the main
+// STIX object
+func (c *stixConverter) attribute(attr *Attribute, fallback string) (string, error) {
+	if attr.UUID == "" {
+		return "", fmt.Errorf("attribute %q has no UUID", attr.Value)
+	}
+
+	modified := stixTimestamp(json.Number(attr.Timestamp), fallback)
+	labels := []string{
+		fmt.Sprintf("misp:type=%q", attr.Type),
+		fmt.Sprintf("misp:category=%q", attr.Category),
+		fmt.Sprintf("misp:to_ids=%q", stixBool(attr.ToIDS)),
+	}
+
+	var o STIXObject
+	switch attr.Type {
+	case "vulnerability":
+		o = c.sdo("vulnerability", attr.UUID, modified, modified, labels, attr.Tag)
+		o["name"] = attr.Value
+		o["external_references"] = []map[string]string{{"source_name": "cve", "external_id": attr.Value}}
+	case "campaign-name":
+		o = c.sdo("campaign", attr.UUID, modified, modified, labels, attr.Tag)
+		o["name"] = attr.Value
+	case "threat-actor":
+		o = c.sdo("threat-actor", attr.UUID, modified, modified, labels, attr.Tag)
+		o["name"] = attr.Value
+	}
+
+	values := stixAttributeValues(attr)
+	mapping, mapped := stixAttributeMappings[attr.Type]
+	mapped = mapped && values != nil
+
+	if o == nil && mapped && attr.ToIDS {
+		if p := mapping.pattern(values); p != nil {
+			o = c.sdo("indicator", attr.UUID, modified, modified, labels, attr.Tag)
+			o["pattern"] = "[" + strings.Join(p, " AND ") + "]"
+			o["pattern_type"] = "stix"
+			o["pattern_version"] = "2.1"
+			o["valid_from"] = stixSeen(attr.FirstSeen, modified)
+			if attr.LastSeen != "" {
+				o["valid_until"] = stixSeen(attr.LastSeen, modified)
+			}
+			o["kill_chain_phases"] = []map[string]string{{"kill_chain_name": "misp-category", "phase_name": attr.Category}}
+		}
+	}
+
+	if o == nil && mapped && mapping.observables != nil {
+		if scos := mapping.observables(values); scos != nil {
+			o = c.observedData(attr.UUID, modified, labels, attr.Tag, attr.FirstSeen, attr.LastSeen, scos)
+		}
+	}
+
+	if o == nil {
+		o = c.sdo("x-misp-attribute", attr.UUID, modified, modified, labels, attr.Tag)
+		o["x_misp_type"] = attr.Type
+		o["x_misp_category"] = attr.Category
+		o["x_misp_value"] = attr.Value
+	}
+
+	if attr.Comment != "" {
+		o["description"] = attr.Comment
+	}
+
+	c.add(o)
+	c.ids[attr.UUID] = o.ID()
+
+	relationship := "related-to"
+	if o.Type() == "indicator" {
+		relationship = "indicates"
+	}
+	for _, id := range c.galaxies(attr.Galaxy, modified) {
+		c.relationship("", o.ID(), relationship, id, modified)
+	}
+
+	return o.ID(), nil
+}
+
+// observedData adds the observables and returns the observed-data
+// referencing them
+func (c *stixConverter) observedData(uuid, modified string, labels []string, tags []Tag, firstSeen, lastSeen string, scos []STIXObject) STIXObject {
+	o := c.sdo("observed-data", uuid, modified, modified, labels, tags)
+	o["first_observed"] = stixSeen(firstSeen, modified)
+	o["last_observed"] = stixSeen(lastSeen, modified)
+	o["number_observed"] = 1
+
+	var refs []string
+	for _, sco := range scos {
+		c.add(sco)
+		refs = append(refs, sco.ID())
+	}
+	o["object_refs"] = refs
+
+	return o
+}
+
+// object converts a MISP object, as an indicator combining the patterns of
+// its attributes when one of them is to_ids, as observed data otherwise
+func (c *stixConverter) object(obj *Object, fallback string) (string, error) {
+	if obj.UUID == "" {
+		return "", fmt.Errorf("object %q has no UUID", obj.Name)
+	}
+
+	modified := stixTimestamp(obj.Timestamp, fallback)
+
+	toIDS := false
+	var patterns []string
+	var scos []STIXObject
+	for i := range obj.Attribute {
+		attr := &obj.Attribute[i]
+		toIDS = toIDS || attr.ToIDS
+
+		values := stixAttributeValues(attr)
+		mapping, ok := stixAttributeMappings[attr.Type]
+		if !ok || values == nil {
+			continue
+		}
+
+		patterns = append(patterns, mapping.pattern(values)...)
+		if mapping.observables != nil {
+			scos = append(scos, mapping.observables(values)...)
+		}
+	}
+
+	labels := []string{
+		fmt.Sprintf("misp:name=%q", obj.Name),
+		fmt.Sprintf("misp:meta-category=%q", obj.MetaCategory),
+		fmt.Sprintf("misp:to_ids=%q", stixBool(toIDS)),
+	}
+
+	var o STIXObject
+	switch {
+	case toIDS && len(patterns) > 0:
+		o = c.sdo("indicator", obj.UUID, modified, modified, labels, nil)
+		o["pattern"] = "[" + strings.Join(patterns, " AND ") + "]"
+		o["pattern_type"] = "stix"
+		o["pattern_version"] = "2.1"
+		o["valid_from"] = stixSeen(obj.FirstSeen, modified)
+		o["kill_chain_phases"] = []map[string]string{{"kill_chain_name": "misp-category", "phase_name": obj.MetaCategory}}
+	case len(scos) > 0:
+		o = c.observedData(obj.UUID, modified, labels, nil, obj.FirstSeen, obj.LastSeen, mergeSCOs(scos))
+	default:
+		o = c.sdo("x-misp-object", obj.UUID, modified, modified, labels, nil)
+		o["x_misp_name"] = obj.Name
+		var attrs []map[string]interface{}
+		for _, attr := range obj.Attribute {
+			attrs = append(attrs, map[string]interface{}{
+				"type":            attr.Type,
+				"object_relation": attr.ObjectRelation,
+				"category":        attr.Category,
+				"value":           attr.Value,
+				"to_ids":          attr.ToIDS,
+				"uuid":            attr.UUID,
+			})
+		}
+		o["x_misp_attributes"] = attrs
+	}
+
+	if obj.Comment != "" {
+		o["description"] = obj.Comment
+	}
+
+	c.add(o)
+	c.ids[obj.UUID] = o.ID()
+	for _, attr := range obj.Attribute {
+		if attr.UUID != "" {
+			c.ids[attr.UUID] = o.ID()
+		}
+	}
+
+	for _, ref := range obj.ObjectReference {
+		c.references = append(c.references, stixPendingReference{
+			id:         ref.UUID,
+			sourceRef:  o.ID(),
+			targetUUID: ref.ReferencedUUID,
+			typ:        ref.RelationshipType,
+			created:    stixTimestamp(ref.Timestamp, modified),
+		})
+	}
+
+	return o.ID(), nil
+}
+
+// mergeSCOs merges the file and certificate observables built from the
+// attributes of a same object, e.g. the name and the hashes of a file
+func mergeSCOs(scos []STIXObject) []STIXObject {
+	var out []STIXObject
+	merged := make(map[string]STIXObject)
+
+	for _, sco := range scos {
+		typ := sco.Type()
+		if typ != "file" && typ != "x509-certificate" {
+			out = append(out, sco)
+			continue
+		}
+
+		props, ok := merged[typ]
+		if !ok {
+			props = STIXObject{}
+			merged[typ] = props
+		}
+		for k, v := range sco {
+			switch k {
+			case "type", "spec_version", "id":
+			case "hashes":
+				hashes, _ := props[k].(map[string]string)
+				if hashes == nil {
+					hashes = make(map[string]string)
+					props[k] = hashes
+				}
+				for algorithm, h := range v.(map[string]string) {
+					hashes[algorithm] = h
+				}
+			default:
+				props[k] = v
+			}
+		}
+	}
+
+	for _, typ := range []string{"file", "x509-certificate"} {
+		if props, ok := merged[typ]; ok {
+			out = append(out, newSCO(typ, props))
+		}
+	}
+
+	return out
+}
+
+// galaxies converts the clusters of galaxies and returns their identifiers
+func (c *stixConverter) galaxies(galaxies []Galaxy, fallback string) []string {
+	var ids []string
+
+	for _, galaxy := range galaxies {
+		typ := stixGalaxyType(galaxy.Type)
+
+		for _, cluster := range galaxy.GalaxyCluster {
+			if cluster.UUID == "" {
+				continue
+			}
+
+			labels := []string{
+				fmt.Sprintf("misp:galaxy-name=%q", galaxy.Name),
+				fmt.Sprintf("misp:galaxy-type=%q", galaxy.Type),
+			}
+
+			o := STIXObject{
+				"type":         typ,
+				"spec_version": "2.1",
+				"id":           typ + "--" + cluster.UUID,
+				"created":      fallback,
+				"modified":     fallback,
+				"name":         cluster.Value,
+				"labels":       labels,
+			}
+			if cluster.Description != "" {
+				o["description"] = cluster.Description
+			}
+
+			switch typ {
+			case "malware":
+				o["is_family"] = true
+			case "threat-actor", "intrusion-set":
+				if synonyms := cluster.MetaStrings("synonyms"); len(synonyms) > 0 {
+					o["aliases"] = synonyms
+				}
+			case "attack-pattern":
+				var refs []map[string]string
+				for _, id := range cluster.MetaStrings("external_id") {
+					refs = append(refs, map[string]string{"source_name": "mitre-attack", "external_id": id})
+				}
+				if refs != nil {
+					o["external_references"] = refs
+				}
+				var phases []map[string]string
+				for _, phase := range cluster.MetaStrings("kill_chain") {
+					if i := strings.LastIndexByte(phase, ':'); i > 0 {
+						phases = append(phases, map[string]string{"kill_chain_name": phase[:i], "phase_name": phase[i+1:]})
+					}
+				}
+				if phases != nil {
+					o["kill_chain_phases"] = phases
+				}
+			case "x-misp-galaxy-cluster":
+				o["x_misp_type"] = galaxy.Type
+				o["x_misp_value"] = cluster.Value
+			}
+
+			c.add(o)
+			ids = append(ids, o.ID())
+		}
+	}
+
+	return ids
+}
+
+// relationship adds a relationship, uuid is derived from the source, type
+// and target when empty
+func (c *stixConverter) relationship(uuid, source, typ, target, created string) {
+	if uuid == "" {
+		uuid = uuid5(stixNamespace, source+"|"+typ+"|"+target)
+	}
+
+	o := STIXObject{
+		"type":              "relationship",
+		"spec_version":      "2.1",
+		"id":                "relationship--" + uuid,
+		"created":           created,
+		"modified":          created,
+		"relationship_type": typ,
+		"source_ref":        source,
+		"target_ref":        target,
+	}
+	if c.createdBy != "" {
+		o["created_by_ref"] = c.createdBy
+	}
+
+	c.add(o)
+}
+
+// resolveReferences converts the object references whose target was
+// converted
+func (c *stixConverter) resolveReferences() {
+	for _, ref := range c.references {
+		target, ok := c.ids[ref.targetUUID]
+		if !ok || ref.typ == "" {
+			continue
+		}
+
+		c.relationship(ref.id, ref.sourceRef, ref.typ, target, ref.created)
+	}
+}
+
+// EventToSTIX converts an event to a STIX 2.1 bundle, following the mapping
+// of misp-stix. The event is exported as a report referencing its
+// attributes, objects and galaxy clusters; its creator organisation as an
+// identity. Identifiers are derived from the MISP UUIDs, converting the
+// same event twice returns the same identifiers.
+func EventToSTIX(event *Event) (*STIXBundle, error) {
+	if event.UUID == "" {
+		return nil, fmt.Errorf("event %q has no UUID", event.Info)
+	}
+
+	c := newSTIXConverter()
+	modified := stixTimestamp(event.Timestamp, c.now)
+
+	var identity STIXObject
+	if event.Orgc != nil && event.Orgc.UUID != "" {
+		identity = STIXObject{
+			"type":           "identity",
+			"spec_version":   "2.1",
+			"id":             "identity--" + event.Orgc.UUID,
+			"created":        modified,
+			"modified":       modified,
+			"name":           event.Orgc.Name,
+			"identity_class": "organization",
+		}
+		c.add(identity)
+		c.createdBy = identity.ID()
+	}
+
+	// The report is built first so that the TLP of the event applies to
+	// every object
+	created := modified
+	if d, err := time.Parse("2006-01-02", event.Date); err == nil {
+		created = d.UTC().Format(stixTimeFormat)
+	}
+	report := c.sdo("report", event.UUID, created, modified, nil, event.Tag)
+	c.markings, _ = report["object_marking_refs"].([]string)
+	report["name"] = event.Info
+	report["report_types"] = []string{"threat-report"}
+	report["published"] = stixTimestamp(event.PublishTimestamp, modified)
+
+	// The identity and markings stay outside of the report
+	first := len(c.objects)
+
+	for i := range event.Attribute {
+		if _, err := c.attribute(&event.Attribute[i], modified); err != nil {
+			return nil, err
+		}
+	}
+	for i := range event.Object {
+		if _, err := c.object(&event.Object[i], modified); err != nil {
+			return nil, err
+		}
+	}
+	c.galaxies(event.Galaxy, modified)
+	c.resolveReferences()
+
+	var refs []string
+	for _, o := range c.objects[first:] {
+		if o.Type() != "marking-definition" {
+			refs = append(refs, o.ID())
+		}
+	}
+	// object_refs cannot be empty
+	if len(refs) == 0 && identity != nil {
+		refs = append(refs, identity.ID())
+	}
+	report["object_refs"] = refs
+
+	objects := make([]STIXObject, 0, len(c.objects)+1)
+	for _, o := range c.objects {
+		if o.Type() == "identity" || o.Type() == "marking-definition" {
+			objects = append(objects, o)
+		}
+	}
+	objects = append(objects, report)
+	for _, o := range c.objects {
+		if o.Type() != "identity" && o.Type() != "marking-definition" {
+			objects = append(objects, o)
+		}
+	}
+
+	return &STIXBundle{Type: "bundle", ID: "bundle--" + event.UUID, Objects: objects}, nil
+}
+
+// AttributeToSTIX converts an attribute, outside of any event, to STIX 2.1
+// objects. The main object (indicator, observed-data or SDO) comes first.
+func AttributeToSTIX(attr *Attribute) ([]STIXObject, error) {
+	c := newSTIXConverter()
+	id, err := c.attribute(attr, c.now)
+	if err != nil {
+		return nil, err
+	}
+
+	return mainFirst(c.objects, id), nil
+}
+
+// ObjectToSTIX converts a MISP object, outside of any event, to STIX 2.1
+// objects. The main object comes first.
+func ObjectToSTIX(obj *Object) ([]STIXObject, error) {
+	c := newSTIXConverter()
+	id, err := c.object(obj, c.now)
+	if err != nil {
+		return nil, err
+	}
+
+	return mainFirst(c.objects, id), nil
+}
+
+func mainFirst(objects []STIXObject, id string) []STIXObject {
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].ID() == id && objects[j].ID() != id
+	})
+
+	return objects
+}
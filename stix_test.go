@@ -0,0 +1,230 @@
+package misp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEventToSTIX(t *testing.T) {
+	event := &Event{
+		UUID:             "5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101",
+		Info:             "Foobar campaign",
+		Date:             "2020-01-15",
+		Timestamp:        "1579110170",
+		PublishTimestamp: "1579110200",
+		Orgc:             &Organisation{Name: "ACME CERT", UUID: "5e000000-1111-4a1e-9fba-5b2a0a3ac101"},
+		Tag:              []Tag{{Name: "tlp:green"}, {Name: "misp-galaxy:threat-actor=\"APT 42\""}},
+		Galaxy: []Galaxy{{
+			Name: "Threat Actor",
+			Type: "threat-actor",
+			GalaxyCluster: []GalaxyCluster{{
+				UUID:  "5e1f0000-aaaa-4a1e-9fba-5b2a0a3ac101",
+				Value: "APT 42",
+				Meta:  map[string]interface{}{"synonyms": []interface{}{"Foobar Team"}},
+			}},
+		}},
+		Attribute: []Attribute{
+			{
+				UUID: "5e1f4f1b-0001-4a1e-9fba-5b2a0a3ac101", Type: "domain", Category: "Network activity",
+				Value: "foo'bar.com", ToIDS: true, Timestamp: "1579110170", Comment: "C2",
+				Galaxy: []Galaxy{{Name: "Malpedia", Type: "malpedia", GalaxyCluster: []GalaxyCluster{{UUID: "5e1f0000-bbbb-4a1e-9fba-5b2a0a3ac101", Value: "Foobar RAT"}}}},
+			},
+			{UUID: "5e1f4f1b-0002-4a1e-9fba-5b2a0a3ac101", Type: "ip-dst|port", Category: "Network activity", Value: "198.51.100.7|443", Timestamp: "1579110170"},
+			{UUID: "5e1f4f1b-0003-4a1e-9fba-5b2a0a3ac101", Type: "text", Category: "Other", Value: "Some notes", Timestamp: "1579110170"},
+			{UUID: "5e1f4f1b-0004-4a1e-9fba-5b2a0a3ac101", Type: "vulnerability", Category: "External analysis", Value: "CVE-2020-0601", Timestamp: "1579110170"},
+		},
+		Object: []Object{{
+			Name:         "file",
+			MetaCategory: "file",
+			UUID:         "5e1f4f1c-0001-4a1e-9fba-5b2a0a3ac101",
+			Timestamp:    "1579110170",
+			Attribute: []Attribute{
+				{UUID: "5e1f4f1b-0005-4a1e-9fba-5b2a0a3ac101", Type: "filename", ObjectRelation: "filename", Value: "foobar.exe"},
+				{UUID: "5e1f4f1b-0006-4a1e-9fba-5b2a0a3ac101", Type: "md5", ObjectRelation: "md5", Value: "68b329da9893e34099c7d8ad5cb9c940"},
+			},
+			ObjectReference: []ObjectReference{{
+				UUID:             "5e1f4f1d-0001-4a1e-9fba-5b2a0a3ac101",
+				ReferencedUUID:   "5e1f4f1b-0001-4a1e-9fba-5b2a0a3ac101",
+				RelationshipType: "communicates-with",
+			}},
+		}},
+	}
+
+	bundle, err := EventToSTIX(event)
+	if err != nil {
+		t.Fatalf("EventToSTIX returned an error: %s", err)
+	}
+
+	if bundle.ID != "bundle--5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101" {
+		t.Errorf("Bundle ID is %s", bundle.ID)
+	}
+
+	report := bundle.Find("report--5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101")
+	if report == nil {
+		t.Fatalf("Bundle has no report")
+	}
+	if report["name"] != "Foobar campaign" || report["published"] != "2020-01-15T17:43:20.000Z" || report["created"] != "2020-01-15T00:00:00.000Z" {
+		t.Errorf("Report is %+v", report)
+	}
+	if !reflect.DeepEqual(report["object_marking_refs"], []string{"marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da"}) {
+		t.Errorf("Report markings are %v", report["object_marking_refs"])
+	}
+	if !reflect.DeepEqual(report["labels"], []string{"misp-galaxy:threat-actor=\"APT 42\""}) {
+		t.Errorf("Report labels are %v", report["labels"])
+	}
+	for _, id := range report["object_refs"].([]string) {
+		if bundle.Find(id) == nil {
+			t.Errorf("Report references missing object %s", id)
+		}
+	}
+
+	indicator := bundle.Find("indicator--5e1f4f1b-0001-4a1e-9fba-5b2a0a3ac101")
+	if indicator == nil {
+		t.Fatalf("Bundle has no indicator for the domain")
+	}
+	if indicator["pattern"] != `[domain-name:value = 'foo\'bar.com']` || indicator["description"] != "C2" {
+		t.Errorf("Indicator is %+v", indicator)
+	}
+	if indicator["created_by_ref"] != "identity--5e000000-1111-4a1e-9fba-5b2a0a3ac101" {
+		t.Errorf("Indicator is created by %v", indicator["created_by_ref"])
+	}
+	if !reflect.DeepEqual(indicator["labels"], []string{`misp:type="domain"`, `misp:category="Network activity"`, `misp:to_ids="True"`}) {
+		t.Errorf("Indicator labels are %v", indicator["labels"])
+	}
+
+	observed := bundle.Find("observed-data--5e1f4f1b-0002-4a1e-9fba-5b2a0a3ac101")
+	if observed == nil {
+		t.Fatalf("Bundle has no observed-data for the IP")
+	}
+	refs := observed["object_refs"].([]string)
+	if len(refs) != 2 {
+		t.Fatalf("Observed data references %v", refs)
+	}
+	traffic := bundle.Find(refs[1])
+	if traffic.Type() != "network-traffic" || traffic["dst_ref"] != refs[0] || traffic["dst_port"] != 443 {
+		t.Errorf("Network traffic is %+v", traffic)
+	}
+	if ip := bundle.Find(refs[0]); ip.Type() != "ipv4-addr" || ip["value"] != "198.51.100.7" {
+		t.Errorf("IP is %+v", ip)
+	}
+
+	if o := bundle.Find("x-misp-attribute--5e1f4f1b-0003-4a1e-9fba-5b2a0a3ac101"); o == nil || o["x_misp_value"] != "Some notes" {
+		t.Errorf("Custom attribute is %+v", o)
+	}
+	if o := bundle.Find("vulnerability--5e1f4f1b-0004-4a1e-9fba-5b2a0a3ac101"); o == nil || o["name"] != "CVE-2020-0601" {
+		t.Errorf("Vulnerability is %+v", o)
+	}
+
+	file := bundle.Find("observed-data--5e1f4f1c-0001-4a1e-9fba-5b2a0a3ac101")
+	if file == nil {
+		t.Fatalf("Bundle has no observed-data for the file object")
+	}
+	fileRefs := file["object_refs"].([]string)
+	if len(fileRefs) != 1 {
+		t.Fatalf("File observed data references %v", fileRefs)
+	}
+	if sco := bundle.Find(fileRefs[0]); sco["name"] != "foobar.exe" || sco["hashes"].(map[string]string)["MD5"] != "68b329da9893e34099c7d8ad5cb9c940" {
+		t.Errorf("File is %+v", sco)
+	}
+
+	if rel := bundle.Find("relationship--5e1f4f1d-0001-4a1e-9fba-5b2a0a3ac101"); rel == nil || rel["source_ref"] != file.ID() || rel["target_ref"] != indicator.ID() || rel["relationship_type"] != "communicates-with" {
+		t.Errorf("Object reference relationship is %+v", rel)
+	}
+
+	malware := bundle.Find("malware--5e1f0000-bbbb-4a1e-9fba-5b2a0a3ac101")
+	if malware == nil || malware["is_family"] != true {
+		t.Fatalf("Malware is %+v", malware)
+	}
+	found := false
+	for _, o := range bundle.Objects {
+		if o.Type() == "relationship" && o["source_ref"] == indicator.ID() && o["target_ref"] == malware.ID() && o["relationship_type"] == "indicates" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Bundle has no relationship between the indicator and the malware")
+	}
+
+	if actor := bundle.Find("threat-actor--5e1f0000-aaaa-4a1e-9fba-5b2a0a3ac101"); actor == nil || !reflect.DeepEqual(actor["aliases"], []string{"Foobar Team"}) {
+		t.Errorf("Threat actor is %+v", actor)
+	}
+
+	// Identifiers are deterministic
+	again, _ := EventToSTIX(event)
+	a, _ := json.Marshal(bundle)
+	b, _ := json.Marshal(again)
+	if string(a) != string(b) {
+		t.Errorf("Converting the same event twice returned different bundles")
+	}
+}
+
+func TestAttributeToSTIX(t *testing.T) {
+	tests := []struct {
+		attr    Attribute
+		pattern string
+	}{
+		{Attribute{Type: "ip-src", Value: "2001:db8::1"}, "[network-traffic:src_ref.type = 'ipv6-addr' AND network-traffic:src_ref.value = '2001:db8::1']"},
+		{Attribute{Type: "filename|sha256", Value: "foo.exe|e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}, "[file:name = 'foo.exe' AND file:hashes.'SHA-256' = 'e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855']"},
+		{Attribute{Type: "AS", Value: "AS64496"}, "[autonomous-system:number = 64496]"},
+		{Attribute{Type: "email-dst", Value: "foo@bar.com"}, "[email-message:to_refs[*].value = 'foo@bar.com']"},
+		{Attribute{Type: "user-agent", Value: "Foobar/1.0"}, "[network-traffic:extensions.'http-request-ext'.request_header.'User-Agent' = 'Foobar/1.0']"},
+	}
+
+	for _, test := range tests {
+		attr := test.attr
+		attr.UUID = "5e1f4f1b-0000-4a1e-9fba-5b2a0a3ac101"
+		attr.ToIDS = true
+		attr.Timestamp = "1579110170"
+
+		objects, err := AttributeToSTIX(&attr)
+		if err != nil {
+			t.Fatalf("AttributeToSTIX returned an error: %s", err)
+		}
+		if objects[0].Type() != "indicator" || objects[0]["pattern"] != test.pattern {
+			t.Errorf("AttributeToSTIX(%s) returned %+v, want pattern %s", attr.Type, objects[0], test.pattern)
+		}
+	}
+
+	if _, err := AttributeToSTIX(&Attribute{Type: "domain", Value: "foobar.com"}); err == nil {
+		t.Errorf("AttributeToSTIX accepted an attribute without UUID")
+	}
+
+	// Observables of the same value have the same identifier
+	a, _ := AttributeToSTIX(&Attribute{UUID: "5e1f4f1b-0000-4a1e-9fba-5b2a0a3ac101", Type: "domain", Value: "foobar.com"})
+	b, _ := AttributeToSTIX(&Attribute{UUID: "5e1f4f1b-1111-4a1e-9fba-5b2a0a3ac101", Type: "hostname", Value: "foobar.com"})
+	if a[0].Type() != "observed-data" || a[1].ID() != b[1].ID() {
+		t.Errorf("AttributeToSTIX returned %+v and %+v", a, b)
+	}
+}
+
+func TestUUID5(t *testing.T) {
+	// Same as uuid.uuid5() of Python
+	got := "ipv4-addr--" + uuid5(stixSCONamespace, `{"value":"198.51.100.3"}`)
+	if got != "ipv4-addr--28bb3599-77cd-5a82-a950-b5bc3caf07c4" {
+		t.Errorf("uuid5 returned %s", got)
+	}
+}
+
+func TestNewSCO(t *testing.T) {
+	// uuid5 of the JCS serialisation, as computed by the stix2 Python library
+	url := newSCO("url", STIXObject{"value": "http://a/?x=1&y=2"})
+	if url.ID() != "url--01df22e1-3bff-5843-8722-0e11d46650d7" {
+		t.Errorf("newSCO returned %s", url.ID())
+	}
+
+	// Only the preferred hash is part of the identifier
+	file := newSCO("file", STIXObject{
+		"name": "evil.exe",
+		"hashes": map[string]string{
+			"SHA-256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			"MD5":     "68b329da9893e34099c7d8ad5cb9c940",
+		},
+	})
+	if file.ID() != "file--6a7adf97-62b5-5833-a178-cf87559c58a6" {
+		t.Errorf("newSCO returned %s", file.ID())
+	}
+	if hashes, _ := file["hashes"].(map[string]string); len(hashes) != 2 {
+		t.Errorf("newSCO dropped hashes: %+v", file)
+	}
+}
@@ -0,0 +1,1177 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSTIXBundle decodes a STIX 2.1 bundle. Numbers are decoded as
+// json.Number.
+func ParseSTIXBundle(r io.Reader) (*STIXBundle, error) {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+
+	var bundle STIXBundle
+	if err := d.Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("Could not decode STIX bundle: %s", err)
+	}
+
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("not a STIX bundle: type=%q", bundle.Type)
+	}
+
+	return &bundle, nil
+}
+
+// STIXImportResult is the event built from a STIX bundle
+type STIXImportResult struct {
+	Event *Event
+
+	// Unmapped lists the objects of the bundle which could not be
+	// converted, with the reason in Errors, by object identifier
+	Unmapped []STIXObject
+	Errors   map[string]string
+}
+
+// stixField is a value extracted from a pattern or an observable, named
+// after the MISP attribute type it maps to
+type stixField struct {
+	name  string
+	value string
+}
+
+// stixHashTypes maps the STIX hash algorithms to MISP types
+var stixHashTypes = map[string]string{
+	"MD5":     "md5",
+	"SHA-1":   "sha1",
+	"SHA1":    "sha1",
+	"SHA-256": "sha256",
+	"SHA256":  "sha256",
+	"SHA-512": "sha512",
+	"SHA512":  "sha512",
+	"SSDEEP":  "ssdeep",
+	"TLSH":    "tlsh",
+}
+
+func stixHashType(path string) string {
+	return stixHashTypes[strings.ToUpper(strings.Trim(path, "'"))]
+}
+
+// stixPathField returns the field of a comparison of an indicator pattern,
+// the empty string when the comparison is ignored (such as the type of the
+// reference of network traffic) and ok=false when it is not supported
+func stixPathField(path string) (field string, ok bool) {
+	switch path {
+	case "domain-name:value":
+		return "domain", true
+	case "domain-name:resolves_to_refs[*].value":
+		return "resolved-ip", true
+	case "ipv4-addr:value", "ipv6-addr:value", "network-traffic:dst_ref.value":
+		return "ip-dst", true
+	case "network-traffic:src_ref.value":
+		return "ip-src", true
+	case "network-traffic:src_ref.type", "network-traffic:dst_ref.type":
+		return "", true
+	case "network-traffic:src_port":
+		return "src-port", true
+	case "network-traffic:dst_port":
+		return "dst-port", true
+	case "url:value":
+		return "url", true
+	case "email-addr:value":
+		return "email", true
+	case "email-message:from_ref.value":
+		return "email-src", true
+	case "email-message:to_refs[*].value":
+		return "email-dst", true
+	case "email-message:subject":
+		return "email-subject", true
+	case "file:name":
+		return "filename", true
+	case "file:size":
+		return "size-in-bytes", true
+	case "mutex:name":
+		return "mutex", true
+	case "autonomous-system:number":
+		return "AS", true
+	case "mac-addr:value":
+		return "mac-address", true
+	case "windows-registry-key:key":
+		return "regkey", true
+	case "windows-registry-key:values[*].data":
+		return "regkey-data", true
+	case "network-traffic:extensions.'http-request-ext'.request_header.'User-Agent'":
+		return "user-agent", true
+	}
+
+	if strings.HasPrefix(path, "file:hashes.") {
+		if t := stixHashType(strings.TrimPrefix(path, "file:hashes.")); t != "" {
+			return t, true
+		}
+	}
+	if strings.HasPrefix(path, "x509-certificate:hashes.") {
+		switch stixHashType(strings.TrimPrefix(path, "x509-certificate:hashes.")) {
+		case "md5":
+			return "x509-fingerprint-md5", true
+		case "sha1":
+			return "x509-fingerprint-sha1", true
+		case "sha256":
+			return "x509-fingerprint-sha256", true
+		}
+	}
+
+	return "", false
+}
+
+// stixValueString formats a constant of a pattern or a property of an
+// observable
+func stixValueString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+
+	return "", false
+}
+
+// stixCompositeTypes are the pairs of fields merged into a single
+// attribute
+var stixCompositeTypes = map[[2]string]string{
+	{"domain", "resolved-ip"}: "domain|ip",
+	{"ip-dst", "dst-port"}:    "ip-dst|port",
+	{"ip-src", "src-port"}:    "ip-src|port",
+	{"regkey", "regkey-data"}: "regkey|value",
+}
+
+// stixObjectTemplates gives the object relation of the fields each MISP
+// object can hold, in order of preference
+var stixObjectTemplates = []struct {
+	name         string
+	metaCategory string
+	relations    map[string]string
+}{
+	{"file", "file", map[string]string{
+		"filename": "filename", "size-in-bytes": "size-in-bytes",
+		"md5": "md5", "sha1": "sha1", "sha256": "sha256", "sha512": "sha512", "ssdeep": "ssdeep", "tlsh": "tlsh",
+	}},
+	{"domain-ip", "network", map[string]string{"domain": "domain", "resolved-ip": "ip", "ip-dst": "ip"}},
+	{"ip-port", "network", map[string]string{"ip-src": "ip-src", "ip-dst": "ip-dst", "src-port": "src-port", "dst-port": "dst-port", "domain": "domain"}},
+	{"email", "network", map[string]string{"email-src": "from", "email-dst": "to", "email-subject": "subject"}},
+	{"x509", "network", map[string]string{
+		"x509-fingerprint-md5": "x509-fingerprint-md5", "x509-fingerprint-sha1": "x509-fingerprint-sha1",
+		"x509-fingerprint-sha256": "x509-fingerprint-sha256",
+	}},
+}
+
+// stixFieldType returns the MISP type of a field
+func stixFieldType(field string) string {
+	switch field {
+	case "resolved-ip":
+		return "ip-dst"
+	case "src-port", "dst-port":
+		return "port"
+	case "regkey-data":
+		return ""
+	}
+
+	return field
+}
+
+// stixDefaultCategories gives the category of the imported attributes by
+// type, the others are in "Other"
+var stixDefaultCategories = map[string]string{
+	"AS":                      "Network activity",
+	"domain":                  "Network activity",
+	"domain|ip":               "Network activity",
+	"hostname":                "Network activity",
+	"ip-dst":                  "Network activity",
+	"ip-dst|port":             "Network activity",
+	"ip-src":                  "Network activity",
+	"ip-src|port":             "Network activity",
+	"mac-address":             "Network activity",
+	"port":                    "Network activity",
+	"url":                     "Network activity",
+	"user-agent":              "Network activity",
+	"x509-fingerprint-md5":    "Network activity",
+	"x509-fingerprint-sha1":   "Network activity",
+	"x509-fingerprint-sha256": "Network activity",
+	"email":                   "Payload delivery",
+	"email-dst":               "Payload delivery",
+	"email-src":               "Payload delivery",
+	"email-subject":           "Payload delivery",
+	"filename":                "Payload delivery",
+	"md5":                     "Payload delivery",
+	"sha1":                    "Payload delivery",
+	"sha256":                  "Payload delivery",
+	"sha512":                  "Payload delivery",
+	"ssdeep":                  "Payload delivery",
+	"tlsh":                    "Payload delivery",
+	"mutex":                   "Artifacts dropped",
+	"regkey":                  "Persistence mechanism",
+	"regkey|value":            "Persistence mechanism",
+	"vulnerability":           "External analysis",
+	"campaign-name":           "Attribution",
+	"threat-actor":            "Attribution",
+}
+
+// stixFieldsToMISP combines the fields of a pattern observation or of an
+// observable into an attribute or an object. The fields of objects exported
+// by MISP, whose name is given, are never merged into an attribute.
+func stixFieldsToMISP(fields []stixField, object string) (*Attribute, *Object, error) {
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("no value")
+	}
+
+	switch {
+	case object != "":
+	case len(fields) == 1:
+		t := stixFieldType(fields[0].name)
+		if t == "" {
+			return nil, nil, fmt.Errorf("%s cannot be imported alone", fields[0].name)
+		}
+		return &Attribute{Type: t, Value: fields[0].value}, nil, nil
+	case len(fields) == 2:
+		a, b := fields[0], fields[1]
+		for _, pair := range [][2]stixField{{a, b}, {b, a}} {
+			if t, ok := stixCompositeTypes[[2]string{pair[0].name, pair[1].name}]; ok {
+				return &Attribute{Type: t, Value: pair[0].value + "|" + pair[1].value}, nil, nil
+			}
+		}
+		if a.name == "filename" || b.name == "filename" {
+			name, hash := a, b
+			if b.name == "filename" {
+				name, hash = b, a
+			}
+			if stixIsHash(hash.name) {
+				return &Attribute{Type: "filename|" + hash.name, Value: name.value + "|" + hash.value}, nil, nil
+			}
+		}
+	}
+
+	for _, template := range stixObjectTemplates {
+		if object != "" && template.name != object {
+			continue
+		}
+
+		obj := &Object{Name: template.name, MetaCategory: template.metaCategory}
+		for _, f := range fields {
+			relation, ok := template.relations[f.name]
+			if !ok {
+				obj = nil
+				break
+			}
+			obj.Attribute = append(obj.Attribute, Attribute{
+				Type:           stixFieldType(f.name),
+				ObjectRelation: relation,
+				Value:          f.value,
+			})
+		}
+		if obj != nil {
+			return nil, obj, nil
+		}
+	}
+
+	// Objects without template keep the field names as relations
+	if object != "" {
+		obj := &Object{Name: object}
+		for _, f := range fields {
+			obj.Attribute = append(obj.Attribute, Attribute{Type: stixFieldType(f.name), ObjectRelation: f.name, Value: f.value})
+		}
+		return nil, obj, nil
+	}
+
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+
+	return nil, nil, fmt.Errorf("cannot combine %s", strings.Join(names, ", "))
+}
+
+func hasTag(tags []Tag, name string) bool {
+	for _, t := range tags {
+		if t.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stixIsHash tells if a field is a file hash
+func stixIsHash(field string) bool {
+	for _, t := range stixHashTypes {
+		if t == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stixImporter builds an event from the objects of a bundle
+type stixImporter struct {
+	bundle  *STIXBundle
+	objects map[string]STIXObject
+	event   *Event
+	result  *STIXImportResult
+
+	consumed map[string]bool
+
+	// MISP element each STIX object was converted to
+	attributes map[string]int    // index in event.Attribute
+	mispObjs   map[string]int    // index in event.Object
+	tags       map[string]string // galaxy tags
+}
+
+// STIXToEvent converts a STIX 2.1 bundle to an event, following the
+// mapping of misp-stix: the first report gives the metadata of the event,
+// the identity creating it the creator organisation, TLP markings and
+// labels become tags. Indicators (whose patterns are parsed) and observed
+// data become attributes, or objects when they combine several values;
+// relationships between objects become object references. SDOs created by
+// MISP with galaxy labels become galaxy tags. The objects which could not be
+// converted are listed in the result.
+func STIXToEvent(bundle *STIXBundle) (*STIXImportResult, error) {
+	imp := &stixImporter{
+		bundle:     bundle,
+		objects:    make(map[string]STIXObject),
+		event:      &Event{},
+		result:     &STIXImportResult{Errors: make(map[string]string)},
+		consumed:   make(map[string]bool),
+		attributes: make(map[string]int),
+		mispObjs:   make(map[string]int),
+		tags:       make(map[string]string),
+	}
+	imp.result.Event = imp.event
+
+	for _, o := range bundle.Objects {
+		if o.ID() == "" {
+			return nil, fmt.Errorf("STIX object without identifier")
+		}
+		imp.objects[o.ID()] = o
+	}
+
+	imp.report()
+
+	// Galaxy tags first, so that relationships can use them
+	for _, o := range bundle.Objects {
+		imp.galaxy(o)
+	}
+
+	for _, o := range bundle.Objects {
+		switch o.Type() {
+		case "indicator":
+			imp.indicator(o)
+		case "observed-data":
+			imp.observedData(o)
+		case "vulnerability", "campaign", "threat-actor":
+			if !imp.consumed[o.ID()] {
+				imp.sdoAttribute(o)
+			}
+		case "x-misp-attribute":
+			imp.customAttribute(o)
+		case "x-misp-object":
+			imp.customObject(o)
+		}
+	}
+
+	imp.standaloneObservables()
+
+	for _, o := range bundle.Objects {
+		if o.Type() == "relationship" {
+			imp.relationship(o)
+		}
+	}
+
+	for _, o := range bundle.Objects {
+		if !imp.consumed[o.ID()] {
+			imp.result.Unmapped = append(imp.result.Unmapped, o)
+			if _, ok := imp.result.Errors[o.ID()]; !ok {
+				imp.result.Errors[o.ID()] = fmt.Sprintf("%s objects are not supported", o.Type())
+			}
+		}
+	}
+
+	return imp.result, nil
+}
+
+func (imp *stixImporter) fail(o STIXObject, format string, args ...interface{}) {
+	imp.result.Errors[o.ID()] = fmt.Sprintf(format, args...)
+}
+
+// stixUUID returns the UUID part of a STIX identifier
+func stixUUID(id string) string {
+	if i := strings.Index(id, "--"); i >= 0 {
+		return id[i+2:]
+	}
+
+	return ""
+}
+
+func stixStrings(v interface{}) []string {
+	var out []string
+	switch v := v.(type) {
+	case []string:
+		out = v
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+
+	return out
+}
+
+var stixMISPLabel = regexp.MustCompile(`^misp:([a-z_-]+)="(.*)"$`)
+
+// stixLabels returns the MISP metadata labels (misp:type="domain") and the
+// other labels of an object
+func stixLabels(o STIXObject) (map[string]string, []string) {
+	meta := make(map[string]string)
+	var others []string
+
+	for _, label := range stixStrings(o["labels"]) {
+		if m := stixMISPLabel.FindStringSubmatch(label); m != nil {
+			meta[m[1]] = m[2]
+		} else {
+			others = append(others, label)
+		}
+	}
+
+	return meta, others
+}
+
+// objectTags returns the tags of the labels and TLP markings of an object
+func (imp *stixImporter) objectTags(o STIXObject) []Tag {
+	_, labels := stixLabels(o)
+
+	var tags []Tag
+	for _, label := range labels {
+		tags = append(tags, Tag{Name: label})
+	}
+
+	for _, ref := range stixStrings(o["object_marking_refs"]) {
+		if tag := imp.markingTag(ref); tag != "" {
+			tags = append(tags, Tag{Name: tag})
+		}
+	}
+
+	return tags
+}
+
+// markingTag returns the tag of a TLP marking definition
+func (imp *stixImporter) markingTag(ref string) string {
+	for name, m := range stixTLPMarkings {
+		if m.ID() == ref && name != "tlp:clear" {
+			imp.consumed[ref] = true
+			return name
+		}
+	}
+
+	m, ok := imp.objects[ref]
+	if !ok || m.String("definition_type") != "tlp" {
+		return ""
+	}
+
+	def, _ := m["definition"].(map[string]interface{})
+	colour, _ := def["tlp"].(string)
+	if colour == "" {
+		return ""
+	}
+
+	imp.consumed[ref] = true
+	return "tlp:" + strings.ToLower(colour)
+}
+
+func stixDate(ts string) string {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return ""
+	}
+
+	return t.UTC().Format("2006-01-02")
+}
+
+func stixUnix(ts string) json.Number {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return ""
+	}
+
+	return json.Number(strconv.FormatInt(t.Unix(), 10))
+}
+
+// report fills the metadata of the event from the first report of the
+// bundle, and its creator
+func (imp *stixImporter) report() {
+	var report STIXObject
+	for _, o := range imp.bundle.Objects {
+		if o.Type() == "report" || o.Type() == "grouping" {
+			report = o
+			break
+		}
+	}
+
+	creator := ""
+	if report != nil {
+		imp.consumed[report.ID()] = true
+		imp.event.UUID = stixUUID(report.ID())
+		imp.event.Info = report.String("name")
+		imp.event.Date = stixDate(report.String("published"))
+		if imp.event.Date == "" {
+			imp.event.Date = stixDate(report.String("created"))
+		}
+		imp.event.Tag = imp.objectTags(report)
+		creator = report.String("created_by_ref")
+	} else {
+		imp.event.Info = "Import of STIX " + imp.bundle.ID
+	}
+
+	// Identities creating objects are the creator organisation
+	for _, o := range imp.bundle.Objects {
+		if ref := o.String("created_by_ref"); ref != "" {
+			if _, ok := imp.objects[ref]; ok {
+				imp.consumed[ref] = true
+				if creator == "" {
+					creator = ref
+				}
+			}
+		}
+	}
+
+	if identity, ok := imp.objects[creator]; ok {
+		imp.event.Orgc = &Organisation{Name: identity.String("name"), UUID: stixUUID(creator)}
+	}
+}
+
+// galaxy converts the SDOs exported by MISP from galaxy clusters to tags
+func (imp *stixImporter) galaxy(o STIXObject) {
+	meta, _ := stixLabels(o)
+	galaxyType, ok := meta["galaxy-type"]
+	if !ok {
+		return
+	}
+
+	value := o.String("name")
+	if value == "" {
+		value = o.String("x_misp_value")
+	}
+	if value == "" {
+		return
+	}
+
+	imp.tags[o.ID()] = fmt.Sprintf("misp-galaxy:%s=%q", galaxyType, value)
+	imp.consumed[o.ID()] = true
+}
+
+// addAttribute adds an attribute converted from o, the attributes after
+// the first one get an identifier derived from the one of o
+func (imp *stixImporter) addAttribute(o STIXObject, attr *Attribute, n int) {
+	meta, _ := stixLabels(o)
+
+	attr.UUID = stixUUID(o.ID())
+	if n > 0 {
+		attr.UUID = uuid5(stixNamespace, fmt.Sprintf("%s#%d", o.ID(), n))
+	}
+
+	// Keep the type set by MISP when it has the same meaning, e.g.
+	// hostname for a domain-name
+	if t, ok := meta["type"]; ok && t != attr.Type && stixSameMapping(t, attr.Type, attr.Value) {
+		attr.Type = t
+	}
+
+	attr.Category = meta["category"]
+	if attr.Category == "" {
+		for _, phase := range stixPhases(o) {
+			if phase["kill_chain_name"] == "misp-category" {
+				attr.Category = phase["phase_name"]
+			}
+		}
+	}
+	if attr.Category == "" {
+		attr.Category = stixDefaultCategories[attr.Type]
+	}
+	if attr.Category == "" {
+		attr.Category = "Other"
+	}
+
+	attr.Comment = o.String("description")
+	attr.Timestamp = string(stixUnix(o.String("modified")))
+	// Markings are repeated on the objects of a report
+	for _, tag := range imp.objectTags(o) {
+		if !hasTag(imp.event.Tag, tag.Name) {
+			attr.Tag = append(attr.Tag, tag)
+		}
+	}
+
+	imp.event.Attribute = append(imp.event.Attribute, *attr)
+	if n == 0 {
+		imp.attributes[o.ID()] = len(imp.event.Attribute) - 1
+	}
+	imp.consumed[o.ID()] = true
+}
+
+func (imp *stixImporter) addObject(o STIXObject, obj *Object, n int) {
+	meta, _ := stixLabels(o)
+
+	obj.UUID = stixUUID(o.ID())
+	if n > 0 {
+		obj.UUID = uuid5(stixNamespace, fmt.Sprintf("%s#%d", o.ID(), n))
+	}
+	if name, ok := meta["name"]; ok {
+		obj.Name = name
+	}
+	if mc, ok := meta["meta-category"]; ok {
+		obj.MetaCategory = mc
+	}
+	obj.Comment = o.String("description")
+	obj.Timestamp = stixUnix(o.String("modified"))
+
+	toIDS := o.Type() == "indicator"
+	for i := range obj.Attribute {
+		attr := &obj.Attribute[i]
+		attr.ToIDS = toIDS
+		attr.UUID = uuid5(stixNamespace, fmt.Sprintf("%s#%s#%d", o.ID(), attr.ObjectRelation, i))
+		attr.Category = stixDefaultCategories[attr.Type]
+		if attr.Category == "" {
+			attr.Category = "Other"
+		}
+	}
+
+	imp.event.Object = append(imp.event.Object, *obj)
+	if n == 0 {
+		imp.mispObjs[o.ID()] = len(imp.event.Object) - 1
+	}
+	imp.consumed[o.ID()] = true
+}
+
+// stixSameMapping tells if two attribute types are exported to the same
+// pattern for value
+func stixSameMapping(a, b, value string) bool {
+	ma, ok := stixAttributeMappings[a]
+	if !ok {
+		return false
+	}
+	mb, ok := stixAttributeMappings[b]
+	if !ok {
+		return false
+	}
+
+	values := stixAttributeValues(&Attribute{Type: a, Value: value})
+	if values == nil {
+		return false
+	}
+
+	return strings.Join(ma.pattern(values), " AND ") == strings.Join(mb.pattern(values), " AND ")
+}
+
+func stixPhases(o STIXObject) []map[string]string {
+	var phases []map[string]string
+
+	list, _ := o["kill_chain_phases"].([]interface{})
+	for _, p := range list {
+		if p, ok := p.(map[string]interface{}); ok {
+			phase := make(map[string]string)
+			for k, v := range p {
+				phase[k], _ = v.(string)
+			}
+			phases = append(phases, phase)
+		}
+	}
+
+	if list, ok := o["kill_chain_phases"].([]map[string]string); ok {
+		phases = append(phases, list...)
+	}
+
+	return phases
+}
+
+// indicator converts the pattern of an indicator. Comparisons joined by AND
+// make a single attribute or object; joined by OR, an attribute each.
+func (imp *stixImporter) indicator(o STIXObject) {
+	if t := o.String("pattern_type"); t != "" && t != "stix" {
+		imp.fail(o, "%s patterns are not supported", t)
+		return
+	}
+
+	pattern, err := ParseSTIXPattern(o.String("pattern"))
+	if err != nil {
+		imp.fail(o, "invalid pattern: %s", err)
+		return
+	}
+
+	var groups [][]stixField
+	for _, obs := range pattern.Observations {
+		var fields []stixField
+		for _, c := range obs.Comparisons {
+			if c.Operator != "=" || c.Negated {
+				imp.fail(o, "operator %s is not supported", c.Operator)
+				return
+			}
+
+			name, ok := stixPathField(c.Path)
+			if !ok {
+				imp.fail(o, "%s is not supported", c.Path)
+				return
+			}
+			if name == "" {
+				continue
+			}
+
+			value, ok := stixValueString(c.Value)
+			if !ok {
+				imp.fail(o, "invalid value of %s", c.Path)
+				return
+			}
+			fields = append(fields, stixField{name, value})
+		}
+
+		if obs.Operator == "OR" {
+			for _, f := range fields {
+				groups = append(groups, []stixField{f})
+			}
+		} else {
+			groups = append(groups, fields)
+		}
+	}
+
+	if pattern.Operator == "AND" || pattern.Operator == "FOLLOWEDBY" {
+		imp.fail(o, "observations joined by %s are not supported", pattern.Operator)
+		return
+	}
+
+	imp.addGroups(o, groups, true)
+}
+
+// addGroups converts each group of fields to an attribute or an object
+func (imp *stixImporter) addGroups(o STIXObject, groups [][]stixField, toIDS bool) {
+	meta, _ := stixLabels(o)
+
+	type converted struct {
+		attr *Attribute
+		obj  *Object
+	}
+
+	var all []converted
+	for _, fields := range groups {
+		attr, obj, err := stixFieldsToMISP(fields, meta["name"])
+		if err != nil {
+			imp.fail(o, "%s", err)
+			return
+		}
+		all = append(all, converted{attr, obj})
+	}
+
+	nattr, nobj := 0, 0
+	for _, c := range all {
+		if c.attr != nil {
+			c.attr.ToIDS = toIDS
+			imp.addAttribute(o, c.attr, nattr)
+			nattr++
+		} else {
+			imp.addObject(o, c.obj, nobj)
+			nobj++
+		}
+	}
+}
+
+// observableFields returns the fields of an observable, following its
+// references to other observables
+func (imp *stixImporter) observableFields(sco STIXObject) ([]stixField, error) {
+	value := func(ref interface{}) (string, bool) {
+		id, _ := ref.(string)
+		if o, ok := imp.objects[id]; ok {
+			imp.consumed[id] = true
+			return o.String("value"), true
+		}
+		return "", false
+	}
+
+	var fields []stixField
+	add := func(name string, v interface{}) {
+		if s, ok := stixValueString(v); ok && s != "" {
+			fields = append(fields, stixField{name, s})
+		}
+	}
+
+	switch sco.Type() {
+	case "domain-name":
+		add("domain", sco["value"])
+		for _, ref := range stixStrings(sco["resolves_to_refs"]) {
+			if v, ok := value(ref); ok {
+				add("resolved-ip", v)
+			}
+		}
+	case "ipv4-addr", "ipv6-addr":
+		add("ip-dst", sco["value"])
+	case "network-traffic":
+		if v, ok := value(sco["src_ref"]); ok {
+			add("ip-src", v)
+		}
+		if v, ok := value(sco["dst_ref"]); ok {
+			add("ip-dst", v)
+		}
+		add("src-port", sco["src_port"])
+		add("dst-port", sco["dst_port"])
+	case "url":
+		add("url", sco["value"])
+	case "email-addr":
+		add("email", sco["value"])
+	case "email-message":
+		if v, ok := value(sco["from_ref"]); ok {
+			add("email-src", v)
+		}
+		for _, ref := range stixStrings(sco["to_refs"]) {
+			if v, ok := value(ref); ok {
+				add("email-dst", v)
+			}
+		}
+		add("email-subject", sco["subject"])
+	case "file":
+		add("filename", sco["name"])
+		hashes, algorithms := stixHashes(sco)
+		for _, algorithm := range algorithms {
+			if t := stixHashType(algorithm); t != "" {
+				add(t, hashes[algorithm])
+			}
+		}
+		add("size-in-bytes", sco["size"])
+	case "mutex":
+		add("mutex", sco["name"])
+	case "autonomous-system":
+		add("AS", sco["number"])
+	case "mac-addr":
+		add("mac-address", sco["value"])
+	case "windows-registry-key":
+		add("regkey", sco["key"])
+		if values, ok := sco["values"].([]interface{}); ok && len(values) == 1 {
+			if v, ok := values[0].(map[string]interface{}); ok {
+				add("regkey-data", v["data"])
+			}
+		}
+	case "x509-certificate":
+		hashes, algorithms := stixHashes(sco)
+		for _, algorithm := range algorithms {
+			switch stixHashType(algorithm) {
+			case "md5":
+				add("x509-fingerprint-md5", hashes[algorithm])
+			case "sha1":
+				add("x509-fingerprint-sha1", hashes[algorithm])
+			case "sha256":
+				add("x509-fingerprint-sha256", hashes[algorithm])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s observables are not supported", sco.Type())
+	}
+
+	return fields, nil
+}
+
+// stixHashes returns the hashes of an observable by algorithm, and the
+// algorithms sorted so that the attributes are always imported in the
+// same order
+func stixHashes(sco STIXObject) (map[string]interface{}, []string) {
+	hashes := make(map[string]interface{})
+
+	switch h := sco["hashes"].(type) {
+	case map[string]interface{}:
+		hashes = h
+	case map[string]string:
+		for k, v := range h {
+			hashes[k] = v
+		}
+	}
+
+	var algorithms []string
+	for k := range hashes {
+		algorithms = append(algorithms, k)
+	}
+	sort.Strings(algorithms)
+
+	return hashes, algorithms
+}
+
+// referencedObservables returns the observables referenced by other
+// observables of the list, such as the addresses of network traffic
+func (imp *stixImporter) referencedObservables(ids []string) map[string]bool {
+	referenced := make(map[string]bool)
+
+	for _, id := range ids {
+		sco := imp.objects[id]
+		for k, v := range sco {
+			if strings.HasSuffix(k, "_ref") {
+				if ref, ok := v.(string); ok {
+					referenced[ref] = true
+				}
+			} else if strings.HasSuffix(k, "_refs") {
+				for _, ref := range stixStrings(v) {
+					referenced[ref] = true
+				}
+			}
+		}
+	}
+
+	return referenced
+}
+
+// observedData converts the observables of observed data which are not
+// referenced by another one
+func (imp *stixImporter) observedData(o STIXObject) {
+	refs := stixStrings(o["object_refs"])
+	referenced := imp.referencedObservables(refs)
+
+	var groups [][]stixField
+	for _, ref := range refs {
+		sco, ok := imp.objects[ref]
+		if !ok {
+			imp.fail(o, "missing observable %s", ref)
+			return
+		}
+		if referenced[ref] {
+			continue
+		}
+
+		fields, err := imp.observableFields(sco)
+		if err != nil {
+			imp.fail(o, "%s", err)
+			return
+		}
+		groups = append(groups, fields)
+	}
+
+	imp.addGroups(o, groups, false)
+	if imp.consumed[o.ID()] {
+		for _, ref := range refs {
+			imp.consumed[ref] = true
+		}
+	}
+}
+
+// standaloneObservables converts the observables which are neither in
+// observed data nor referenced by another observable
+func (imp *stixImporter) standaloneObservables() {
+	var ids []string
+	for _, o := range imp.bundle.Objects {
+		ids = append(ids, o.ID())
+	}
+	referenced := imp.referencedObservables(ids)
+
+	for _, o := range imp.bundle.Objects {
+		if imp.consumed[o.ID()] || referenced[o.ID()] || o.String("spec_version") == "" {
+			continue
+		}
+		if _, ok := stixIDContributingProperties[o.Type()]; !ok && o.Type() != "email-message" {
+			continue
+		}
+
+		fields, err := imp.observableFields(o)
+		if err != nil {
+			imp.fail(o, "%s", err)
+			continue
+		}
+		imp.addGroups(o, [][]stixField{fields}, false)
+	}
+}
+
+// sdoAttribute converts vulnerabilities, campaigns and threat actors
+func (imp *stixImporter) sdoAttribute(o STIXObject) {
+	types := map[string]string{
+		"vulnerability": "vulnerability",
+		"campaign":      "campaign-name",
+		"threat-actor":  "threat-actor",
+	}
+
+	value := o.String("name")
+	if o.Type() == "vulnerability" {
+		refs, _ := o["external_references"].([]interface{})
+		for _, ref := range refs {
+			if ref, ok := ref.(map[string]interface{}); ok && ref["source_name"] == "cve" {
+				if id, ok := ref["external_id"].(string); ok {
+					value = id
+				}
+			}
+		}
+	}
+
+	if value == "" {
+		imp.fail(o, "%s has no name", o.Type())
+		return
+	}
+
+	imp.addAttribute(o, &Attribute{Type: types[o.Type()], Value: value}, 0)
+}
+
+// customAttribute converts the attributes exported by MISP without STIX
+// equivalent
+func (imp *stixImporter) customAttribute(o STIXObject) {
+	attr := &Attribute{Type: o.String("x_misp_type"), Value: o.String("x_misp_value")}
+	if attr.Type == "" || attr.Value == "" {
+		imp.fail(o, "x-misp-attribute without type or value")
+		return
+	}
+
+	imp.addAttribute(o, attr, 0)
+	if c := o.String("x_misp_category"); c != "" {
+		imp.event.Attribute[len(imp.event.Attribute)-1].Category = c
+	}
+}
+
+// customObject converts the objects exported by MISP without STIX
+// equivalent
+func (imp *stixImporter) customObject(o STIXObject) {
+	obj := &Object{Name: o.String("x_misp_name")}
+
+	attrs, _ := o["x_misp_attributes"].([]interface{})
+	for _, a := range attrs {
+		a, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		attr := Attribute{}
+		attr.Type, _ = a["type"].(string)
+		attr.ObjectRelation, _ = a["object_relation"].(string)
+		attr.Value, _ = a["value"].(string)
+		attr.Category, _ = a["category"].(string)
+		attr.UUID, _ = a["uuid"].(string)
+		attr.ToIDS, _ = a["to_ids"].(bool)
+		obj.Attribute = append(obj.Attribute, attr)
+	}
+
+	if obj.Name == "" || len(obj.Attribute) == 0 {
+		imp.fail(o, "x-misp-object without name or attributes")
+		return
+	}
+
+	// addObject overwrites the attributes in place
+	exported := append([]Attribute(nil), obj.Attribute...)
+	imp.addObject(o, obj, 0)
+
+	// Keep the attributes as exported
+	added := &imp.event.Object[len(imp.event.Object)-1]
+	for i, attr := range exported {
+		if attr.UUID != "" {
+			added.Attribute[i].UUID = attr.UUID
+		}
+		if attr.Category != "" {
+			added.Attribute[i].Category = attr.Category
+		}
+		added.Attribute[i].ToIDS = attr.ToIDS
+	}
+}
+
+// mispUUID returns the UUID of the attribute or object a STIX object was
+// converted to
+func (imp *stixImporter) mispUUID(id string) (string, bool) {
+	if i, ok := imp.attributes[id]; ok {
+		return imp.event.Attribute[i].UUID, true
+	}
+	if i, ok := imp.mispObjs[id]; ok {
+		return imp.event.Object[i].UUID, true
+	}
+
+	return "", false
+}
+
+// relationship converts a relationship to an object reference, or to a
+// galaxy tag of an attribute
+func (imp *stixImporter) relationship(o STIXObject) {
+	source, target := o.String("source_ref"), o.String("target_ref")
+
+	if tag, ok := imp.tags[target]; ok {
+		if i, ok := imp.attributes[source]; ok {
+			imp.event.Attribute[i].Tag = append(imp.event.Attribute[i].Tag, Tag{Name: tag})
+			imp.consumed[o.ID()] = true
+			return
+		}
+	}
+
+	i, ok := imp.mispObjs[source]
+	if !ok {
+		imp.fail(o, "source %s is not a MISP object", source)
+		return
+	}
+
+	targetUUID, ok := imp.mispUUID(target)
+	if !ok {
+		imp.fail(o, "target %s was not imported", target)
+		return
+	}
+
+	obj := &imp.event.Object[i]
+	obj.ObjectReference = append(obj.ObjectReference, ObjectReference{
+		UUID:             stixUUID(o.ID()),
+		ObjectUUID:       obj.UUID,
+		ReferencedUUID:   targetUUID,
+		RelationshipType: o.String("relationship_type"),
+		Comment:          o.String("description"),
+	})
+	imp.consumed[o.ID()] = true
+}
+
+// ImportSTIX converts a bundle with STIXToEvent and creates the event. The
+// objects which could not be converted are listed in the result.
+func (client *Client) ImportSTIX(bundle *STIXBundle) (*Event, *STIXImportResult, error) {
+	result, err := STIXToEvent(bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	event, err := client.AddEvent(result.Event)
+	if err != nil {
+		return nil, result, err
+	}
+
+	return event, result, nil
+}
+
+var eventURLRegexp = regexp.MustCompile(`/events/view/(\d+)`)
+
+// UploadSTIX sends a STIX 2 bundle to the server, which converts it with its
+// own converter. Only the ID of the returned event is guaranteed to be set.
+func (client *Client) UploadSTIX(r io.Reader) (*Event, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf) {
+		return nil, fmt.Errorf("STIX bundle is not valid JSON")
+	}
+
+	var resp struct {
+		eventWrapper
+		actionResponse
+	}
+	if err := client.call("POST", "/events/upload_stix/2", json.RawMessage(buf), &resp); err != nil {
+		return nil, err
+	}
+
+	event := &resp.Event
+	if event.ID == "" {
+		m := eventURLRegexp.FindStringSubmatch(resp.URL)
+		if m == nil {
+			return nil, fmt.Errorf("MISP returned an error: %s", resp.message())
+		}
+		event.ID = m[1]
+	}
+
+	return event, nil
+}
@@ -0,0 +1,275 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testPartnerBundle = `{
+	"type": "bundle",
+	"id": "bundle--9f1c2a3b-0000-4c5d-8e9f-0a1b2c3d4e5f",
+	"objects": [
+		{"type": "identity", "spec_version": "2.1", "id": "identity--9f1c2a3b-0001-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "name": "Partner CSIRT", "identity_class": "organization"},
+		{"type": "report", "spec_version": "2.1", "id": "report--9f1c2a3b-0002-4c5d-8e9f-0a1b2c3d4e5f", "created_by_ref": "identity--9f1c2a3b-0001-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "name": "Phishing wave", "published": "2021-03-02T08:00:00Z", "report_types": ["threat-report"], "labels": ["phishing"], "object_marking_refs": ["marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da"], "object_refs": ["indicator--9f1c2a3b-0003-4c5d-8e9f-0a1b2c3d4e5f"]},
+		{"type": "indicator", "spec_version": "2.1", "id": "indicator--9f1c2a3b-0003-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "pattern": "[url:value = 'http://evil.example/login'] OR [domain-name:value = 'evil.example']", "pattern_type": "stix", "valid_from": "2021-03-01T10:00:00Z"},
+		{"type": "indicator", "spec_version": "2.1", "id": "indicator--9f1c2a3b-0004-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "pattern": "[file:name = 'invoice.doc' AND file:hashes.MD5 = '0123456789abcdef0123456789abcdef' AND file:size = 1024]", "pattern_type": "stix", "valid_from": "2021-03-01T10:00:00Z"},
+		{"type": "indicator", "spec_version": "2.1", "id": "indicator--9f1c2a3b-0005-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "pattern": "rule foo { condition: true }", "pattern_type": "yara", "valid_from": "2021-03-01T10:00:00Z"},
+		{"type": "observed-data", "spec_version": "2.1", "id": "observed-data--9f1c2a3b-0006-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "first_observed": "2021-03-01T10:00:00Z", "last_observed": "2021-03-01T10:00:00Z", "number_observed": 1, "object_refs": ["ipv4-addr--9f1c2a3b-0007-4c5d-8e9f-0a1b2c3d4e5f", "network-traffic--9f1c2a3b-0008-4c5d-8e9f-0a1b2c3d4e5f"]},
+		{"type": "ipv4-addr", "spec_version": "2.1", "id": "ipv4-addr--9f1c2a3b-0007-4c5d-8e9f-0a1b2c3d4e5f", "value": "203.0.113.9"},
+		{"type": "network-traffic", "spec_version": "2.1", "id": "network-traffic--9f1c2a3b-0008-4c5d-8e9f-0a1b2c3d4e5f", "dst_ref": "ipv4-addr--9f1c2a3b-0007-4c5d-8e9f-0a1b2c3d4e5f", "dst_port": 8080, "protocols": ["tcp"]},
+		{"type": "mutex", "spec_version": "2.1", "id": "mutex--9f1c2a3b-0009-4c5d-8e9f-0a1b2c3d4e5f", "name": "Global\\evil"},
+		{"type": "malware", "spec_version": "2.1", "id": "malware--9f1c2a3b-0010-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "name": "EvilLoader", "is_family": true},
+		{"type": "relationship", "spec_version": "2.1", "id": "relationship--9f1c2a3b-0011-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "relationship_type": "indicates", "source_ref": "indicator--9f1c2a3b-0003-4c5d-8e9f-0a1b2c3d4e5f", "target_ref": "malware--9f1c2a3b-0010-4c5d-8e9f-0a1b2c3d4e5f"}
+	]
+}`
+
+func TestSTIXToEvent(t *testing.T) {
+	bundle, err := ParseSTIXBundle(strings.NewReader(testPartnerBundle))
+	if err != nil {
+		t.Fatalf("ParseSTIXBundle returned an error: %s", err)
+	}
+
+	result, err := STIXToEvent(bundle)
+	if err != nil {
+		t.Fatalf("STIXToEvent returned an error: %s", err)
+	}
+
+	event := result.Event
+	if event.UUID != "9f1c2a3b-0002-4c5d-8e9f-0a1b2c3d4e5f" || event.Info != "Phishing wave" || event.Date != "2021-03-02" {
+		t.Errorf("Event is %+v", event)
+	}
+	if event.Orgc == nil || event.Orgc.Name != "Partner CSIRT" {
+		t.Errorf("Event creator is %+v", event.Orgc)
+	}
+	if len(event.Tag) != 2 || event.Tag[0].Name != "phishing" || event.Tag[1].Name != "tlp:green" {
+		t.Errorf("Event tags are %+v", event.Tag)
+	}
+
+	want := []struct{ uuid, typ, category, value string }{
+		{"9f1c2a3b-0003-4c5d-8e9f-0a1b2c3d4e5f", "url", "Network activity", "http://evil.example/login"},
+		{uuid5(stixNamespace, "indicator--9f1c2a3b-0003-4c5d-8e9f-0a1b2c3d4e5f#1"), "domain", "Network activity", "evil.example"},
+		{"9f1c2a3b-0006-4c5d-8e9f-0a1b2c3d4e5f", "ip-dst|port", "Network activity", "203.0.113.9|8080"},
+		{"9f1c2a3b-0009-4c5d-8e9f-0a1b2c3d4e5f", "mutex", "Artifacts dropped", `Global\evil`},
+	}
+	if len(event.Attribute) != len(want) {
+		t.Fatalf("Event has attributes %+v", event.Attribute)
+	}
+	for i, w := range want {
+		a := event.Attribute[i]
+		if a.UUID != w.uuid || a.Type != w.typ || a.Category != w.category || a.Value != w.value {
+			t.Errorf("Attribute %d is %+v", i, a)
+		}
+	}
+	if !event.Attribute[0].ToIDS || event.Attribute[2].ToIDS || event.Attribute[3].ToIDS {
+		t.Errorf("Attributes to_ids are wrong")
+	}
+
+	if len(event.Object) != 1 {
+		t.Fatalf("Event has objects %+v", event.Object)
+	}
+	file := event.Object[0]
+	if file.Name != "file" || file.UUID != "9f1c2a3b-0004-4c5d-8e9f-0a1b2c3d4e5f" || len(file.Attribute) != 3 || file.Attribute[1].ObjectRelation != "md5" || !file.Attribute[1].ToIDS {
+		t.Errorf("File object is %+v", file)
+	}
+
+	unmapped := make(map[string]bool)
+	for _, o := range result.Unmapped {
+		unmapped[o.ID()] = true
+	}
+	for _, id := range []string{
+		"indicator--9f1c2a3b-0005-4c5d-8e9f-0a1b2c3d4e5f",
+		"malware--9f1c2a3b-0010-4c5d-8e9f-0a1b2c3d4e5f",
+		"relationship--9f1c2a3b-0011-4c5d-8e9f-0a1b2c3d4e5f",
+	} {
+		if !unmapped[id] || result.Errors[id] == "" {
+			t.Errorf("%s is not reported as unmapped", id)
+		}
+	}
+	if len(result.Unmapped) != 3 {
+		t.Errorf("Unmapped objects are %+v", result.Unmapped)
+	}
+}
+
+func TestSTIXToEventRoundTrip(t *testing.T) {
+	orig := &Event{
+		UUID:      "7a3c9e10-52b4-4d0e-9a61-3f8e1c2b4d01",
+		Info:      "Credential phishing kit",
+		Date:      "2021-06-08",
+		Timestamp: "1623153600",
+		Orgc:      &Organisation{Name: "Partner CSIRT", UUID: "7a3c0000-52b4-4d0e-9a61-3f8e1c2b4d01"},
+		Attribute: []Attribute{
+			{
+				UUID: "7a3c9e11-0001-4d0e-9a61-3f8e1c2b4d01", Type: "url", Category: "Network activity", Value: "https://login.phish.example/", ToIDS: true,
+				Galaxy: []Galaxy{{Type: "malpedia", GalaxyCluster: []GalaxyCluster{{UUID: "7a3c0000-0002-4d0e-9a61-3f8e1c2b4d01", Value: "PhishKit"}}}},
+			},
+			{UUID: "7a3c9e11-0002-4d0e-9a61-3f8e1c2b4d01", Type: "ip-dst|port", Category: "Network activity", Value: "203.0.113.50|8443"},
+			{UUID: "7a3c9e11-0003-4d0e-9a61-3f8e1c2b4d01", Type: "text", Category: "Other", Value: "Kit sold on a forum"},
+		},
+		Object: []Object{{
+			Name: "file",
+			UUID: "7a3c9e12-0001-4d0e-9a61-3f8e1c2b4d01",
+			Attribute: []Attribute{
+				{UUID: "7a3c9e11-0004-4d0e-9a61-3f8e1c2b4d01", Type: "filename", ObjectRelation: "filename", Value: "kit.zip"},
+				{UUID: "7a3c9e11-0005-4d0e-9a61-3f8e1c2b4d01", Type: "sha1", ObjectRelation: "sha1", Value: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+			},
+			ObjectReference: []ObjectReference{{
+				UUID:             "7a3c9e13-0001-4d0e-9a61-3f8e1c2b4d01",
+				ReferencedUUID:   "7a3c9e11-0001-4d0e-9a61-3f8e1c2b4d01",
+				RelationshipType: "communicates-with",
+			}},
+		}},
+	}
+
+	exported, err := EventToSTIX(orig)
+	if err != nil {
+		t.Fatalf("EventToSTIX returned an error: %s", err)
+	}
+	buf, _ := json.Marshal(exported)
+
+	bundle, err := ParseSTIXBundle(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("ParseSTIXBundle returned an error: %s", err)
+	}
+	result, err := STIXToEvent(bundle)
+	if err != nil {
+		t.Fatalf("STIXToEvent returned an error: %s", err)
+	}
+	if len(result.Unmapped) != 0 {
+		t.Errorf("Unmapped objects: %v", result.Errors)
+	}
+
+	event := result.Event
+	if event.UUID != orig.UUID || event.Info != orig.Info || event.Date != orig.Date || event.Orgc.UUID != orig.Orgc.UUID {
+		t.Errorf("Event is %+v", event)
+	}
+
+	if len(event.Attribute) != len(orig.Attribute) {
+		t.Fatalf("Event has attributes %+v", event.Attribute)
+	}
+	for i, a := range event.Attribute {
+		o := orig.Attribute[i]
+		if a.UUID != o.UUID || a.Type != o.Type || a.Category != o.Category || a.Value != o.Value || a.ToIDS != o.ToIDS {
+			t.Errorf("Attribute %d is %+v, want %+v", i, a, o)
+		}
+	}
+	tags := event.Attribute[0].Tag
+	if len(tags) != 1 || tags[0].Name != `misp-galaxy:malpedia="PhishKit"` {
+		t.Errorf("Attribute tags are %+v", tags)
+	}
+
+	if len(event.Object) != 1 {
+		t.Fatalf("Event has objects %+v", event.Object)
+	}
+	obj := event.Object[0]
+	if obj.UUID != orig.Object[0].UUID || obj.Name != "file" || len(obj.Attribute) != 2 {
+		t.Errorf("Object is %+v", obj)
+	}
+	if len(obj.ObjectReference) != 1 || obj.ObjectReference[0].ReferencedUUID != orig.Attribute[0].UUID || obj.ObjectReference[0].RelationshipType != "communicates-with" {
+		t.Errorf("Object references are %+v", obj.ObjectReference)
+	}
+}
+
+func TestSTIXToEventCustomObject(t *testing.T) {
+	bundle, err := ParseSTIXBundle(strings.NewReader(`{
+		"type": "bundle",
+		"id": "bundle--9f1c2a3b-1000-4c5d-8e9f-0a1b2c3d4e5f",
+		"objects": [
+			{"type": "x-misp-object", "spec_version": "2.1", "id": "x-misp-object--9f1c2a3b-1001-4c5d-8e9f-0a1b2c3d4e5f", "created": "2021-03-01T10:00:00.000Z", "modified": "2021-03-01T10:00:00.000Z", "x_misp_name": "person", "x_misp_attributes": [
+				{"type": "first-name", "object_relation": "first-name", "category": "Person", "value": "John", "to_ids": true, "uuid": "22222222-2222-4222-8222-222222222222"},
+				{"type": "text", "object_relation": "text", "value": "Notes"}
+			]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseSTIXBundle returned an error: %s", err)
+	}
+
+	result, err := STIXToEvent(bundle)
+	if err != nil {
+		t.Fatalf("STIXToEvent returned an error: %s", err)
+	}
+	if len(result.Event.Object) != 1 {
+		t.Fatalf("Event has objects %+v", result.Event.Object)
+	}
+
+	attrs := result.Event.Object[0].Attribute
+	if len(attrs) != 2 {
+		t.Fatalf("Object has attributes %+v", attrs)
+	}
+	if attrs[0].UUID != "22222222-2222-4222-8222-222222222222" || attrs[0].Category != "Person" || !attrs[0].ToIDS {
+		t.Errorf("Exported attribute is %+v", attrs[0])
+	}
+	if attrs[1].UUID == "" || attrs[1].Category != "Other" || attrs[1].ToIDS {
+		t.Errorf("Attribute without UUID nor category is %+v", attrs[1])
+	}
+}
+
+func TestParseSTIXBundleErrors(t *testing.T) {
+	if _, err := ParseSTIXBundle(strings.NewReader(`{"type": "indicator"}`)); err == nil {
+		t.Errorf("ParseSTIXBundle accepted an indicator")
+	}
+	if _, err := ParseSTIXBundle(strings.NewReader(`{"type": `)); err == nil {
+		t.Errorf("ParseSTIXBundle accepted invalid JSON")
+	}
+}
+
+func TestImportSTIX(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/add",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var req eventWrapper
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Cannot decode json event: %s", err)
+			}
+			if req.Event.Info != "Phishing wave" || len(req.Event.Attribute) != 4 || len(req.Event.Object) != 1 {
+				t.Errorf("Unexpected event: %+v", req.Event)
+			}
+
+			fmt.Fprint(w, `{"Event": {"id": "42", "uuid": "9f1c2a3b-0002-4c5d-8e9f-0a1b2c3d4e5f", "info": "Phishing wave"}}`)
+		})
+
+	bundle, _ := ParseSTIXBundle(strings.NewReader(testPartnerBundle))
+	event, result, err := client.ImportSTIX(bundle)
+	if err != nil {
+		t.Fatalf("ImportSTIX returned an error: %s", err)
+	}
+	if event.ID != "42" || len(result.Unmapped) != 3 {
+		t.Errorf("ImportSTIX returned %+v", event)
+	}
+}
+
+func TestUploadSTIX(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/upload_stix/2",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != `{"type":"bundle","objects":[]}` {
+				t.Errorf("Unexpected body: %s", body)
+			}
+
+			fmt.Fprint(w, `{"name": "STIX document imported.", "message": "STIX document imported.", "url": "/events/view/43"}`)
+		})
+
+	event, err := client.UploadSTIX(strings.NewReader(`{"type":"bundle","objects":[]}`))
+	if err != nil {
+		t.Fatalf("UploadSTIX returned an error: %s", err)
+	}
+	if event.ID != "43" {
+		t.Errorf("UploadSTIX returned %+v", event)
+	}
+
+	if _, err := client.UploadSTIX(strings.NewReader(`{"type":`)); err == nil {
+		t.Errorf("UploadSTIX accepted invalid JSON")
+	}
+}
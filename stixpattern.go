@@ -0,0 +1,372 @@
+package misp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// STIXComparison is a comparison expression of a STIX pattern, such as
+// domain-name:value = 'foobar.com'
+type STIXComparison struct {
+	// Object path, e.g. file:hashes.'SHA-256'
+	Path string
+
+	// Operator in upper case: =, !=, <, <=, >, >=, IN, LIKE, MATCHES...
+	Operator string
+
+	// Negated is set when the operator is preceded by NOT
+	Negated bool
+
+	// Value is a string, an int64, a float64, a bool or a []interface{}
+	// of these for the IN operator. Timestamps, binaries and hexadecimal
+	// constants are kept as strings.
+	Value interface{}
+}
+
+// ObjectType returns the STIX type of the object the comparison applies to
+func (c *STIXComparison) ObjectType() string {
+	if i := strings.IndexByte(c.Path, ':'); i > 0 {
+		return c.Path[:i]
+	}
+
+	return ""
+}
+
+// Property returns the path of the comparison without the object type
+func (c *STIXComparison) Property() string {
+	if i := strings.IndexByte(c.Path, ':'); i > 0 {
+		return c.Path[i+1:]
+	}
+
+	return c.Path
+}
+
+// STIXObservation is an observation expression of a STIX pattern, a list of
+// comparisons between square brackets
+type STIXObservation struct {
+	Comparisons []STIXComparison
+
+	// Operator joining the comparisons, AND or OR, empty when there is only
+	// one comparison. Observations mixing both are not supported.
+	Operator string
+
+	// Qualifiers following the observation (WITHIN, REPEATS, START...),
+	// unparsed
+	Qualifiers string
+}
+
+// STIXPattern is a parsed STIX 2.1 pattern
+type STIXPattern struct {
+	Observations []STIXObservation
+
+	// Operator joining the observations, AND, OR or FOLLOWEDBY, empty when
+	// there is only one observation. Patterns mixing them are not supported.
+	Operator string
+}
+
+// ParseSTIXPattern parses the subset of the STIX 2.1 patterning language
+// used to share indicators: observations joined by a single operator, made
+// of comparisons joined by a single operator. Parentheses are accepted as
+// long as they do not change the meaning of the expression.
+func ParseSTIXPattern(pattern string) (*STIXPattern, error) {
+	tokens, err := stixTokenize(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &stixParser{tokens: tokens}
+	result := &STIXPattern{}
+
+	for {
+		p.skipParens("(")
+
+		obs, err := p.observation()
+		if err != nil {
+			return nil, err
+		}
+		result.Observations = append(result.Observations, *obs)
+
+		p.skipParens(")")
+
+		if p.done() {
+			break
+		}
+
+		op := strings.ToUpper(p.next())
+		if op != "AND" && op != "OR" && op != "FOLLOWEDBY" {
+			return nil, fmt.Errorf("unexpected %q after observation", op)
+		}
+		if result.Operator != "" && result.Operator != op {
+			return nil, fmt.Errorf("mixing %s and %s between observations is not supported", result.Operator, op)
+		}
+		result.Operator = op
+	}
+
+	return result, nil
+}
+
+type stixParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *stixParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *stixParser) peek() string {
+	if p.done() {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *stixParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *stixParser) skipParens(paren string) {
+	for p.peek() == paren {
+		p.pos++
+	}
+}
+
+func (p *stixParser) observation() (*STIXObservation, error) {
+	if p.next() != "[" {
+		return nil, fmt.Errorf("observation expression must start with '['")
+	}
+
+	obs := &STIXObservation{}
+	for {
+		p.skipParens("(")
+
+		c, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		obs.Comparisons = append(obs.Comparisons, *c)
+
+		p.skipParens(")")
+
+		t := p.next()
+		if t == "]" {
+			break
+		}
+
+		op := strings.ToUpper(t)
+		if op != "AND" && op != "OR" {
+			return nil, fmt.Errorf("unexpected %q in observation", t)
+		}
+		if obs.Operator != "" && obs.Operator != op {
+			return nil, fmt.Errorf("mixing AND and OR in an observation is not supported")
+		}
+		obs.Operator = op
+	}
+
+	// Qualifiers run until the next observation operator
+	var qualifiers []string
+	for !p.done() {
+		switch strings.ToUpper(p.peek()) {
+		case "AND", "OR", "FOLLOWEDBY", ")":
+			obs.Qualifiers = strings.Join(qualifiers, " ")
+			return obs, nil
+		}
+		qualifiers = append(qualifiers, p.next())
+	}
+	obs.Qualifiers = strings.Join(qualifiers, " ")
+
+	return obs, nil
+}
+
+func (p *stixParser) comparison() (*STIXComparison, error) {
+	path := p.next()
+	if !strings.Contains(path, ":") {
+		return nil, fmt.Errorf("invalid object path %q", path)
+	}
+
+	c := &STIXComparison{Path: path}
+
+	op := strings.ToUpper(p.next())
+	if op == "NOT" {
+		c.Negated = true
+		op = strings.ToUpper(p.next())
+	}
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=", "IN", "LIKE", "MATCHES", "ISSUBSET", "ISSUPERSET":
+		c.Operator = op
+	default:
+		return nil, fmt.Errorf("invalid operator %q", op)
+	}
+
+	if c.Operator == "IN" {
+		if p.next() != "(" {
+			return nil, fmt.Errorf("IN expects a list")
+		}
+		var list []interface{}
+		for {
+			v, err := stixConstant(p.next())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+
+			t := p.next()
+			if t == ")" {
+				break
+			}
+			if t != "," {
+				return nil, fmt.Errorf("unexpected %q in list", t)
+			}
+		}
+		c.Value = list
+		return c, nil
+	}
+
+	v, err := stixConstant(p.next())
+	if err != nil {
+		return nil, err
+	}
+	c.Value = v
+
+	return c, nil
+}
+
+// stixConstant decodes a literal token
+func stixConstant(t string) (interface{}, error) {
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of pattern")
+	case t[0] == '\'':
+		return stixUnquote(t), nil
+	case len(t) > 1 && t[1] == '\'' && strings.ContainsRune("thb", rune(t[0])):
+		// Timestamp, hexadecimal and binary constants
+		return stixUnquote(t[1:]), nil
+	case strings.EqualFold(t, "true"):
+		return true, nil
+	case strings.EqualFold(t, "false"):
+		return false, nil
+	}
+
+	if n, err := strconv.ParseInt(t, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(t, 64); err == nil {
+		return f, nil
+	}
+
+	return nil, fmt.Errorf("invalid constant %q", t)
+}
+
+// stixUnquote decodes a quoted string, the escape sequences being \' and \\
+func stixUnquote(t string) string {
+	t = t[1 : len(t)-1]
+
+	var b strings.Builder
+	for i := 0; i < len(t); i++ {
+		if t[i] == '\\' && i+1 < len(t) {
+			i++
+		}
+		b.WriteByte(t[i])
+	}
+
+	return b.String()
+}
+
+// stixTokenize splits a pattern into brackets, parentheses, commas,
+// operators, quoted strings and words. Object paths, which can hold
+// quoted parts and list indexes, are kept in a single token.
+func stixTokenize(s string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '[' || c == ']' || c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, string(c))
+			i++
+
+		case c == '\'':
+			end, err := stixQuotedEnd(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, s[i:end])
+			i = end
+
+		case strings.HasPrefix(s[i:], "!=") || strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+
+		case c == '=' || c == '<' || c == '>':
+			tokens = append(tokens, string(c))
+			i++
+
+		default:
+			// Typed constants: t'...', h'...', b'...'
+			if i+1 < len(s) && s[i+1] == '\'' && strings.IndexByte("thb", c) >= 0 {
+				end, err := stixQuotedEnd(s, i+1)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, s[i:end])
+				i = end
+				continue
+			}
+
+			start := i
+			depth := 0
+			for i < len(s) {
+				c := s[i]
+				if c == '\'' {
+					end, err := stixQuotedEnd(s, i)
+					if err != nil {
+						return nil, err
+					}
+					i = end
+					continue
+				}
+				if c == '[' {
+					depth++
+				} else if c == ']' {
+					if depth == 0 {
+						break
+					}
+					depth--
+				} else if depth == 0 && (unicode.IsSpace(rune(c)) || strings.IndexByte("()=!<>,", c) >= 0) {
+					break
+				}
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected character %q at offset %d in pattern", c, i)
+			}
+			tokens = append(tokens, s[start:i])
+		}
+	}
+
+	return tokens, nil
+}
+
+// stixQuotedEnd returns the index following the quoted string starting at
+// start
+func stixQuotedEnd(s string, start int) (int, error) {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			return i + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unterminated string in pattern")
+}
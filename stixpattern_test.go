@@ -0,0 +1,93 @@
+package misp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSTIXPattern(t *testing.T) {
+	p, err := ParseSTIXPattern(`[file:name = 'foo\'bar.exe' AND file:hashes.'SHA-256' = 'e3b0c442'] OR ([domain-name:value IN ('a.com', 'b.com')] WITHIN 300 SECONDS)`)
+	if err != nil {
+		t.Fatalf("ParseSTIXPattern returned an error: %s", err)
+	}
+
+	want := &STIXPattern{
+		Operator: "OR",
+		Observations: []STIXObservation{
+			{
+				Operator: "AND",
+				Comparisons: []STIXComparison{
+					{Path: "file:name", Operator: "=", Value: "foo'bar.exe"},
+					{Path: "file:hashes.'SHA-256'", Operator: "=", Value: "e3b0c442"},
+				},
+			},
+			{
+				Comparisons: []STIXComparison{
+					{Path: "domain-name:value", Operator: "IN", Value: []interface{}{"a.com", "b.com"}},
+				},
+				Qualifiers: "WITHIN 300 SECONDS",
+			},
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("ParseSTIXPattern returned %+v, want %+v", p, want)
+	}
+
+	c := p.Observations[0].Comparisons[1]
+	if c.ObjectType() != "file" || c.Property() != "hashes.'SHA-256'" {
+		t.Errorf("Comparison is on %s %s", c.ObjectType(), c.Property())
+	}
+}
+
+func TestParseSTIXPatternConstants(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		op      string
+		negated bool
+		value   interface{}
+	}{
+		{"[autonomous-system:number = 64496]", "autonomous-system:number", "=", false, int64(64496)},
+		{"[network-traffic:dst_port NOT = 443]", "network-traffic:dst_port", "=", true, int64(443)},
+		{"[file:size >= 1.5]", "file:size", ">=", false, 1.5},
+		{"[email-message:is_multipart = true]", "email-message:is_multipart", "=", false, true},
+		{"[email-message:to_refs[*].value = 'foo@bar.com']", "email-message:to_refs[*].value", "=", false, "foo@bar.com"},
+		{"[file:created > t'2020-01-15T00:00:00Z']", "file:created", ">", false, "2020-01-15T00:00:00Z"},
+		{"[url:value matches '^https?://']", "url:value", "MATCHES", false, "^https?://"},
+	}
+
+	for _, test := range tests {
+		p, err := ParseSTIXPattern(test.pattern)
+		if err != nil {
+			t.Errorf("ParseSTIXPattern(%s) returned an error: %s", test.pattern, err)
+			continue
+		}
+		c := p.Observations[0].Comparisons[0]
+		if c.Path != test.path || c.Operator != test.op || c.Negated != test.negated || !reflect.DeepEqual(c.Value, test.value) {
+			t.Errorf("ParseSTIXPattern(%s) returned %+v", test.pattern, c)
+		}
+	}
+}
+
+func TestParseSTIXPatternErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"",
+		"domain-name:value = 'foo.com'",
+		"[domain-name:value = 'foo.com'",
+		"[domain-name:value = 'foo.com]",
+		"[domain-name:value ~ 'foo.com']",
+		"[a:b = 1 AND a:c = 2 OR a:d = 3]",
+		"[a:b = 1] AND [a:c = 2] OR [a:d = 3]",
+
+		// Stray operators, which used to loop forever
+		"[file:name ! 'x']",
+		"[file:name = 'x' !]",
+		"[file:name = 'x'] !",
+		"[file:name , 'x']",
+		"[file:name = 'x' ,]",
+	} {
+		if _, err := ParseSTIXPattern(pattern); err == nil {
+			t.Errorf("ParseSTIXPattern(%q) did not return an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Types of warninglists, as defined by the misp-warninglists project
+const (
+	WarninglistString    = "string"
+	WarninglistSubstring = "substring"
+	WarninglistHostname  = "hostname"
+	WarninglistCIDR      = "cidr"
+	WarninglistRegex     = "regex"
+)
+
+// Warninglist is a list of well-known values (top domains, public DNS
+// resolvers, cloud ranges...) that should not be used as indicators.
+//
+// The same structure is used for the lists returned by the server and for the
+// list.json files of the misp-warninglists repository.
+type Warninglist struct {
+	ID          string      `json:"id,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Version     json.Number `json:"version,omitempty"`
+	Enabled     bool        `json:"enabled,omitempty"`
+	Category    string      `json:"category,omitempty"`
+	EntryCount  json.Number `json:"warninglist_entry_count,omitempty"`
+
+	// Comma separated list of attribute types, as returned by the server
+	ValidAttributes string `json:"valid_attributes,omitempty"`
+
+	// Attribute types the list applies to, as found in list.json files
+	MatchingAttributes []string `json:"matching_attributes,omitempty"`
+
+	// Entries of the list, as found in list.json files
+	List []string `json:"list,omitempty"`
+}
+
+// WarninglistHit describes a value found in a warninglist
+type WarninglistHit struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Matched string `json:"matched,omitempty"`
+}
+
+type warninglistWrapper struct {
+	Warninglist Warninglist `json:"Warninglist"`
+}
+
+type warninglistIndexResponse struct {
+	Warninglists []warninglistWrapper `json:"Warninglists"`
+}
+
+// ListWarninglists returns the warninglists known by the server
+func (client *Client) ListWarninglists() ([]Warninglist, error) {
+	var resp warninglistIndexResponse
+	if err := client.call("GET", "/warninglists/index", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	lists := make([]Warninglist, len(resp.Warninglists))
+	for i, w := range resp.Warninglists {
+		lists[i] = w.Warninglist
+	}
+
+	return lists, nil
+}
+
+// CheckWarninglistValues asks the server if the values are part of an
+// enabled warninglist. Only the values with at least one hit are part of the
+// returned map.
+func (client *Client) CheckWarninglistValues(values ...string) (map[string][]WarninglistHit, error) {
+	var raw json.RawMessage
+	if err := client.call("POST", "/warninglists/checkValue", values, &raw); err != nil {
+		return nil, err
+	}
+
+	hits := make(map[string][]WarninglistHit)
+	if err := json.Unmarshal(raw, &hits); err != nil {
+		// No hit at all is returned as an empty array
+		var empty []interface{}
+		if err := json.Unmarshal(raw, &empty); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+		}
+	}
+
+	return hits, nil
+}
+
+// ReadWarninglist decodes a warninglist in the misp-warninglists format
+func ReadWarninglist(r io.Reader) (*Warninglist, error) {
+	var list Warninglist
+	decoder := json.NewDecoder(r)
+	if err := decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("Could not decode warninglist: %s", err)
+	}
+
+	return &list, nil
+}
+
+// LoadWarninglistFile reads a list.json file from the misp-warninglists
+// repository
+func LoadWarninglistFile(filename string) (*Warninglist, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list, err := ReadWarninglist(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	return list, nil
+}
+
+// WarninglistMatcher checks values against a set of warninglists without
+// querying the server
+type WarninglistMatcher struct {
+	lists []*compiledWarninglist
+}
+
+type compiledWarninglist struct {
+	list  *Warninglist
+	types map[string]bool
+
+	values  map[string]string
+	entries []string
+	nets    []*net.IPNet
+	regexps []*regexp.Regexp
+}
+
+// NewWarninglistMatcher compiles the given warninglists. It fails if a list
+// has an unknown type or holds an invalid CIDR or regex entry.
+func NewWarninglistMatcher(lists ...*Warninglist) (*WarninglistMatcher, error) {
+	m := &WarninglistMatcher{}
+
+	for _, list := range lists {
+		c, err := compileWarninglist(list)
+		if err != nil {
+			return nil, fmt.Errorf("warninglist %q: %s", list.Name, err)
+		}
+		m.lists = append(m.lists, c)
+	}
+
+	return m, nil
+}
+
+func compileWarninglist(list *Warninglist) (*compiledWarninglist, error) {
+	c := &compiledWarninglist{list: list}
+
+	types := list.MatchingAttributes
+	if len(types) == 0 && list.ValidAttributes != "" {
+		types = strings.Split(list.ValidAttributes, ",")
+	}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "ALL" {
+			c.types = nil
+			break
+		}
+		if c.types == nil {
+			c.types = make(map[string]bool)
+		}
+		c.types[t] = true
+	}
+
+	switch list.Type {
+	case WarninglistString, WarninglistHostname:
+		c.values = make(map[string]string, len(list.List))
+		for _, entry := range list.List {
+			key := entry
+			if list.Type == WarninglistHostname {
+				key = normalizeHostname(entry)
+			}
+			c.values[key] = entry
+		}
+	case WarninglistSubstring:
+		c.entries = list.List
+	case WarninglistCIDR:
+		for _, entry := range list.List {
+			n, err := parseCIDR(entry)
+			if err != nil {
+				return nil, err
+			}
+			c.nets = append(c.nets, n)
+			c.entries = append(c.entries, entry)
+		}
+	case WarninglistRegex:
+		for _, entry := range list.List {
+			re, err := compilePCRE(entry)
+			if err != nil {
+				return nil, err
+			}
+			c.regexps = append(c.regexps, re)
+			c.entries = append(c.entries, entry)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", list.Type)
+	}
+
+	return c, nil
+}
+
+// parseCIDR accepts both networks and single IP addresses
+func parseCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid CIDR %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// compilePCRE converts a PHP style regex such as "/^foo$/i" to a Go regexp
+func compilePCRE(s string) (*regexp.Regexp, error) {
+	if len(s) < 2 {
+		return regexp.Compile(s)
+	}
+
+	delim := s[0]
+	end := strings.LastIndexByte(s, delim)
+	if (delim >= 'a' && delim <= 'z') || (delim >= 'A' && delim <= 'Z') || (delim >= '0' && delim <= '9') || delim == '\\' || end <= 0 {
+		return regexp.Compile(s)
+	}
+
+	expr, modifiers := s[1:end], s[end+1:]
+	flags := ""
+	for _, m := range modifiers {
+		switch m {
+		case 'i', 'm', 's', 'U':
+			flags += string(m)
+		case 'u':
+			// Go regexps are always UTF-8
+		default:
+			return nil, fmt.Errorf("unsupported regex modifier %q in %q", m, s)
+		}
+	}
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+
+	return regexp.Compile(expr)
+}
+
+func normalizeHostname(s string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")
+}
+
+// Match returns the warninglists matching value. attrType is the MISP type of
+// the value, when empty the value is checked against every list whatever
+// their matching attributes are.
+//
+// Composite values (such as "domain|ip") are split and each part is checked.
+func (m *WarninglistMatcher) Match(attrType, value string) []WarninglistHit {
+	var hits []WarninglistHit
+
+	parts := []string{value}
+	if strings.Contains(attrType, "|") {
+		parts = strings.Split(value, "|")
+	}
+
+	for _, c := range m.lists {
+		if attrType != "" && c.types != nil && !c.types[attrType] {
+			continue
+		}
+
+		for _, part := range parts {
+			if matched, ok := c.match(attrType, part); ok {
+				hits = append(hits, WarninglistHit{
+					ID:      c.list.ID,
+					Name:    c.list.Name,
+					Matched: matched,
+				})
+				break
+			}
+		}
+	}
+
+	return hits
+}
+
+// MatchAttribute is a shortcut to Match for an attribute
+func (m *WarninglistMatcher) MatchAttribute(attr *Attribute) []WarninglistHit {
+	return m.Match(attr.Type, attr.Value)
+}
+
+// FilterAttributes splits attrs into the attributes not found in any
+// warninglist and the attributes having at least one hit
+func (m *WarninglistMatcher) FilterAttributes(attrs []Attribute) (clean []Attribute, flagged []Attribute) {
+	for i := range attrs {
+		if len(m.MatchAttribute(&attrs[i])) > 0 {
+			flagged = append(flagged, attrs[i])
+		} else {
+			clean = append(clean, attrs[i])
+		}
+	}
+
+	return clean, flagged
+}
+
+func (c *compiledWarninglist) match(attrType, value string) (string, bool) {
+	switch c.list.Type {
+	case WarninglistString:
+		entry, ok := c.values[value]
+		return entry, ok
+
+	case WarninglistSubstring:
+		for _, entry := range c.entries {
+			if strings.Contains(value, entry) {
+				return entry, true
+			}
+		}
+
+	case WarninglistHostname:
+		host := normalizeHostname(hostnameOf(attrType, value))
+		for host != "" {
+			if entry, ok := c.values[host]; ok {
+				return entry, true
+			}
+			i := strings.IndexByte(host, '.')
+			if i < 0 {
+				break
+			}
+			host = host[i+1:]
+		}
+
+	case WarninglistCIDR:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			n, err := parseCIDR(value)
+			if err != nil {
+				return "", false
+			}
+			ip = n.IP
+		}
+		for i, n := range c.nets {
+			if n.Contains(ip) {
+				return c.entries[i], true
+			}
+		}
+
+	case WarninglistRegex:
+		for i, re := range c.regexps {
+			if re.MatchString(value) {
+				return c.entries[i], true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// hostnameOf extracts the host part of URLs and email addresses
+func hostnameOf(attrType, value string) string {
+	switch attrType {
+	case "url", "uri", "link":
+		if u, err := url.Parse(value); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	case "email", "email-src", "email-dst", "target-email", "whois-registrant-email":
+		if i := strings.LastIndexByte(value, '@'); i >= 0 {
+			return value[i+1:]
+		}
+	}
+
+	return value
+}
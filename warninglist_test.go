@@ -0,0 +1,150 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListWarninglists(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/warninglists/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			testAuthentication(t, r)
+			fmt.Fprint(w, `{"Warninglists":[{"Warninglist":{"id":"12","name":"List of known IPv4 public DNS resolvers","type":"cidr","description":"Event contains one or more public IPv4 DNS resolvers as attribute with an IDS flag set","version":"20190808","enabled":true,"warninglist_entry_count":"95","valid_attributes":"ip-src,ip-dst,domain|ip"}}]}`)
+		})
+
+	lists, err := client.ListWarninglists()
+	if err != nil {
+		t.Fatalf("ListWarninglists returned an error: %s", err)
+	}
+
+	if len(lists) != 1 || lists[0].ID != "12" || lists[0].Type != WarninglistCIDR || !lists[0].Enabled {
+		t.Errorf("ListWarninglists returned %+v", lists)
+	}
+}
+
+func TestCheckWarninglistValues(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/warninglists/checkValue",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got []string
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json checkValue request: %s", err)
+			}
+
+			if got[0] == "8.8.8.8" {
+				fmt.Fprint(w, `{"8.8.8.8":[{"id":"12","name":"List of known IPv4 public DNS resolvers","matched":"8.8.8.8\/32"}]}`)
+			} else {
+				fmt.Fprint(w, `[]`)
+			}
+		})
+
+	hits, err := client.CheckWarninglistValues("8.8.8.8", "1.2.3.4")
+	if err != nil {
+		t.Fatalf("CheckWarninglistValues returned an error: %s", err)
+	}
+
+	want := map[string][]WarninglistHit{
+		"8.8.8.8": {{ID: "12", Name: "List of known IPv4 public DNS resolvers", Matched: "8.8.8.8/32"}},
+	}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("CheckWarninglistValues returned %+v, want %+v", hits, want)
+	}
+
+	hits, err = client.CheckWarninglistValues("1.2.3.4")
+	if err != nil {
+		t.Fatalf("CheckWarninglistValues returned an error: %s", err)
+	}
+	if len(hits) != 0 {
+		t.Errorf("CheckWarninglistValues returned %+v, want no hit", hits)
+	}
+}
+
+func TestWarninglistMatcher(t *testing.T) {
+	dns, err := ReadWarninglist(strings.NewReader(`{
+		"description": "Event contains one or more public DNS resolvers",
+		"list": ["8.8.8.8", "1.1.1.0/24", "2001:4860:4860::8888"],
+		"matching_attributes": ["ip-src", "ip-dst", "domain|ip"],
+		"name": "List of known public DNS resolvers",
+		"type": "cidr",
+		"version": 20190808
+	}`))
+	if err != nil {
+		t.Fatalf("ReadWarninglist returned an error: %s", err)
+	}
+
+	lists := []*Warninglist{
+		dns,
+		{Name: "top domains", Type: WarninglistHostname, List: []string{"google.com", "example.org."}},
+		{Name: "strings", Type: WarninglistString, List: []string{"127.0.0.1"}},
+		{Name: "substrings", Type: WarninglistSubstring, List: []string{"amazonaws.com"}, MatchingAttributes: []string{"hostname"}},
+		{Name: "regexes", Type: WarninglistRegex, List: []string{`/^DESKTOP-[a-z0-9]+$/i`}},
+	}
+
+	m, err := NewWarninglistMatcher(lists...)
+	if err != nil {
+		t.Fatalf("NewWarninglistMatcher returned an error: %s", err)
+	}
+
+	tests := []struct {
+		attrType string
+		value    string
+		want     []string
+	}{
+		{"ip-dst", "8.8.8.8", []string{"List of known public DNS resolvers"}},
+		{"ip-dst", "1.1.1.42", []string{"List of known public DNS resolvers"}},
+		{"ip-src", "2001:4860:4860::8888", []string{"List of known public DNS resolvers"}},
+		{"ip-dst", "9.9.9.9", nil},
+		{"md5", "8.8.8.8", nil},
+		{"domain|ip", "foobar.com|8.8.8.8", []string{"List of known public DNS resolvers"}},
+		{"hostname", "WWW.Google.com", []string{"top domains"}},
+		{"domain", "example.org", []string{"top domains"}},
+		{"url", "https://mail.google.com/foo", []string{"top domains"}},
+		{"domain", "notgoogle.com", nil},
+		{"ip-dst", "127.0.0.1", []string{"strings"}},
+		{"hostname", "s3.eu-west-1.amazonaws.com", []string{"substrings"}},
+		{"domain", "s3.eu-west-1.amazonaws.com", nil},
+		{"hostname", "desktop-ab12cd", []string{"regexes"}},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, hit := range m.Match(test.attrType, test.value) {
+			got = append(got, hit.Name)
+		}
+		if len(got) != len(test.want) || (len(got) > 0 && !reflect.DeepEqual(got, test.want)) {
+			t.Errorf("Match(%q, %q) returned %v, want %v", test.attrType, test.value, got, test.want)
+		}
+	}
+
+	clean, flagged := m.FilterAttributes([]Attribute{
+		{Type: "ip-dst", Value: "8.8.8.8"},
+		{Type: "ip-dst", Value: "198.51.100.7"},
+	})
+	if len(clean) != 1 || clean[0].Value != "198.51.100.7" || len(flagged) != 1 || flagged[0].Value != "8.8.8.8" {
+		t.Errorf("FilterAttributes returned clean=%+v flagged=%+v", clean, flagged)
+	}
+}
+
+func TestWarninglistMatcher_Invalid(t *testing.T) {
+	invalid := []*Warninglist{
+		{Name: "bad cidr", Type: WarninglistCIDR, List: []string{"not an ip"}},
+		{Name: "bad regex", Type: WarninglistRegex, List: []string{"/foo(/"}},
+		{Name: "bad type", Type: "unknown"},
+	}
+
+	for _, list := range invalid {
+		if _, err := NewWarninglistMatcher(list); err == nil {
+			t.Errorf("NewWarninglistMatcher(%q) did not return an error", list.Name)
+		}
+	}
+}
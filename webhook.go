@@ -0,0 +1,193 @@
+package misp
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultWebhookMaxBodySize is the largest payload accepted by WebhookHandler
+const DefaultWebhookMaxBodySize = 32 << 20
+
+// DefaultWebhookTriggerHeader is the header naming the trigger of a payload
+const DefaultWebhookTriggerHeader = "X-MISP-Trigger"
+
+// WebhookTrigger is the workflow trigger a webhook payload comes from
+type WebhookTrigger string
+
+// Triggers of the MISP workflows
+const (
+	WebhookEventPublish       WebhookTrigger = "event-publish"
+	WebhookEventAfterSave     WebhookTrigger = "event-after-save"
+	WebhookAttributeAfterSave WebhookTrigger = "attribute-after-save"
+	WebhookObjectAfterSave    WebhookTrigger = "object-after-save"
+
+	// WebhookAnyTrigger registers a callback receiving all the payloads
+	WebhookAnyTrigger WebhookTrigger = "*"
+)
+
+// WebhookNotification is a payload received by WebhookHandler. Workflows
+// send the data of the trigger in the MISP format: an event, with the saved
+// attribute or object in it for the after-save triggers.
+type WebhookNotification struct {
+	Trigger   WebhookTrigger
+	Event     *Event
+	Attribute *Attribute
+	Object    *Object
+
+	// Raw is the payload as received
+	Raw json.RawMessage
+}
+
+// WebhookFunc is a callback of WebhookHandler. An error is returned to
+// MISP as an internal server error.
+type WebhookFunc func(*WebhookNotification) error
+
+// WebhookHandler is an http.Handler receiving the payloads of the webhook
+// module of the MISP workflows, and dispatching them to the callbacks
+// registered for their trigger.
+//
+// The trigger is read from the TriggerHeader header, the "trigger" query
+// parameter, or the "trigger" field of the payload, in that order. The
+// webhook module sets none of them by default: add the header, or the
+// query parameter to the URL, in the configuration of the module.
+type WebhookHandler struct {
+	// Secret shared with MISP, sent in the Authorization header, as is or
+	// as a bearer token. Any request is accepted when empty.
+	Secret string
+
+	// Header naming the trigger, DefaultWebhookTriggerHeader when empty
+	TriggerHeader string
+
+	// Largest payload accepted, DefaultWebhookMaxBodySize when zero
+	MaxBodySize int64
+
+	mu        sync.RWMutex
+	callbacks map[WebhookTrigger][]WebhookFunc
+}
+
+// Handle registers fn for the payloads of trigger, or for all of them with
+// WebhookAnyTrigger
+func (h *WebhookHandler) Handle(trigger WebhookTrigger, fn WebhookFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.callbacks == nil {
+		h.callbacks = make(map[WebhookTrigger][]WebhookFunc)
+	}
+	h.callbacks[trigger] = append(h.callbacks[trigger], fn)
+}
+
+func (h *WebhookHandler) authorized(r *http.Request) bool {
+	if h.Secret == "" {
+		return true
+	}
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		auth = auth[7:]
+	}
+
+	return subtle.ConstantTimeCompare([]byte(auth), []byte(h.Secret)) == 1
+}
+
+// ServeHTTP decodes a payload and calls the callbacks of its trigger.
+// Payloads without callback are accepted and ignored.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		http.Error(w, "invalid secret", http.StatusUnauthorized)
+		return
+	}
+
+	max := h.MaxBodySize
+	if max == 0 {
+		max = DefaultWebhookMaxBodySize
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		http.Error(w, "could not read payload", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	header := h.TriggerHeader
+	if header == "" {
+		header = DefaultWebhookTriggerHeader
+	}
+	trigger := WebhookTrigger(r.Header.Get(header))
+	if trigger == "" {
+		trigger = WebhookTrigger(r.URL.Query().Get("trigger"))
+	}
+
+	n, err := DecodeWebhookNotification(trigger, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	callbacks := append(append([]WebhookFunc(nil), h.callbacks[n.Trigger]...), h.callbacks[WebhookAnyTrigger]...)
+	h.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		if err := fn(n); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DecodeWebhookNotification decodes a webhook payload: an event in the
+// MISP format, with an optional top-level attribute or object. The trigger
+// field of the payload is used when trigger is empty.
+func DecodeWebhookNotification(trigger WebhookTrigger, body []byte) (*WebhookNotification, error) {
+	var payload struct {
+		Trigger   WebhookTrigger `json:"trigger"`
+		Event     *Event         `json:"Event"`
+		Attribute *Attribute     `json:"Attribute"`
+		Object    *Object        `json:"Object"`
+	}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("Could not decode payload: %s", err)
+	}
+
+	if trigger == "" {
+		trigger = payload.Trigger
+	}
+
+	n := &WebhookNotification{
+		Trigger:   trigger,
+		Event:     payload.Event,
+		Attribute: payload.Attribute,
+		Object:    payload.Object,
+		Raw:       json.RawMessage(body),
+	}
+	if n.Event == nil && n.Attribute == nil && n.Object == nil {
+		return nil, fmt.Errorf("Payload has no event, attribute or object")
+	}
+
+	// The after-save triggers send the saved element in its event
+	switch {
+	case n.Event == nil:
+	case trigger == WebhookAttributeAfterSave && n.Attribute == nil && len(n.Event.Attribute) == 1:
+		n.Attribute = &n.Event.Attribute[0]
+	case trigger == WebhookObjectAfterSave && n.Object == nil && len(n.Event.Object) == 1:
+		n.Object = &n.Event.Object[0]
+	}
+
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package misp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postWebhook(h http.Handler, target, auth, trigger, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	if trigger != "" {
+		r.Header.Set(DefaultWebhookTriggerHeader, trigger)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestWebhookHandler(t *testing.T) {
+	h := &WebhookHandler{Secret: "s3cr3t"}
+
+	var published, saved, all []*WebhookNotification
+	h.Handle(WebhookEventPublish, func(n *WebhookNotification) error {
+		published = append(published, n)
+		return nil
+	})
+	h.Handle(WebhookAttributeAfterSave, func(n *WebhookNotification) error {
+		saved = append(saved, n)
+		return nil
+	})
+	h.Handle(WebhookAnyTrigger, func(n *WebhookNotification) error {
+		all = append(all, n)
+		return nil
+	})
+
+	event := `{"Event": {"id": "12", "uuid": "5e1f4f1a-4a34-4a1e-9fba-5b2a0a3ac101", "info": "Foobar", "threat_level_id": "1", "published": true, "Attribute": [{"id": "101", "type": "domain", "value": "foo.example", "to_ids": true}]}}`
+
+	if w := postWebhook(h, "/misp", "s3cr3t", "event-publish", event); w.Code != http.StatusNoContent {
+		t.Errorf("ServeHTTP returned %d: %s", w.Code, w.Body.String())
+	}
+	if len(published) != 1 || published[0].Event.ThreatLevelID != ThreatLevelHigh || published[0].Attribute != nil {
+		t.Fatalf("Publish callback received %+v", published)
+	}
+
+	// The trigger from the query, and the saved attribute taken from its event
+	if w := postWebhook(h, "/misp?trigger=attribute-after-save", "Bearer s3cr3t", "", event); w.Code != http.StatusNoContent {
+		t.Errorf("ServeHTTP returned %d: %s", w.Code, w.Body.String())
+	}
+	if len(saved) != 1 || saved[0].Attribute == nil || saved[0].Attribute.Value != "foo.example" || !saved[0].Attribute.ToIDS {
+		t.Fatalf("Attribute callback received %+v", saved)
+	}
+
+	// The trigger from the payload, without callback but the catch-all one
+	body := `{"trigger": "object-after-save", "Event": {"id": "12", "Object": [{"name": "file", "Attribute": [{"type": "md5", "object_relation": "md5", "value": "d41d8cd98f00b204e9800998ecf8427e"}]}]}}`
+	if w := postWebhook(h, "/misp", "s3cr3t", "", body); w.Code != http.StatusNoContent {
+		t.Errorf("ServeHTTP returned %d: %s", w.Code, w.Body.String())
+	}
+	if len(all) != 3 || all[2].Trigger != WebhookObjectAfterSave || all[2].Object == nil || all[2].Object.Name != "file" {
+		t.Errorf("Catch-all callback received %+v", all)
+	}
+}
+
+func TestWebhookHandlerErrors(t *testing.T) {
+	h := &WebhookHandler{Secret: "s3cr3t", MaxBodySize: 64}
+	h.Handle(WebhookEventPublish, func(n *WebhookNotification) error {
+		return errors.New("queue is full")
+	})
+
+	event := `{"Event": {"id": "12"}}`
+	tests := []struct {
+		auth, trigger, body string
+		want                int
+	}{
+		{"", "event-publish", event, http.StatusUnauthorized},
+		{"s3cr3", "event-publish", event, http.StatusUnauthorized},
+		{"s3cr3t", "event-publish", `{"Event": `, http.StatusBadRequest},
+		{"s3cr3t", "event-publish", `{"foo": "bar"}`, http.StatusBadRequest},
+		{"s3cr3t", "event-publish", `{"Event": {"info": "` + strings.Repeat("A", 64) + `"}}`, http.StatusRequestEntityTooLarge},
+		{"s3cr3t", "event-publish", event, http.StatusInternalServerError},
+		{"s3cr3t", "user-after-save", event, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		if w := postWebhook(h, "/misp", test.auth, test.trigger, test.body); w.Code != test.want {
+			t.Errorf("ServeHTTP of %s with %q returned %d, want %d", test.body, test.auth, w.Code, test.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/misp", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("ServeHTTP of a GET returned %d", w.Code)
+	}
+}
@@ -0,0 +1,508 @@
+package misp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Topics published by the ZeroMQ plugin of MISP
+const (
+	ZMQTopicEvent        = "misp_json_event"
+	ZMQTopicAttribute    = "misp_json_attribute"
+	ZMQTopicSighting     = "misp_json_sighting"
+	ZMQTopicObject       = "misp_json_object"
+	ZMQTopicObjectRef    = "misp_json_object_reference"
+	ZMQTopicTag          = "misp_json_tag"
+	ZMQTopicOrganisation = "misp_json_organisation"
+	ZMQTopicUser         = "misp_json_user"
+	ZMQTopicAudit        = "misp_json_audit"
+	ZMQTopicSelf         = "misp_json_self"
+)
+
+// DefaultZMQReconnectInterval is the delay before reconnecting to the
+// publisher after an error
+const DefaultZMQReconnectInterval = 5 * time.Second
+
+// DefaultZMQMaxMessageSize is the largest message accepted from the
+// publisher
+const DefaultZMQMaxMessageSize = 64 << 20
+
+// ZMQMessage is a message of the publisher, made of its topic and its JSON
+// payload
+type ZMQMessage struct {
+	Topic   string
+	Payload json.RawMessage
+}
+
+// ZMQEvent is a message of the misp_json_event topic
+type ZMQEvent struct {
+	Event  Event  `json:"Event"`
+	Action string `json:"action"`
+}
+
+// ZMQAttribute is a message of the misp_json_attribute topic
+type ZMQAttribute struct {
+	Attribute Attribute `json:"Attribute"`
+	Event     *Event    `json:"Event,omitempty"`
+	Action    string    `json:"action"`
+}
+
+// ZMQSighting is a message of the misp_json_sighting topic. Event and
+// Attribute are the sighted elements, when sent by the server.
+type ZMQSighting struct {
+	Sighting  Sighting
+	Event     *Event
+	Attribute *Attribute
+	Action    string
+}
+
+// UnmarshalJSON decodes the event and attribute nested in the sighting
+func (s *ZMQSighting) UnmarshalJSON(data []byte) error {
+	var msg struct {
+		Sighting json.RawMessage `json:"Sighting"`
+		Action   string          `json:"action"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	var nested struct {
+		Event     *Event     `json:"Event"`
+		Attribute *Attribute `json:"Attribute"`
+	}
+	if err := json.Unmarshal(msg.Sighting, &s.Sighting); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(msg.Sighting, &nested); err != nil {
+		return err
+	}
+
+	s.Event, s.Attribute, s.Action = nested.Event, nested.Attribute, msg.Action
+	return nil
+}
+
+// ZMQSubscriber receives the messages published by MISP over ZeroMQ. It
+// speaks ZMTP 3.0 with the NULL security mechanism, which is what the
+// plugin of MISP uses.
+//
+// Messages are delivered on the channels which are set: those of the
+// typed topics, then Messages for the others. The subscriber only
+// subscribes to the topics it can deliver.
+type ZMQSubscriber struct {
+	// Address of the publisher, tcp://host:port or host:port
+	Address string
+
+	Events     chan<- ZMQEvent
+	Attributes chan<- ZMQAttribute
+	Sightings  chan<- ZMQSighting
+
+	// Messages receives the messages of the other topics, and of the typed
+	// topics without channel
+	Messages chan<- ZMQMessage
+
+	// Topics delivered on Messages, all of them when empty
+	Topics []string
+
+	// Errors receives the connection and decoding errors, dropped when the
+	// channel is not ready
+	Errors chan<- error
+
+	// ReconnectInterval, DefaultZMQReconnectInterval when zero
+	ReconnectInterval time.Duration
+
+	// MaxMessageSize, DefaultZMQMaxMessageSize when zero
+	MaxMessageSize int64
+}
+
+// subscriptions returns the topic prefixes to subscribe to
+func (s *ZMQSubscriber) subscriptions() []string {
+	if s.Messages != nil && len(s.Topics) == 0 {
+		return []string{""}
+	}
+
+	var topics []string
+	if s.Events != nil {
+		topics = append(topics, ZMQTopicEvent)
+	}
+	if s.Attributes != nil {
+		topics = append(topics, ZMQTopicAttribute)
+	}
+	if s.Sightings != nil {
+		topics = append(topics, ZMQTopicSighting)
+	}
+	if s.Messages != nil {
+		topics = append(topics, s.Topics...)
+	}
+
+	return topics
+}
+
+// Run connects to the publisher and delivers its messages until ctx is
+// done, reconnecting after errors. It returns ctx.Err(). The channels are
+// not closed.
+func (s *ZMQSubscriber) Run(ctx context.Context) error {
+	topics := s.subscriptions()
+	if len(topics) == 0 {
+		return fmt.Errorf("no channel to deliver messages to")
+	}
+
+	interval := s.ReconnectInterval
+	if interval == 0 {
+		interval = DefaultZMQReconnectInterval
+	}
+
+	for {
+		err := s.session(ctx, topics)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.report(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *ZMQSubscriber) report(err error) {
+	if s.Errors == nil || err == nil {
+		return
+	}
+
+	select {
+	case s.Errors <- err:
+	default:
+	}
+}
+
+// session connects to the publisher and reads its messages until an error
+func (s *ZMQSubscriber) session(ctx context.Context, topics []string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", strings.TrimPrefix(s.Address, "tcp://"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock the reads when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	max := s.MaxMessageSize
+	if max == 0 {
+		max = DefaultZMQMaxMessageSize
+	}
+	z := &zmtpConn{r: bufio.NewReader(conn), w: conn, max: max}
+
+	if err := z.handshake("SUB", "PUB", "XPUB"); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if err := z.writeFrame(0, append([]byte{1}, topic...)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		msg, err := z.readMessage()
+		if err != nil {
+			return err
+		}
+		if err := s.deliver(ctx, msg); err != nil {
+			s.report(err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// deliver decodes a "topic payload" message and sends it to its channel
+func (s *ZMQSubscriber) deliver(ctx context.Context, msg []byte) error {
+	i := bytes.IndexByte(msg, ' ')
+	if i < 0 {
+		return fmt.Errorf("message without topic: %.40q", msg)
+	}
+	topic, payload := string(msg[:i]), msg[i+1:]
+
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(payload, v); err != nil {
+			return fmt.Errorf("Could not unmarshal %s message: %s", topic, err)
+		}
+		return nil
+	}
+
+	switch {
+	case topic == ZMQTopicEvent && s.Events != nil:
+		var m ZMQEvent
+		if err := decode(&m); err != nil {
+			return err
+		}
+		select {
+		case s.Events <- m:
+		case <-ctx.Done():
+		}
+	case topic == ZMQTopicAttribute && s.Attributes != nil:
+		var m ZMQAttribute
+		if err := decode(&m); err != nil {
+			return err
+		}
+		select {
+		case s.Attributes <- m:
+		case <-ctx.Done():
+		}
+	case topic == ZMQTopicSighting && s.Sightings != nil:
+		var m ZMQSighting
+		if err := decode(&m); err != nil {
+			return err
+		}
+		select {
+		case s.Sightings <- m:
+		case <-ctx.Done():
+		}
+	case s.Messages != nil && s.wants(topic):
+		if !json.Valid(payload) {
+			return fmt.Errorf("Could not unmarshal %s message: invalid JSON", topic)
+		}
+		select {
+		case s.Messages <- ZMQMessage{Topic: topic, Payload: json.RawMessage(payload)}:
+		case <-ctx.Done():
+		}
+	}
+
+	return nil
+}
+
+// wants tells if a topic is to be delivered on Messages. Subscriptions
+// are prefixes, which can let other topics through.
+func (s *ZMQSubscriber) wants(topic string) bool {
+	if len(s.Topics) == 0 {
+		return true
+	}
+	for _, t := range s.Topics {
+		if strings.HasPrefix(topic, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ZMTP 3.0 frame flags
+const (
+	zmtpMore    = 0x01
+	zmtpLong    = 0x02
+	zmtpCommand = 0x04
+)
+
+// zmtpConn implements the parts of ZMTP 3.0 (RFC 23) needed by a
+// subscriber: the greeting, the NULL mechanism and the frames
+type zmtpConn struct {
+	r   *bufio.Reader
+	w   io.Writer
+	max int64
+}
+
+// zmtpGreeting returns the greeting of a peer using the NULL mechanism
+func zmtpGreeting(server bool) []byte {
+	g := make([]byte, 64)
+	g[0], g[9] = 0xff, 0x7f
+	g[10], g[11] = 3, 0
+	copy(g[12:32], "NULL")
+	if server {
+		g[32] = 1
+	}
+
+	return g
+}
+
+// handshake exchanges the greetings and the READY commands, checking the
+// socket type of the peer
+func (z *zmtpConn) handshake(socketType string, peerTypes ...string) error {
+	if _, err := z.w.Write(zmtpGreeting(false)); err != nil {
+		return err
+	}
+
+	greeting := make([]byte, 64)
+	if _, err := io.ReadFull(z.r, greeting); err != nil {
+		return err
+	}
+	if greeting[0] != 0xff || greeting[9]&1 != 1 {
+		return fmt.Errorf("peer is not a ZMTP peer")
+	}
+	if greeting[10] < 3 {
+		return fmt.Errorf("unsupported ZMTP version %d.%d", greeting[10], greeting[11])
+	}
+	if mechanism := string(bytes.TrimRight(greeting[12:32], "\x00")); mechanism != "NULL" {
+		return fmt.Errorf("unsupported ZMTP security mechanism %s", mechanism)
+	}
+
+	if err := z.writeFrame(zmtpCommand, zmtpReady(socketType)); err != nil {
+		return err
+	}
+
+	flags, body, err := z.readFrame()
+	if err != nil {
+		return err
+	}
+	name, props, err := zmtpParseCommand(body)
+	if flags&zmtpCommand == 0 || err != nil {
+		return fmt.Errorf("invalid ZMTP handshake")
+	}
+	if name == "ERROR" {
+		return fmt.Errorf("peer refused the connection: %s", props["reason"])
+	}
+	if name != "READY" {
+		return fmt.Errorf("unexpected ZMTP command %s", name)
+	}
+
+	for _, t := range peerTypes {
+		if props["Socket-Type"] == t {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("peer socket type %s is not %s", props["Socket-Type"], strings.Join(peerTypes, " or "))
+}
+
+// zmtpReady returns the body of a READY command
+func zmtpReady(socketType string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(5)
+	b.WriteString("READY")
+	b.WriteByte(byte(len("Socket-Type")))
+	b.WriteString("Socket-Type")
+	binary.Write(&b, binary.BigEndian, uint32(len(socketType)))
+	b.WriteString(socketType)
+
+	return b.Bytes()
+}
+
+// zmtpParseCommand decodes the name and the properties of a command
+func zmtpParseCommand(body []byte) (string, map[string]string, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, fmt.Errorf("short command")
+	}
+	name := string(body[1 : 1+body[0]])
+	body = body[1+body[0]:]
+
+	props := make(map[string]string)
+	if name == "ERROR" {
+		if len(body) > 0 && len(body) >= 1+int(body[0]) {
+			props["reason"] = string(body[1 : 1+body[0]])
+		}
+		return name, props, nil
+	}
+
+	for len(body) > 0 {
+		n := int(body[0])
+		if len(body) < 1+n+4 {
+			return "", nil, fmt.Errorf("short property")
+		}
+		key := string(body[1 : 1+n])
+		size := binary.BigEndian.Uint32(body[1+n:])
+		body = body[1+n+4:]
+		if uint64(len(body)) < uint64(size) {
+			return "", nil, fmt.Errorf("short property value")
+		}
+		props[key] = string(body[:size])
+		body = body[size:]
+	}
+
+	return name, props, nil
+}
+
+func (z *zmtpConn) writeFrame(flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = make([]byte, 9)
+		header[0] = flags | zmtpLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+
+	if _, err := z.w.Write(append(header, body...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (z *zmtpConn) readFrame() (byte, []byte, error) {
+	flags, err := z.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&zmtpLong != 0 {
+		var buf [8]byte
+		if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(buf[:])
+	} else {
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+
+	if size > uint64(z.max) {
+		return 0, nil, fmt.Errorf("ZMTP frame of %d bytes is too large", size)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(z.r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return flags, body, nil
+}
+
+// readMessage returns the next message. The frames of multipart messages,
+// such as a topic followed by its payload, are joined by spaces. Commands,
+// like the heartbeats of ZMTP 3.1, are skipped.
+func (z *zmtpConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for frames := 0; ; {
+		flags, body, err := z.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpCommand != 0 {
+			continue
+		}
+
+		if frames > 0 {
+			msg = append(msg, ' ')
+		}
+		frames++
+		msg = append(msg, body...)
+		if int64(len(msg)) > z.max {
+			return nil, fmt.Errorf("ZMTP message is too large")
+		}
+		if flags&zmtpMore == 0 {
+			return msg, nil
+		}
+	}
+}
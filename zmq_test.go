@@ -0,0 +1,196 @@
+package misp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// zmqTestPublisher accepts subscribers on a local port and plays the part
+// of MISP: each connection gets the messages of the next batch, and is
+// then closed
+type zmqTestPublisher struct {
+	listener      net.Listener
+	subscriptions chan []string
+}
+
+func newZMQTestPublisher(t *testing.T, socketType string, batches ...[][]byte) *zmqTestPublisher {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err)
+	}
+
+	p := &zmqTestPublisher{listener: l, subscriptions: make(chan []string, len(batches))}
+	go func() {
+		for _, batch := range batches {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			p.serve(t, conn, socketType, batch)
+		}
+	}()
+
+	return p
+}
+
+func (p *zmqTestPublisher) serve(t *testing.T, conn net.Conn, socketType string, batch [][]byte) {
+	defer conn.Close()
+
+	z := &zmtpConn{r: bufio.NewReader(conn), w: conn, max: DefaultZMQMaxMessageSize}
+
+	conn.Write(zmtpGreeting(true))
+	greeting := make([]byte, 64)
+	if _, err := io.ReadFull(z.r, greeting); err != nil {
+		return
+	}
+	z.writeFrame(zmtpCommand, zmtpReady(socketType))
+	if _, body, err := z.readFrame(); err != nil {
+		return
+	} else if name, props, _ := zmtpParseCommand(body); name != "READY" || props["Socket-Type"] != "SUB" {
+		t.Errorf("Subscriber sent %s %v", name, props)
+	}
+
+	// Subscriptions are sent before any message is read
+	var topics []string
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	for {
+		_, body, err := z.readFrame()
+		if err != nil {
+			break
+		}
+		if len(body) > 0 && body[0] == 1 {
+			topics = append(topics, string(body[1:]))
+		}
+	}
+	p.subscriptions <- topics
+
+	for _, msg := range batch {
+		if bytes.HasPrefix(msg, []byte("multipart ")) {
+			z.writeFrame(zmtpMore, []byte("misp_json_self"))
+			z.writeFrame(0, bytes.TrimPrefix(msg, []byte("multipart ")))
+			continue
+		}
+		z.writeFrame(0, msg)
+	}
+}
+
+func (p *zmqTestPublisher) address() string {
+	return "tcp://" + p.listener.Addr().String()
+}
+
+func TestZMQSubscriber(t *testing.T) {
+	p := newZMQTestPublisher(t, "PUB",
+		[][]byte{
+			[]byte(`misp_json_event {"Event": {"id": "12", "info": "Foobar", "threat_level_id": "1", "Attribute": [{"type": "domain", "value": "foo.example"}]}, "action": "publish"}`),
+			[]byte(`misp_json_attribute {"Attribute": {"id": "101", "event_id": "12", "type": "ip-dst", "value": "198.51.100.7", "to_ids": true}, "Event": {"id": "12"}, "action": "add"}`),
+			[]byte(`misp_json_attribute {"Attribute": `),
+		},
+		// After the reconnection
+		[][]byte{
+			[]byte(`misp_json_sighting {"Sighting": {"id": "5", "type": "0", "source": "sensor-1", "Event": {"id": "12"}, "Attribute": {"id": "101", "value": "198.51.100.7"}}, "action": "add"}`),
+			[]byte(`misp_json_self {"status": "ping"}`),
+			[]byte(`multipart {"uptime": "42"}`),
+		},
+	)
+	defer p.listener.Close()
+
+	events := make(chan ZMQEvent, 1)
+	attributes := make(chan ZMQAttribute, 1)
+	sightings := make(chan ZMQSighting, 1)
+	messages := make(chan ZMQMessage, 2)
+	errors := make(chan error, 10)
+
+	s := &ZMQSubscriber{
+		Address:           p.address(),
+		Events:            events,
+		Attributes:        attributes,
+		Sightings:         sightings,
+		Messages:          messages,
+		Topics:            []string{ZMQTopicSelf},
+		Errors:            errors,
+		ReconnectInterval: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error)
+	go func() { result <- s.Run(ctx) }()
+
+	topics := <-p.subscriptions
+	want := []string{ZMQTopicEvent, ZMQTopicAttribute, ZMQTopicSighting, ZMQTopicSelf}
+	if len(topics) != len(want) {
+		t.Fatalf("Subscriber subscribed to %v", topics)
+	}
+	for i := range want {
+		if topics[i] != want[i] {
+			t.Errorf("Subscriber subscribed to %v, want %v", topics, want)
+		}
+	}
+
+	e := <-events
+	if e.Action != "publish" || e.Event.ID != "12" || e.Event.ThreatLevelID != ThreatLevelHigh || len(e.Event.Attribute) != 1 {
+		t.Errorf("Subscriber delivered event %+v", e)
+	}
+
+	a := <-attributes
+	if a.Action != "add" || a.Attribute.Value != "198.51.100.7" || !a.Attribute.ToIDS || a.Event == nil || a.Event.ID != "12" {
+		t.Errorf("Subscriber delivered attribute %+v", a)
+	}
+
+	sighting := <-sightings
+	if sighting.Sighting.Source != "sensor-1" || sighting.Sighting.Type != SightingTypeSighting || sighting.Attribute == nil || sighting.Attribute.ID != "101" || sighting.Event.ID != "12" {
+		t.Errorf("Subscriber delivered sighting %+v", sighting)
+	}
+
+	for _, payload := range []string{`{"status": "ping"}`, `{"uptime": "42"}`} {
+		m := <-messages
+		if m.Topic != ZMQTopicSelf || string(m.Payload) != payload {
+			t.Errorf("Subscriber delivered message %s %s", m.Topic, m.Payload)
+		}
+	}
+
+	// The truncated attribute and the disconnection are reported
+	if err := <-errors; err == nil {
+		t.Errorf("Subscriber did not report the invalid message")
+	}
+
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+}
+
+func TestZMQSubscriberSocketType(t *testing.T) {
+	p := newZMQTestPublisher(t, "REP", nil)
+	defer p.listener.Close()
+
+	errors := make(chan error, 1)
+	s := &ZMQSubscriber{
+		Address:           p.listener.Addr().String(),
+		Messages:          make(chan ZMQMessage),
+		Errors:            errors,
+		ReconnectInterval: time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx)
+	defer cancel()
+
+	select {
+	case err := <-errors:
+		if err == nil || err.Error() != "peer socket type REP is not PUB or XPUB" {
+			t.Errorf("Subscriber reported %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Subscriber accepted a REP socket")
+	}
+
+	if err := (&ZMQSubscriber{}).Run(ctx); err == nil {
+		t.Errorf("Run accepted a subscriber without channel")
+	}
+}